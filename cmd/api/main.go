@@ -2,14 +2,19 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/logging"
 	"github.com/GRACENOBLE/auth-starter/internal/server"
 )
 
@@ -21,7 +26,7 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 	// Listen for the interrupt signal.
 	<-ctx.Done()
 
-	log.Println("shutting down gracefully, press Ctrl+C again to force")
+	slog.Info("Shutting down gracefully, press Ctrl+C again to force")
 	stop() // Allow Ctrl+C to force shutdown
 
 	// The context is used to inform the server it has 5 seconds to finish
@@ -29,20 +34,41 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := apiServer.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown with error: %v", err)
+		slog.Error("Server forced to shutdown", "error", err)
 	}
 
-	log.Println("Server exiting")
+	slog.Info("Server exiting")
 
 	// Notify the main goroutine that the shutdown is complete
 	done <- true
 }
 
 func main() {
+	configFile := flag.String("config", "", "optional env-format file with settings; the environment takes precedence")
+	flag.Parse()
 
-	auth.NewAuth()
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		// The logger is configured from cfg, so report problems plainly.
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logging.New(cfg.Log, os.Stderr))
+
+	db := database.New(cfg.Database)
+
+	if cfg.Database.AutoMigrate {
+		applied, err := db.MigrateUp(context.Background())
+		if err != nil {
+			slog.Error("Failed to migrate database", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Applied database migrations", "count", applied)
+	}
+
+	auth.NewAuth(cfg, db)
 
-	server := server.NewServer()
+	server := server.NewServer(cfg, db)
 
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
@@ -50,12 +76,12 @@ func main() {
 	// Run graceful shutdown in a separate goroutine
 	go gracefulShutdown(server, done)
 
-	err := server.ListenAndServe()
+	err = server.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
 		panic(fmt.Sprintf("http server error: %s", err))
 	}
 
 	// Wait for the graceful shutdown to complete
 	<-done
-	log.Println("Graceful shutdown complete.")
+	slog.Info("Graceful shutdown complete")
 }
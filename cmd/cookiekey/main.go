@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+const usage = `usage: cookiekey [-rotate] [-keep n] [-config file]
+
+Prints a COOKIE_STORE_KEYS line with a newly generated cookie key.
+
+  -rotate     put the new key in front of the keys currently in
+              COOKIE_STORE_KEYS, so existing sessions stay valid
+  -keep n     with -rotate, keep at most n keys in total (0 keeps all)
+  -config     optional env-format file to read the current keys from`
+
+func main() {
+	rotate := flag.Bool("rotate", false, "")
+	keep := flag.Int("keep", 0, "")
+	configFile := flag.String("config", "", "")
+	flag.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	flag.Parse()
+
+	if flag.NArg() > 0 || *keep < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	keys := []config.CookieKey{auth.GenerateCookieKey()}
+	if *rotate {
+		current, err := config.LoadCookieKeys(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		keys = append(keys, current...)
+		if *keep > 0 && len(keys) > *keep {
+			keys = keys[:*keep]
+		}
+	}
+
+	fmt.Println("COOKIE_STORE_KEYS=" + config.FormatCookieKeys(keys))
+}
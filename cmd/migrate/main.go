@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+const usage = `usage: migrate [-config file] <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    revert the last n applied migrations (default 1)
+  status      list migrations and whether they are applied
+  assign-role <email> <role>
+              give an existing user a role, e.g. to create the first admin`
+
+func main() {
+	configFile := flag.String("config", "", "optional env-format file with settings")
+	flag.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadDatabase(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db := database.New(cfg)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp(ctx)
+		if err != nil {
+			log.Fatalf("migrate up: %v", err)
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatalf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := db.MigrateDown(ctx, steps)
+		if err != nil {
+			log.Fatalf("migrate down: %v", err)
+		}
+		fmt.Printf("Reverted %d migration(s)\n", reverted)
+
+	case "status":
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("migrate status: %v", err)
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-40s %s\n", st.Version, st.Name, state)
+		}
+
+	case "assign-role":
+		if len(args) != 3 {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		user, err := db.GetUserByEmail(ctx, args[1])
+		if err != nil {
+			log.Fatalf("find user %q: %v", args[1], err)
+		}
+		if err := db.AssignRole(ctx, user.ID, args[2]); err != nil {
+			log.Fatalf("assign role %q: %v", args[2], err)
+		}
+		fmt.Printf("Assigned role %s to %s\n", args[2], user.Email)
+
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
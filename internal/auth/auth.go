@@ -1,43 +1,82 @@
 package auth
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
-	"os"
+	"time"
 
 	"github.com/gorilla/sessions"
-	"github.com/joho/godotenv"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
-	"github.com/markbates/goth/providers/google"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
 )
 
 const (
 	MaxAge = 86400 * 30
-	IsProd = false
+
+	// SessionCleanupInterval is how often expired server-side sessions
+	// are purged.
+	SessionCleanupInterval = time.Hour
 )
 
-func NewAuth() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-	key := os.Getenv("COOKIE_STORE_KEY")
-	googleClientId := os.Getenv("GOOGLE_CLIENT_ID")
-	googleClientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
-	backendURI := os.Getenv("BACKEND_URI")
+const (
+	// SessionName is the name of the session that holds the signed-in user.
+	SessionName = "auth_session"
+	// SessionUserIDKey is the session value holding our internal user ID.
+	SessionUserIDKey = "user_id"
+	// SessionProviderKey is the session value holding the login provider.
+	SessionProviderKey = "provider"
+	// SessionMFAUserIDKey holds the user who has passed the first factor
+	// but not yet the second. Such a session does not sign anyone in.
+	SessionMFAUserIDKey = "mfa_user_id"
+	// SessionMFAStartedKey holds the Unix time the MFA challenge began.
+	SessionMFAStartedKey = "mfa_started"
+	// SessionLinkUserIDKey holds the signed-in user who started an OAuth
+	// flow in link mode; the resulting identity is attached to them.
+	SessionLinkUserIDKey = "link_user_id"
+	// SessionOrganizationIDKey holds the signed-in user's active
+	// organization.
+	SessionOrganizationIDKey = "organization_id"
+	// SessionInvitationKey holds an organization invitation token opened
+	// from an invitation email, until the user confirms it.
+	SessionInvitationKey = "invitation_token"
+)
 
-	store := sessions.NewCookieStore([]byte(key))
-	store.MaxAge(MaxAge)
+// NewAuth installs the session store into gothic and registers the OAuth
+// providers configured in cfg. Sessions are stored in Postgres through db;
+// when db is nil they are kept in cookies only. In production the session
+// cookie is only sent over HTTPS.
+//
+// Cookies are written with the first of cfg.CookieKeys and accepted with
+// any of them, so a new key can be added in front without signing
+// everyone out.
+func NewAuth(cfg *config.Config, db database.Service) {
+	keyPairs := cookieKeyPairs(cfg.CookieKeys)
 
-	store.Options.Path = "/"
-	store.Options.HttpOnly = true
-	store.Options.Secure = IsProd
-	store.Options.SameSite = http.SameSiteLaxMode // Allow cookies from OAuth redirects
+	var options *sessions.Options
+	if db != nil {
+		store := NewPGStore(db, keyPairs...)
+		go store.Cleanup(context.Background(), SessionCleanupInterval)
+		options = store.Options
+		gothic.Store = store
+	} else {
+		store := sessions.NewCookieStore(keyPairs...)
+		store.MaxAge(MaxAge)
+		options = store.Options
+		gothic.Store = store
+	}
 
-	gothic.Store = store
+	options.Path = "/"
+	options.HttpOnly = true
+	options.Secure = cfg.Production()
+	options.SameSite = http.SameSiteLaxMode // Allow cookies from OAuth redirects
 
-	goth.UseProviders(
-		google.New(googleClientId, googleClientSecret, backendURI+"/auth/google/callback"),
-	)
+	providers := configuredProviders(cfg.BackendURI, cfg.OAuth)
+	if len(providers) == 0 {
+		slog.Warn("No OAuth providers configured; set <PROVIDER>_CLIENT_ID and <PROVIDER>_CLIENT_SECRET")
+	}
+	goth.UseProviders(providers...)
 }
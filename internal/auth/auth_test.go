@@ -1,13 +1,16 @@
 package auth
 
 import (
-	"os"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
 )
 
 func TestConstants(t *testing.T) {
@@ -15,86 +18,42 @@ func TestConstants(t *testing.T) {
 		expected := 86400 * 30 // 30 days
 		assert.Equal(t, expected, MaxAge)
 	})
-
-	t.Run("IsProd should be false by default", func(t *testing.T) {
-		assert.False(t, IsProd)
-	})
 }
 
-func TestNewAuth(t *testing.T) {
-	
-	setupTestEnv := func(t *testing.T) func() {
-		t.Helper()
-
-		envContent := []byte("GOOGLE_CLIENT_ID=test_client_id\nGOOGLE_CLIENT_SECRET=test_client_secret\n")
-		err := os.WriteFile(".env.test", envContent, 0644)
-		require.NoError(t, err)
-
-		originalEnvFile := ".env"
-		os.Rename(".env", ".env.backup")
-		os.Rename(".env.test", ".env")
-
-		return func() {
-			os.Remove(".env")
-			if _, err := os.Stat(".env.backup"); err == nil {
-				os.Rename(".env.backup", originalEnvFile)
-			}
-
-			goth.ClearProviders()
-		}
+// testConfig returns a configuration with Google credentials set.
+func testConfig(clientID, clientSecret string) *config.Config {
+	return &config.Config{
+		BackendURI: "http://localhost:8080",
+		CookieKeys: []config.CookieKey{{HashKey: []byte("test_cookie_store_key")}},
+		OAuth: map[string]config.OAuthClient{
+			"GOOGLE": {ClientID: clientID, ClientSecret: clientSecret},
+		},
 	}
+}
 
-	t.Run("should load environment variables", func(t *testing.T) {
-		cleanup := setupTestEnv(t)
-		defer cleanup()
-
-		os.Setenv("GOOGLE_CLIENT_ID", "test_client_id")
-		os.Setenv("GOOGLE_CLIENT_SECRET", "test_client_secret")
-		os.Setenv("COOKIE_STORE_KEY", "test_cookie_store_key")
+func TestNewAuth(t *testing.T) {
+	t.Cleanup(goth.ClearProviders)
 
-		defer func() {
-			os.Unsetenv("GOOGLE_CLIENT_ID")
-			os.Unsetenv("GOOGLE_CLIENT_SECRET")
-			os.Unsetenv("COOKIE_STORE_KEY")
-		}()
+	t.Run("should not panic", func(t *testing.T) {
+		defer goth.ClearProviders()
 
 		assert.NotPanics(t, func() {
-			NewAuth()
+			NewAuth(testConfig("test_client_id", "test_client_secret"), nil)
 		})
-
-		assert.Equal(t, "test_client_id", os.Getenv("GOOGLE_CLIENT_ID"))
-		assert.Equal(t, "test_client_secret", os.Getenv("GOOGLE_CLIENT_SECRET"))
-		assert.Equal(t, "test_cookie_store_key", os.Getenv("COOKIE_STORE_KEY"))
 	})
 
 	t.Run("should configure gothic store", func(t *testing.T) {
-		cleanup := setupTestEnv(t)
-		defer cleanup()
-
-		os.Setenv("GOOGLE_CLIENT_ID", "test_client_id")
-		os.Setenv("GOOGLE_CLIENT_SECRET", "test_client_secret")
-		defer func() {
-			os.Unsetenv("GOOGLE_CLIENT_ID")
-			os.Unsetenv("GOOGLE_CLIENT_SECRET")
-		}()
+		defer goth.ClearProviders()
 
-		NewAuth()
+		NewAuth(testConfig("test_client_id", "test_client_secret"), nil)
 
 		assert.NotNil(t, gothic.Store)
 	})
 
 	t.Run("should register Google provider", func(t *testing.T) {
-		cleanup := setupTestEnv(t)
-		defer cleanup()
-
-		os.Setenv("GOOGLE_CLIENT_ID", "test_client_id")
-		os.Setenv("GOOGLE_CLIENT_SECRET", "test_client_secret")
-		defer func() {
-			os.Unsetenv("GOOGLE_CLIENT_ID")
-			os.Unsetenv("GOOGLE_CLIENT_SECRET")
-		}()
+		defer goth.ClearProviders()
 
-		NewAuth()
+		NewAuth(testConfig("test_client_id", "test_client_secret"), nil)
 
 		providers := goth.GetProviders()
 		assert.NotEmpty(t, providers)
@@ -104,20 +63,9 @@ func TestNewAuth(t *testing.T) {
 	})
 
 	t.Run("should configure Google provider with correct credentials", func(t *testing.T) {
-		cleanup := setupTestEnv(t)
-		defer cleanup()
+		defer goth.ClearProviders()
 
-		testClientID := "test_google_client_id"
-		testClientSecret := "test_google_secret"
-
-		os.Setenv("GOOGLE_CLIENT_ID", testClientID)
-		os.Setenv("GOOGLE_CLIENT_SECRET", testClientSecret)
-		defer func() {
-			os.Unsetenv("GOOGLE_CLIENT_ID")
-			os.Unsetenv("GOOGLE_CLIENT_SECRET")
-		}()
-
-		NewAuth()
+		NewAuth(testConfig("test_google_client_id", "test_google_secret"), nil)
 
 		providers := goth.GetProviders()
 		googleProvider, exists := providers["google"]
@@ -126,24 +74,38 @@ func TestNewAuth(t *testing.T) {
 		assert.Equal(t, "google", googleProvider.Name())
 		assert.NotNil(t, googleProvider)
 	})
+
+	t.Run("should skip providers without credentials", func(t *testing.T) {
+		defer goth.ClearProviders()
+
+		NewAuth(testConfig("test_client_id", ""), nil)
+
+		assert.Empty(t, goth.GetProviders())
+	})
 }
 
 func TestSessionConfiguration(t *testing.T) {
-	t.Run("session store should have correct MaxAge", func(t *testing.T) {
+	t.Run("session cookie should be secure only in production", func(t *testing.T) {
+		defer goth.ClearProviders()
 
-		os.Setenv("GOOGLE_CLIENT_ID", "test_id")
-		os.Setenv("GOOGLE_CLIENT_SECRET", "test_secret")
-		defer func() {
-			os.Unsetenv("GOOGLE_CLIENT_ID")
-			os.Unsetenv("GOOGLE_CLIENT_SECRET")
-			goth.ClearProviders()
-		}()
+		cfg := testConfig("test_id", "test_secret")
+		NewAuth(cfg, nil)
+		session, err := gothic.Store.New(httptest.NewRequest(http.MethodGet, "/", nil), SessionName)
+		require.NoError(t, err)
+		assert.False(t, session.Options.Secure)
+		assert.True(t, session.Options.HttpOnly)
 
-		envContent := []byte("GOOGLE_CLIENT_ID=test_id\nGOOGLE_CLIENT_SECRET=test_secret\n")
-		os.WriteFile(".env", envContent, 0644)
-		defer os.Remove(".env")
+		cfg.Env = config.EnvProduction
+		NewAuth(cfg, nil)
+		session, err = gothic.Store.New(httptest.NewRequest(http.MethodGet, "/", nil), SessionName)
+		require.NoError(t, err)
+		assert.True(t, session.Options.Secure)
+	})
+
+	t.Run("session store should have correct MaxAge", func(t *testing.T) {
+		defer goth.ClearProviders()
 
-		NewAuth()
+		NewAuth(testConfig("test_id", "test_secret"), nil)
 
 		assert.NotNil(t, gothic.Store)
 	})
@@ -151,21 +113,10 @@ func TestSessionConfiguration(t *testing.T) {
 
 func TestAuthPackageIntegration(t *testing.T) {
 	t.Run("full auth initialization flow", func(t *testing.T) {
-		envContent := []byte("GOOGLE_CLIENT_ID=integration_test_id\nGOOGLE_CLIENT_SECRET=integration_test_secret\n")
-		err := os.WriteFile(".env", envContent, 0644)
-		require.NoError(t, err)
-		defer os.Remove(".env")
-
-		os.Setenv("GOOGLE_CLIENT_ID", "integration_test_id")
-		os.Setenv("GOOGLE_CLIENT_SECRET", "integration_test_secret")
-		defer func() {
-			os.Unsetenv("GOOGLE_CLIENT_ID")
-			os.Unsetenv("GOOGLE_CLIENT_SECRET")
-			goth.ClearProviders()
-		}()
+		defer goth.ClearProviders()
 
 		assert.NotPanics(t, func() {
-			NewAuth()
+			NewAuth(testConfig("integration_test_id", "integration_test_secret"), nil)
 		})
 
 		providers := goth.GetProviders()
@@ -179,20 +130,12 @@ func TestAuthPackageIntegration(t *testing.T) {
 }
 
 func BenchmarkNewAuth(b *testing.B) {
-	envContent := []byte("GOOGLE_CLIENT_ID=bench_test_id\nGOOGLE_CLIENT_SECRET=bench_test_secret\n")
-	os.WriteFile(".env", envContent, 0644)
-	defer os.Remove(".env")
-
-	os.Setenv("GOOGLE_CLIENT_ID", "bench_test_id")
-	os.Setenv("GOOGLE_CLIENT_SECRET", "bench_test_secret")
-	defer func() {
-		os.Unsetenv("GOOGLE_CLIENT_ID")
-		os.Unsetenv("GOOGLE_CLIENT_SECRET")
-	}()
+	cfg := testConfig("bench_test_id", "bench_test_secret")
+	defer goth.ClearProviders()
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		goth.ClearProviders()
-		NewAuth()
+		NewAuth(cfg, nil)
 	}
 }
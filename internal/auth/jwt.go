@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+const (
+	// DefaultAccessTokenTTL is the lifetime of access tokens when
+	// JWT_ACCESS_TOKEN_TTL is not set.
+	DefaultAccessTokenTTL = 15 * time.Minute
+
+	// DefaultRefreshTokenTTL is the lifetime of refresh tokens when
+	// JWT_REFRESH_TOKEN_TTL is not set.
+	DefaultRefreshTokenTTL = MaxAge * time.Second
+)
+
+// ErrInvalidToken is returned when an access token fails validation.
+var ErrInvalidToken = errors.New("auth: invalid access token")
+
+// TokenConfig configures how access tokens are signed and validated.
+type TokenConfig struct {
+	Issuer    string
+	Audience  string
+	TTL       time.Duration
+	Algorithm string // HS*, RS*, PS*, ES* or EdDSA
+
+	// RefreshTTL is the lifetime of each refresh token. Every rotation
+	// issues a token with a fresh lifetime.
+	RefreshTTL time.Duration
+}
+
+// TokenIssuer mints and validates first-party JWT access tokens.
+type TokenIssuer struct {
+	config    TokenConfig
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	keyID     string
+}
+
+// AccessTokenClaims are the claims carried by an access token. The
+// subject is our internal user ID.
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served from the JWKS endpoint.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewTokenIssuerFromConfig builds the TokenIssuer described by cfg. It
+// returns nil when JWT support is disabled.
+//
+// HMAC algorithms sign with cfg.SigningKey. Asymmetric algorithms read a
+// PEM private key from cfg.PrivateKeyFile; without one an ephemeral key is
+// generated, so tokens do not survive a restart.
+func NewTokenIssuerFromConfig(jwtCfg config.JWT) (*TokenIssuer, error) {
+	if !jwtCfg.Enabled {
+		return nil, nil
+	}
+
+	cfg := TokenConfig{
+		Issuer:     jwtCfg.Issuer,
+		Audience:   jwtCfg.Audience,
+		TTL:        jwtCfg.AccessTokenTTL,
+		Algorithm:  jwtCfg.Algorithm,
+		RefreshTTL: jwtCfg.RefreshTokenTTL,
+	}
+
+	var key interface{}
+	if strings.HasPrefix(cfg.Algorithm, "HS") {
+		if jwtCfg.SigningKey == "" {
+			return nil, errors.New("JWT_SIGNING_KEY is required for " + cfg.Algorithm)
+		}
+		key = []byte(jwtCfg.SigningKey)
+	} else if path := jwtCfg.PrivateKeyFile; path != "" {
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read JWT_PRIVATE_KEY_FILE: %w", err)
+		}
+		key, err = parsePrivateKey(pemBytes)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		slog.Warn("JWT_PRIVATE_KEY_FILE not set; using an ephemeral key", "algorithm", cfg.Algorithm)
+		var err error
+		key, err = generateKey(cfg.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewTokenIssuer(cfg, key)
+}
+
+// NewTokenIssuer returns a TokenIssuer that signs with key. The key must
+// be a []byte secret for HMAC algorithms, or an *rsa.PrivateKey,
+// *ecdsa.PrivateKey or ed25519.PrivateKey matching the algorithm.
+func NewTokenIssuer(cfg TokenConfig, key interface{}) (*TokenIssuer, error) {
+	method := jwt.GetSigningMethod(cfg.Algorithm)
+	if method == nil || method == jwt.SigningMethodNone {
+		return nil, fmt.Errorf("unsupported JWT signing algorithm %q", cfg.Algorithm)
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultAccessTokenTTL
+	}
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = DefaultRefreshTokenTTL
+	}
+
+	t := &TokenIssuer{config: cfg, method: method, signKey: key}
+
+	switch k := key.(type) {
+	case []byte:
+		if _, ok := method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("%s requires a private key, not a shared secret", cfg.Algorithm)
+		}
+		t.verifyKey = k
+	case *rsa.PrivateKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		default:
+			return nil, fmt.Errorf("an RSA key cannot be used with %s", cfg.Algorithm)
+		}
+		t.verifyKey = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		m, ok := method.(*jwt.SigningMethodECDSA)
+		if !ok || m.CurveBits != k.Curve.Params().BitSize {
+			return nil, fmt.Errorf("an ECDSA %s key cannot be used with %s", k.Curve.Params().Name, cfg.Algorithm)
+		}
+		t.verifyKey = &k.PublicKey
+	case ed25519.PrivateKey:
+		if method != jwt.SigningMethodEdDSA {
+			return nil, fmt.Errorf("an Ed25519 key cannot be used with %s", cfg.Algorithm)
+		}
+		t.verifyKey = k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing key type %T", key)
+	}
+
+	if _, ok := key.([]byte); !ok {
+		der, err := x509.MarshalPKIXPublicKey(t.verifyKey)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(der)
+		t.keyID = base64.RawURLEncoding.EncodeToString(sum[:12])
+	}
+
+	return t, nil
+}
+
+// TTL returns the lifetime of issued access tokens.
+func (t *TokenIssuer) TTL() time.Duration {
+	return t.config.TTL
+}
+
+// RefreshTTL returns the lifetime of issued refresh tokens.
+func (t *TokenIssuer) RefreshTTL() time.Duration {
+	return t.config.RefreshTTL
+}
+
+// Issue returns a signed access token for userID and its expiry time.
+func (t *TokenIssuer) Issue(userID string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(t.config.TTL)
+
+	claims := AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.config.Issuer,
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        base64.RawURLEncoding.EncodeToString(randomBytes(16)),
+		},
+	}
+	if t.config.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{t.config.Audience}
+	}
+
+	token := jwt.NewWithClaims(t.method, claims)
+	if t.keyID != "" {
+		token.Header["kid"] = t.keyID
+	}
+
+	signed, err := token.SignedString(t.signKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// Verify validates an access token and returns its claims. Any failure
+// is reported as ErrInvalidToken.
+func (t *TokenIssuer) Verify(tokenString string) (*AccessTokenClaims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{t.method.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if t.config.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(t.config.Issuer))
+	}
+	if t.config.Audience != "" {
+		opts = append(opts, jwt.WithAudience(t.config.Audience))
+	}
+
+	var claims AccessTokenClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (interface{}, error) {
+		return t.verifyKey, nil
+	}, opts...)
+	if err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// JWKS returns the public signing keys. It is empty for HMAC algorithms,
+// whose secret must never be published.
+func (t *TokenIssuer) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	jwk := JWK{KeyID: t.keyID, Use: "sig", Algorithm: t.method.Alg()}
+	switch k := t.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = k.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	default:
+		return set
+	}
+
+	set.Keys = append(set.Keys, jwk)
+	return set
+}
+
+// parsePrivateKey decodes a PEM encoded PKCS#1, SEC 1 or PKCS#8 private key.
+func parsePrivateKey(pemBytes []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("JWT private key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+}
+
+// generateKey creates a new private key suitable for alg.
+func generateKey(alg string) (crypto.PrivateKey, error) {
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing algorithm %q", alg)
+	}
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("auth: source of randomness unavailable: " + err.Error())
+	}
+	return b
+}
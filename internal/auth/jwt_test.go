@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+func TestTokenIssuer(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	cases := []struct {
+		alg string
+		key interface{}
+		kty string
+	}{
+		{"HS256", []byte("shared-secret"), ""},
+		{"RS256", rsaKey, "RSA"},
+		{"PS256", rsaKey, "RSA"},
+		{"ES256", ecKey, "EC"},
+		{"EdDSA", edKey, "OKP"},
+	}
+
+	for _, tc := range cases {
+		t.Run("should round-trip tokens signed with "+tc.alg, func(t *testing.T) {
+			issuer, err := NewTokenIssuer(TokenConfig{
+				Issuer: "https://api.example.com", Audience: "mobile", TTL: time.Minute, Algorithm: tc.alg,
+			}, tc.key)
+			require.NoError(t, err)
+
+			token, expiresAt, err := issuer.Issue("user-1")
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, time.Second)
+
+			claims, err := issuer.Verify(token)
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", claims.Subject)
+			assert.Equal(t, "https://api.example.com", claims.Issuer)
+			assert.Equal(t, jwt.ClaimStrings{"mobile"}, claims.Audience)
+
+			jwks := issuer.JWKS()
+			if tc.kty == "" {
+				assert.Empty(t, jwks.Keys, "HMAC secrets must not be published")
+				return
+			}
+			require.Len(t, jwks.Keys, 1)
+			assert.Equal(t, tc.kty, jwks.Keys[0].KeyType)
+			assert.Equal(t, tc.alg, jwks.Keys[0].Algorithm)
+			assert.NotEmpty(t, jwks.Keys[0].KeyID)
+		})
+	}
+
+	t.Run("should reject tokens for another audience or issuer", func(t *testing.T) {
+		cfg := TokenConfig{Issuer: "https://api.example.com", Audience: "mobile", Algorithm: "HS256"}
+		issuer, err := NewTokenIssuer(cfg, []byte("shared-secret"))
+		require.NoError(t, err)
+
+		cfg.Audience = "web"
+		other, err := NewTokenIssuer(cfg, []byte("shared-secret"))
+		require.NoError(t, err)
+		token, _, err := other.Issue("user-1")
+		require.NoError(t, err)
+		_, err = issuer.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		cfg.Audience, cfg.Issuer = "mobile", "https://evil.example.com"
+		other, err = NewTokenIssuer(cfg, []byte("shared-secret"))
+		require.NoError(t, err)
+		token, _, err = other.Issue("user-1")
+		require.NoError(t, err)
+		_, err = issuer.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("should reject expired tokens", func(t *testing.T) {
+		issuer, err := NewTokenIssuer(TokenConfig{Algorithm: "HS256", TTL: time.Nanosecond}, []byte("shared-secret"))
+		require.NoError(t, err)
+
+		token, _, err := issuer.Issue("user-1")
+		require.NoError(t, err)
+		time.Sleep(time.Second)
+
+		_, err = issuer.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("should reject tokens signed with a different algorithm", func(t *testing.T) {
+		issuer, err := NewTokenIssuer(TokenConfig{Algorithm: "RS256"}, rsaKey)
+		require.NoError(t, err)
+
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		})
+		token, err := forged.SignedString([]byte("guessed-secret"))
+		require.NoError(t, err)
+
+		_, err = issuer.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("should reject keys that do not match the algorithm", func(t *testing.T) {
+		_, err := NewTokenIssuer(TokenConfig{Algorithm: "ES384"}, ecKey)
+		assert.Error(t, err)
+
+		_, err = NewTokenIssuer(TokenConfig{Algorithm: "RS256"}, []byte("secret"))
+		assert.Error(t, err)
+
+		_, err = NewTokenIssuer(TokenConfig{Algorithm: "none"}, []byte("secret"))
+		assert.Error(t, err)
+	})
+}
+
+func TestNewTokenIssuerFromConfig(t *testing.T) {
+	t.Run("should be disabled unless JWT is enabled", func(t *testing.T) {
+		issuer, err := NewTokenIssuerFromConfig(config.JWT{SigningKey: "shared-secret"})
+		require.NoError(t, err)
+		assert.Nil(t, issuer)
+	})
+
+	t.Run("should apply the configured settings", func(t *testing.T) {
+		issuer, err := NewTokenIssuerFromConfig(config.JWT{
+			Enabled:        true,
+			Algorithm:      "HS256",
+			SigningKey:     "shared-secret",
+			Issuer:         "https://api.example.com",
+			AccessTokenTTL: 5 * time.Minute,
+		})
+		require.NoError(t, err)
+		require.NotNil(t, issuer)
+		assert.Equal(t, 5*time.Minute, issuer.TTL())
+		assert.Equal(t, "https://api.example.com", issuer.config.Issuer)
+	})
+
+	t.Run("should require a secret for HMAC algorithms", func(t *testing.T) {
+		_, err := NewTokenIssuerFromConfig(config.JWT{Enabled: true, Algorithm: "HS256"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// PasswordProvider is the provider name recorded on sessions started
+	// with an email address and password.
+	PasswordProvider = "password"
+
+	// MagicLinkProvider is the provider name recorded on sessions started
+	// from an emailed sign-in link.
+	MagicLinkProvider = "magic_link"
+)
+
+const (
+	// MinPasswordLength is the minimum number of characters in a password.
+	MinPasswordLength = 8
+
+	// MaxPasswordLength caps password length so that hashing cost stays
+	// bounded.
+	MaxPasswordLength = 128
+)
+
+var (
+	// ErrPasswordTooShort and ErrPasswordTooLong are returned by
+	// CheckPasswordPolicy.
+	ErrPasswordTooShort = fmt.Errorf("auth: password must be at least %d characters", MinPasswordLength)
+	ErrPasswordTooLong  = fmt.Errorf("auth: password must be at most %d characters", MaxPasswordLength)
+
+	// ErrPasswordMatchesEmail is returned for a password equal to the
+	// account's email address.
+	ErrPasswordMatchesEmail = errors.New("auth: password must not match the email address")
+
+	// ErrInvalidPasswordHash is returned when a stored hash cannot be parsed.
+	ErrInvalidPasswordHash = errors.New("auth: invalid password hash")
+)
+
+// argon2id parameters, following the OWASP recommendation of 19 MiB of
+// memory, two iterations and one degree of parallelism.
+const (
+	argonTime    = 2
+	argonMemory  = 19 * 1024
+	argonThreads = 1
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+// dummyHash is verified against when a login names an unknown account so
+// that response times do not reveal which email addresses are registered.
+var dummyHash = HashPassword("not-a-real-password")
+
+// CheckPasswordPolicy reports whether password is acceptable for an
+// account with the given email address.
+func CheckPasswordPolicy(password, email string) error {
+	n := utf8.RuneCountInString(password)
+	switch {
+	case n < MinPasswordLength:
+		return ErrPasswordTooShort
+	case n > MaxPasswordLength:
+		return ErrPasswordTooLong
+	case email != "" && strings.EqualFold(password, email):
+		return ErrPasswordMatchesEmail
+	}
+	return nil
+}
+
+// HashPassword hashes password with argon2id and returns it in the PHC
+// string format, e.g. "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>".
+func HashPassword(password string) string {
+	salt := randomBytes(argonSaltLen)
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+// VerifyPassword reports whether password matches an encoded hash produced
+// by HashPassword. The hash's own parameters are used, so hashes remain
+// valid when the defaults change.
+func VerifyPassword(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrInvalidPasswordHash
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, ErrInvalidPasswordHash
+	}
+
+	got := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// CheckPassword verifies password against encoded, which may be empty when
+// the account has no password. It always performs a full hash so that the
+// outcome cannot be inferred from timing.
+func CheckPassword(password, encoded string) bool {
+	if encoded == "" {
+		_, _ = VerifyPassword(password, dummyHash)
+		return false
+	}
+	ok, err := VerifyPassword(password, encoded)
+	return err == nil && ok
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	t.Run("should verify a hashed password", func(t *testing.T) {
+		hash := HashPassword("correct horse battery")
+
+		assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"))
+
+		ok, err := VerifyPassword("correct horse battery", hash)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = VerifyPassword("wrong password", hash)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("should salt each hash", func(t *testing.T) {
+		assert.NotEqual(t, HashPassword("same password"), HashPassword("same password"))
+	})
+
+	t.Run("should reject malformed hashes", func(t *testing.T) {
+		for _, hash := range []string{"", "plain", "$bcrypt$v=19$m=1,t=1,p=1$c2FsdA$aGFzaA", "$argon2id$v=19$m=1$c2FsdA$aGFzaA"} {
+			_, err := VerifyPassword("password", hash)
+			assert.ErrorIs(t, err, ErrInvalidPasswordHash, hash)
+		}
+	})
+
+	t.Run("should not accept any password for accounts without one", func(t *testing.T) {
+		assert.False(t, CheckPassword("not-a-real-password", ""))
+		assert.True(t, CheckPassword("correct horse battery", HashPassword("correct horse battery")))
+	})
+}
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	cases := []struct {
+		name     string
+		password string
+		want     error
+	}{
+		{"should accept a reasonable password", "correct horse battery", nil},
+		{"should reject a short password", "short", ErrPasswordTooShort},
+		{"should count characters rather than bytes", "ééééééé", ErrPasswordTooShort},
+		{"should reject a very long password", strings.Repeat("a", MaxPasswordLength+1), ErrPasswordTooLong},
+		{"should reject the email address", "Jane@Example.com", ErrPasswordMatchesEmail},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, CheckPasswordPolicy(tc.password, "jane@example.com"))
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/providers/bitbucket"
+	"github.com/markbates/goth/providers/discord"
+	"github.com/markbates/goth/providers/facebook"
+	"github.com/markbates/goth/providers/github"
+	"github.com/markbates/goth/providers/gitlab"
+	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/linkedin"
+	"github.com/markbates/goth/providers/microsoftonline"
+	"github.com/markbates/goth/providers/slack"
+	"github.com/markbates/goth/providers/twitch"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+// ProviderInfo describes an enabled login provider to API clients.
+type ProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	AuthURL     string `json:"auth_url"`
+}
+
+// providerConfig describes a goth provider that is enabled when both
+// <EnvPrefix>_CLIENT_ID and <EnvPrefix>_CLIENT_SECRET are set.
+type providerConfig struct {
+	Name        string
+	DisplayName string
+	EnvPrefix   string
+	New         func(key, secret, callbackURL string) goth.Provider
+}
+
+// registry lists every provider that can be enabled through configuration.
+// To support another goth provider, add an entry here.
+var registry = []providerConfig{
+	{
+		Name: "google", DisplayName: "Google", EnvPrefix: "GOOGLE",
+		New: func(key, secret, callbackURL string) goth.Provider {
+			return google.New(key, secret, callbackURL)
+		},
+	},
+	{
+		Name: "github", DisplayName: "GitHub", EnvPrefix: "GITHUB",
+		New: func(key, secret, callbackURL string) goth.Provider {
+			return github.New(key, secret, callbackURL, "read:user", "user:email")
+		},
+	},
+	{
+		Name: "gitlab", DisplayName: "GitLab", EnvPrefix: "GITLAB",
+		New: func(key, secret, callbackURL string) goth.Provider {
+			return gitlab.New(key, secret, callbackURL)
+		},
+	},
+	{
+		Name: "facebook", DisplayName: "Facebook", EnvPrefix: "FACEBOOK",
+		New: func(key, secret, callbackURL string) goth.Provider {
+			return facebook.New(key, secret, callbackURL)
+		},
+	},
+	{
+		Name: "discord", DisplayName: "Discord", EnvPrefix: "DISCORD",
+		New: func(key, secret, callbackURL string) goth.Provider {
+			return discord.New(key, secret, callbackURL, discord.ScopeIdentify, discord.ScopeEmail)
+		},
+	},
+	{
+		Name: "microsoftonline", DisplayName: "Microsoft", EnvPrefix: "MICROSOFT",
+		New: func(key, secret, callbackURL string) goth.Provider {
+			return microsoftonline.New(key, secret, callbackURL)
+		},
+	},
+	{
+		Name: "linkedin", DisplayName: "LinkedIn", EnvPrefix: "LINKEDIN",
+		New: func(key, secret, callbackURL string) goth.Provider {
+			return linkedin.New(key, secret, callbackURL)
+		},
+	},
+	{
+		Name: "slack", DisplayName: "Slack", EnvPrefix: "SLACK",
+		New: func(key, secret, callbackURL string) goth.Provider {
+			return slack.New(key, secret, callbackURL)
+		},
+	},
+	{
+		Name: "twitch", DisplayName: "Twitch", EnvPrefix: "TWITCH",
+		New: func(key, secret, callbackURL string) goth.Provider {
+			return twitch.New(key, secret, callbackURL, twitch.ScopeUserReadEmail)
+		},
+	},
+	{
+		Name: "bitbucket", DisplayName: "Bitbucket", EnvPrefix: "BITBUCKET",
+		New: func(key, secret, callbackURL string) goth.Provider {
+			return bitbucket.New(key, secret, callbackURL)
+		},
+	},
+}
+
+// configuredProviders builds every registry provider with credentials in
+// clients, with callbacks under backendURI.
+func configuredProviders(backendURI string, clients map[string]config.OAuthClient) []goth.Provider {
+	backendURI = strings.TrimRight(backendURI, "/")
+
+	var providers []goth.Provider
+	for _, p := range registry {
+		client, ok := clients[p.EnvPrefix]
+		if !ok || client.ClientID == "" || client.ClientSecret == "" {
+			continue
+		}
+		callbackURL := backendURI + "/auth/" + p.Name + "/callback"
+		providers = append(providers, p.New(client.ClientID, client.ClientSecret, callbackURL))
+	}
+	return providers
+}
+
+// Providers returns the registry providers that are currently enabled, in
+// registry order.
+func Providers() []ProviderInfo {
+	enabled := goth.GetProviders()
+
+	providers := []ProviderInfo{}
+	for _, p := range registry {
+		if _, ok := enabled[p.Name]; !ok {
+			continue
+		}
+		providers = append(providers, ProviderInfo{
+			Name:        p.Name,
+			DisplayName: p.DisplayName,
+			AuthURL:     "/auth/" + p.Name,
+		})
+	}
+	return providers
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/markbates/goth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+func TestConfiguredProviders(t *testing.T) {
+	t.Run("should only enable providers with both credentials set", func(t *testing.T) {
+		providers := configuredProviders("http://localhost:3000", map[string]config.OAuthClient{
+			"GOOGLE": {ClientID: "google_id", ClientSecret: "google_secret"},
+			"GITHUB": {ClientID: "github_id"},
+		})
+
+		require.Len(t, providers, 1)
+		assert.Equal(t, "google", providers[0].Name())
+	})
+
+	t.Run("should build callback URLs from the backend URI", func(t *testing.T) {
+		providers := configuredProviders("https://api.example.com/", map[string]config.OAuthClient{
+			"DISCORD": {ClientID: "discord_id", ClientSecret: "discord_secret"},
+		})
+
+		var discord goth.Provider
+		for _, p := range providers {
+			if p.Name() == "discord" {
+				discord = p
+			}
+		}
+		require.NotNil(t, discord)
+
+		sess, err := discord.BeginAuth("state")
+		require.NoError(t, err)
+		authURL, err := sess.GetAuthURL()
+		require.NoError(t, err)
+		assert.Contains(t, authURL, "redirect_uri=https%3A%2F%2Fapi.example.com%2Fauth%2Fdiscord%2Fcallback")
+	})
+}
+
+func TestProviders(t *testing.T) {
+	t.Run("should list enabled providers in registry order", func(t *testing.T) {
+		goth.ClearProviders()
+		defer goth.ClearProviders()
+		goth.UseProviders(configuredProviders("http://localhost:3000", map[string]config.OAuthClient{
+			"GITHUB": {ClientID: "github_id", ClientSecret: "github_secret"},
+			"GOOGLE": {ClientID: "google_id", ClientSecret: "google_secret"},
+		})...)
+
+		providers := Providers()
+
+		require.Len(t, providers, 2)
+		assert.Equal(t, ProviderInfo{Name: "google", DisplayName: "Google", AuthURL: "/auth/google"}, providers[0])
+		assert.Equal(t, ProviderInfo{Name: "github", DisplayName: "GitHub", AuthURL: "/auth/github"}, providers[1])
+	})
+
+	t.Run("should return an empty list when nothing is configured", func(t *testing.T) {
+		goth.ClearProviders()
+
+		providers := Providers()
+
+		assert.NotNil(t, providers)
+		assert.Empty(t, providers)
+	})
+}
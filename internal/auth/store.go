@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// touchInterval limits how often reading a session records activity on it.
+const touchInterval = time.Minute
+
+// PGStore is a sessions.Store that keeps session values in Postgres. The
+// cookie only carries the signed session ID, so sessions can be revoked on
+// the server.
+type PGStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options // default configuration
+
+	db         database.SessionRepository
+	serializer securecookie.GobEncoder
+}
+
+// NewPGStore returns a store that persists sessions through db. Key pairs
+// sign (and optionally encrypt) the session ID cookie, as with
+// sessions.NewCookieStore.
+func NewPGStore(db database.SessionRepository, keyPairs ...[]byte) *PGStore {
+	s := &PGStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: MaxAge,
+		},
+		db: db,
+	}
+
+	s.MaxAge(s.Options.MaxAge)
+	return s
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *PGStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the
+// registry. A missing or expired session yields a new, empty session.
+func (s *PGStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var id string
+	if err := securecookie.DecodeMulti(name, c.Value, &id, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	stored, err := s.db.GetSession(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if err := s.serializer.Deserialize(stored.Data, &session.Values); err != nil {
+		return session, err
+	}
+	session.ID = id
+	session.IsNew = false
+
+	if time.Since(stored.LastSeenAt) > touchInterval {
+		if err := s.db.TouchSession(r.Context(), id, clientIP(r), r.UserAgent()); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to record session activity", "error", err)
+		}
+	}
+	return session, nil
+}
+
+// Save persists the session and writes the session ID cookie. A negative
+// MaxAge deletes the session row and expires the cookie.
+func (s *PGStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.db.DeleteSession(r.Context(), session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = newSessionID()
+	}
+
+	data, err := s.serializer.Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+
+	userID, _ := session.Values[SessionUserIDKey].(string)
+	provider, _ := session.Values[SessionProviderKey].(string)
+	err = s.db.SaveSession(r.Context(), &database.Session{
+		ID:        session.ID,
+		UserID:    userID,
+		Provider:  provider,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Data:      data,
+		ExpiresAt: s.expiresAt(session),
+	})
+	if err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Delete revokes a session on the server. The browser keeps its cookie,
+// but it no longer resolves to any session.
+func (s *PGStore) Delete(ctx context.Context, id string) error {
+	return s.db.DeleteSession(ctx, id)
+}
+
+// MaxAge sets the maximum age for the store and the underlying cookie
+// codecs. Individual sessions can be deleted by setting Options.MaxAge = -1.
+func (s *PGStore) MaxAge(age int) {
+	s.Options.MaxAge = age
+
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+// Cleanup deletes expired sessions every interval until ctx is done.
+func (s *PGStore) Cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.db.DeleteExpiredSessions(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to clean up sessions", "error", err)
+				continue
+			}
+			if n > 0 {
+				slog.InfoContext(ctx, "Removed expired sessions", "count", n)
+			}
+		}
+	}
+}
+
+// expiresAt returns when the stored session should expire. Browser-session
+// cookies (MaxAge 0) still expire on the server after the store's MaxAge.
+func (s *PGStore) expiresAt(session *sessions.Session) time.Time {
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.Options.MaxAge
+	}
+	return time.Now().Add(time.Duration(age) * time.Second)
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func newSessionID() string {
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+}
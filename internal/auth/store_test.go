@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// memorySessions is an in-memory database.SessionRepository.
+type memorySessions struct {
+	mu       sync.Mutex
+	sessions map[string]database.Session
+}
+
+func newMemorySessions() *memorySessions {
+	return &memorySessions{sessions: make(map[string]database.Session)}
+}
+
+func (m *memorySessions) GetSession(ctx context.Context, id string) (*database.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[id]
+	if !ok || !sess.ExpiresAt.After(time.Now()) {
+		return nil, database.ErrNotFound
+	}
+	return &sess, nil
+}
+
+func (m *memorySessions) SaveSession(ctx context.Context, sess *database.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := *sess
+	saved.LastSeenAt = time.Now()
+	m.sessions[sess.ID] = saved
+	return nil
+}
+
+func (m *memorySessions) TouchSession(ctx context.Context, id, ip, userAgent string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sess, ok := m.sessions[id]; ok {
+		sess.LastSeenAt = time.Now()
+		m.sessions[id] = sess
+	}
+	return nil
+}
+
+func (m *memorySessions) DeleteSession(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *memorySessions) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for id, sess := range m.sessions {
+		if !sess.ExpiresAt.After(time.Now()) {
+			delete(m.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memorySessions) ListUserSessions(ctx context.Context, userID string) ([]database.Session, error) {
+	return nil, nil
+}
+
+func (m *memorySessions) DeleteUserSession(ctx context.Context, userID, publicID string) error {
+	return nil
+}
+
+func (m *memorySessions) DeleteUserSessionsExcept(ctx context.Context, userID, keepID string) (int64, error) {
+	return 0, nil
+}
+
+// saveTestSession stores value under "key" in a new session and returns
+// the resulting cookies and session ID.
+func saveTestSession(t *testing.T, store *PGStore, value string) ([]*http.Cookie, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	session, err := store.Get(req, SessionName)
+	require.NoError(t, err)
+	session.Values["key"] = value
+	require.NoError(t, session.Save(req, w))
+
+	return w.Result().Cookies(), session.ID
+}
+
+func requestWithCookies(cookies []*http.Cookie) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func TestPGStore(t *testing.T) {
+	t.Run("should persist values server-side and only send the ID", func(t *testing.T) {
+		db := newMemorySessions()
+		store := NewPGStore(db, []byte("test-key"))
+
+		cookies, id := saveTestSession(t, store, "secret-value")
+
+		require.Len(t, cookies, 1)
+		assert.Equal(t, SessionName, cookies[0].Name)
+		assert.NotContains(t, cookies[0].Value, "secret-value")
+		assert.Contains(t, db.sessions, id)
+		assert.WithinDuration(t, time.Now().Add(MaxAge*time.Second), db.sessions[id].ExpiresAt, time.Minute)
+	})
+
+	t.Run("should record the user, provider and client of the session", func(t *testing.T) {
+		db := newMemorySessions()
+		store := NewPGStore(db, []byte("test-key"))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:51234"
+		req.Header.Set("User-Agent", "test-agent")
+		session, err := store.Get(req, SessionName)
+		require.NoError(t, err)
+		session.Values[SessionUserIDKey] = "user-1"
+		session.Values[SessionProviderKey] = "google"
+		require.NoError(t, session.Save(req, httptest.NewRecorder()))
+
+		stored := db.sessions[session.ID]
+		assert.Equal(t, "user-1", stored.UserID)
+		assert.Equal(t, "google", stored.Provider)
+		assert.Equal(t, "203.0.113.7", stored.IP)
+		assert.Equal(t, "test-agent", stored.UserAgent)
+	})
+
+	t.Run("should load values from the stored session", func(t *testing.T) {
+		store := NewPGStore(newMemorySessions(), []byte("test-key"))
+		cookies, id := saveTestSession(t, store, "value")
+
+		session, err := store.Get(requestWithCookies(cookies), SessionName)
+
+		require.NoError(t, err)
+		assert.False(t, session.IsNew)
+		assert.Equal(t, id, session.ID)
+		assert.Equal(t, "value", session.Values["key"])
+	})
+
+	t.Run("should delete the session when MaxAge is negative", func(t *testing.T) {
+		db := newMemorySessions()
+		store := NewPGStore(db, []byte("test-key"))
+		cookies, id := saveTestSession(t, store, "value")
+
+		req := requestWithCookies(cookies)
+		w := httptest.NewRecorder()
+		session, err := store.Get(req, SessionName)
+		require.NoError(t, err)
+		session.Options.MaxAge = -1
+		require.NoError(t, session.Save(req, w))
+
+		assert.NotContains(t, db.sessions, id)
+		require.Len(t, w.Result().Cookies(), 1)
+		assert.Equal(t, -1, w.Result().Cookies()[0].MaxAge)
+	})
+
+	t.Run("should start a new session after server-side revocation", func(t *testing.T) {
+		store := NewPGStore(newMemorySessions(), []byte("test-key"))
+		cookies, id := saveTestSession(t, store, "value")
+
+		require.NoError(t, store.Delete(context.Background(), id))
+
+		session, err := store.Get(requestWithCookies(cookies), SessionName)
+		require.NoError(t, err)
+		assert.True(t, session.IsNew)
+		assert.Empty(t, session.Values)
+	})
+
+	t.Run("should reject cookies signed with another key", func(t *testing.T) {
+		db := newMemorySessions()
+		cookies, _ := saveTestSession(t, NewPGStore(db, []byte("other-key")), "value")
+
+		session, err := NewPGStore(db, []byte("test-key")).Get(requestWithCookies(cookies), SessionName)
+
+		assert.Error(t, err)
+		assert.True(t, session.IsNew)
+	})
+
+	t.Run("cleanup should remove expired sessions", func(t *testing.T) {
+		db := newMemorySessions()
+		store := NewPGStore(db, []byte("test-key"))
+		db.sessions["expired"] = database.Session{ID: "expired", ExpiresAt: time.Now().Add(-time.Minute)}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go store.Cleanup(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		assert.Eventually(t, func() bool {
+			db.mu.Lock()
+			defer db.mu.Unlock()
+			_, ok := db.sessions["expired"]
+			return !ok
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestCookieKeyRotation(t *testing.T) {
+	oldKey := config.CookieKey{HashKey: []byte("legacy-signing-only-key")}
+	newKey := GenerateCookieKey()
+
+	t.Run("should generate full-length keys", func(t *testing.T) {
+		assert.Len(t, newKey.HashKey, config.CookieHashKeyLength)
+		assert.Len(t, newKey.EncryptionKey, config.CookieEncryptionKeyLength)
+		assert.NotEqual(t, newKey.HashKey, GenerateCookieKey().HashKey)
+	})
+
+	t.Run("should keep accepting cookies signed with an older key", func(t *testing.T) {
+		db := newMemorySessions()
+		before := NewPGStore(db, cookieKeyPairs([]config.CookieKey{oldKey})...)
+		after := NewPGStore(db, cookieKeyPairs([]config.CookieKey{newKey, oldKey})...)
+
+		cookies, id := saveTestSession(t, before, "value")
+
+		session, err := after.New(requestWithCookies(cookies), SessionName)
+		require.NoError(t, err)
+		assert.Equal(t, id, session.ID)
+	})
+
+	t.Run("should write new cookies with the newest key", func(t *testing.T) {
+		db := newMemorySessions()
+		rotated := NewPGStore(db, cookieKeyPairs([]config.CookieKey{newKey, oldKey})...)
+		newOnly := NewPGStore(db, cookieKeyPairs([]config.CookieKey{newKey})...)
+		oldOnly := NewPGStore(db, cookieKeyPairs([]config.CookieKey{oldKey})...)
+
+		cookies, id := saveTestSession(t, rotated, "value")
+
+		session, err := newOnly.New(requestWithCookies(cookies), SessionName)
+		require.NoError(t, err)
+		assert.Equal(t, id, session.ID)
+
+		_, err = oldOnly.New(requestWithCookies(cookies), SessionName)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+// GenerateToken returns a new random opaque token, such as a refresh
+// token, and the hash under which it should be stored. Only the hash is
+// persisted; the token itself is handed to the client once.
+func GenerateToken() (string, []byte) {
+	token := base64.RawURLEncoding.EncodeToString(randomBytes(32))
+	return token, HashToken(token)
+}
+
+// HashToken returns the storage hash of an opaque token. Tokens carry 256
+// bits of entropy, so a fast unsalted hash is sufficient.
+func HashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// GenerateCookieKey returns a new random key pair for COOKIE_STORE_KEYS.
+func GenerateCookieKey() config.CookieKey {
+	return config.CookieKey{
+		HashKey:       randomBytes(config.CookieHashKeyLength),
+		EncryptionKey: randomBytes(config.CookieEncryptionKeyLength),
+	}
+}
+
+// cookieKeyPairs flattens keys into the hash and encryption key pairs
+// taken by securecookie.CodecsFromPairs. Cookies are encoded with the
+// first pair and decoded with whichever pair accepts them.
+func cookieKeyPairs(keys []config.CookieKey) [][]byte {
+	pairs := make([][]byte, 0, 2*len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key.HashKey, key.EncryptionKey)
+	}
+	return pairs
+}
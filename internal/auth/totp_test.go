@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B test secret for SHA-1.
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	t.Run("should match the RFC 6238 test vectors", func(t *testing.T) {
+		cases := []struct {
+			unix int64
+			code string
+		}{
+			{59, "287082"},
+			{1111111109, "081804"},
+			{1234567890, "005924"},
+			{2000000000, "279037"},
+		}
+
+		for _, tc := range cases {
+			step, ok := ValidateTOTP(secret, tc.code, time.Unix(tc.unix, 0))
+			assert.True(t, ok, tc.code)
+			assert.Equal(t, tc.unix/30, step)
+		}
+	})
+
+	t.Run("should generate the current code", func(t *testing.T) {
+		code, err := TOTPCode(secret, time.Unix(1111111109, 0))
+		require.NoError(t, err)
+		assert.Equal(t, "081804", code)
+	})
+
+	t.Run("should accept codes one step either side", func(t *testing.T) {
+		at := time.Unix(59, 0)
+
+		_, ok := ValidateTOTP(secret, "287082", at.Add(30*time.Second))
+		assert.True(t, ok)
+		_, ok = ValidateTOTP(secret, "287082", at.Add(-30*time.Second))
+		assert.True(t, ok)
+		_, ok = ValidateTOTP(secret, "287082", at.Add(90*time.Second))
+		assert.False(t, ok)
+	})
+
+	t.Run("should reject malformed input", func(t *testing.T) {
+		for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+			_, ok := ValidateTOTP(secret, code, time.Unix(59, 0))
+			assert.False(t, ok, code)
+		}
+		_, ok := ValidateTOTP("not base32!", "287082", time.Unix(59, 0))
+		assert.False(t, ok)
+	})
+
+	t.Run("should generate distinct secrets", func(t *testing.T) {
+		a, b := GenerateTOTPSecret(), GenerateTOTPSecret()
+		assert.Len(t, a, 32)
+		assert.NotEqual(t, a, b)
+	})
+
+	t.Run("should build an otpauth URI", func(t *testing.T) {
+		uri, err := url.Parse(TOTPURI("SECRET", "Acme", "jane@example.com"))
+		require.NoError(t, err)
+
+		assert.Equal(t, "otpauth", uri.Scheme)
+		assert.Equal(t, "totp", uri.Host)
+		assert.Equal(t, "/Acme:jane@example.com", uri.Path)
+		assert.Equal(t, "SECRET", uri.Query().Get("secret"))
+		assert.Equal(t, "Acme", uri.Query().Get("issuer"))
+	})
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	t.Run("should hash codes regardless of formatting", func(t *testing.T) {
+		codes, hashes := GenerateRecoveryCodes()
+		require.Len(t, codes, recoveryCodeCount)
+		require.Len(t, hashes, recoveryCodeCount)
+
+		assert.Regexp(t, `^[a-z2-7]{4}-[a-z2-7]{4}$`, codes[0])
+		assert.Equal(t, hashes[0], HashRecoveryCode(codes[0]))
+		assert.Equal(t, hashes[0], HashRecoveryCode(" "+codes[0][:4]+codes[0][5:]+" "))
+		assert.NotEqual(t, hashes[0], hashes[1])
+	})
+}
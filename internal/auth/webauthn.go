@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+const (
+	// SessionWebAuthnRegistrationKey, SessionWebAuthnLoginKey and
+	// SessionWebAuthnVerifyKey hold the JSON-encoded challenge of a
+	// WebAuthn ceremony in progress.
+	SessionWebAuthnRegistrationKey = "webauthn_registration"
+	SessionWebAuthnLoginKey        = "webauthn_login"
+	SessionWebAuthnVerifyKey       = "webauthn_verify"
+
+	// SessionWebAuthnVerifiedKey holds the Unix time the signed-in user
+	// last proved they hold one of their passkeys.
+	SessionWebAuthnVerifiedKey = "webauthn_verified"
+
+	// WebAuthnProvider is the provider name recorded on sessions started
+	// with a passkey.
+	WebAuthnProvider = "webauthn"
+)
+
+// NewWebAuthnFromConfig configures the WebAuthn relying party. Passkeys
+// are used from the frontend, so the RP ID defaults to the host of APP_URI
+// and can be set to a parent domain with WEBAUTHN_RP_ID. Ceremonies are
+// accepted from the APP_URI and BACKEND_URI origins. It returns nil when
+// APP_URI is not set.
+func NewWebAuthnFromConfig(cfg *config.Config) (*webauthn.WebAuthn, error) {
+	if cfg.AppURI == "" {
+		return nil, nil
+	}
+
+	var origins []string
+	for _, raw := range []string{cfg.AppURI, cfg.BackendURI} {
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("auth: invalid URL %q for WebAuthn origin", raw)
+		}
+		origins = append(origins, u.Scheme+"://"+u.Host)
+	}
+
+	rpID := cfg.WebAuthn.RPID
+	if rpID == "" {
+		u, _ := url.Parse(cfg.AppURI)
+		rpID = u.Hostname()
+	}
+
+	rpName := cfg.WebAuthn.RPName
+	if rpName == "" {
+		rpName = "Auth Starter"
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: rpName,
+		RPOrigins:     origins,
+	})
+}
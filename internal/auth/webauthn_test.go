@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+func TestNewWebAuthnFromConfig(t *testing.T) {
+	t.Run("should derive the RP ID and origins from the app and backend URLs", func(t *testing.T) {
+		w, err := NewWebAuthnFromConfig(&config.Config{
+			AppURI:     "https://app.example.com/home",
+			BackendURI: "https://api.example.com",
+		})
+		require.NoError(t, err)
+		require.NotNil(t, w)
+
+		assert.Equal(t, "app.example.com", w.Config.RPID)
+		assert.Equal(t, []string{"https://app.example.com", "https://api.example.com"}, w.Config.RPOrigins)
+	})
+
+	t.Run("should allow a parent domain as the RP ID", func(t *testing.T) {
+		w, err := NewWebAuthnFromConfig(&config.Config{
+			AppURI:   "https://app.example.com",
+			WebAuthn: config.WebAuthn{RPID: "example.com"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "example.com", w.Config.RPID)
+	})
+
+	t.Run("should be disabled without APP_URI", func(t *testing.T) {
+		w, err := NewWebAuthnFromConfig(&config.Config{BackendURI: "https://api.example.com"})
+		require.NoError(t, err)
+		assert.Nil(t, w)
+	})
+
+	t.Run("should reject an invalid URL", func(t *testing.T) {
+		_, err := NewWebAuthnFromConfig(&config.Config{AppURI: "not a url"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,361 @@
+// Package config loads the application's settings once at startup into a
+// typed Config. Values come from the process environment, then an optional
+// settings file, then .env; the first source that sets a variable wins.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Environments accepted in APP_ENV. Production turns on secure cookies,
+// HSTS and strict CORS, hides error details from clients, and refuses
+// weak secrets.
+const (
+	EnvLocal       = "local"
+	EnvDevelopment = "development"
+	EnvTest        = "test"
+	EnvStaging     = "staging"
+	EnvProduction  = "production"
+)
+
+// MinSecretLength is the shortest cookie or JWT signing secret accepted in
+// production.
+const MinSecretLength = 32
+
+// Config holds every setting of the API server.
+type Config struct {
+	// Env is the deployment environment, one of the Env* constants.
+	Env  string
+	Port int
+
+	// BackendURI is where this API is reachable, and AppURI the frontend
+	// users are sent back to after signing in.
+	BackendURI string
+	AppURI     string
+
+	// PostLogoutRedirectURL is where logging out sends the browser.
+	PostLogoutRedirectURL string
+
+	// PasswordResetURL is the frontend page that collects the new password
+	// and posts it with the token to /auth/password/reset.
+	PasswordResetURL string
+
+	// MFARedirectURL is the frontend page OAuth and magic-link logins are
+	// sent to when the user still has to enter their second factor.
+	MFARedirectURL string
+
+	// InvitationRedirectURL is the frontend page where someone who opened
+	// an invitation link while signed out can sign in or sign up.
+	InvitationRedirectURL string
+
+	CORSAllowedOrigins []string
+
+	// TrustedProxies are the addresses of proxies in front of the API.
+	// Only requests from them have their client address taken from
+	// X-Forwarded-For; everyone else is identified by the connection.
+	TrustedProxies []netip.Prefix
+
+	// CookieKeys sign and encrypt session cookies, newest first. New
+	// cookies use the first key; the others still decode older cookies.
+	CookieKeys []CookieKey
+
+	// AutoLinkVerifiedEmails lets an OAuth login join the existing account
+	// with the same email address when both sides have verified it.
+	AutoLinkVerifiedEmails bool
+
+	MagicLinkTTL  time.Duration
+	InvitationTTL time.Duration
+
+	// TOTPIssuer is the name shown for this service in authenticator apps.
+	TOTPIssuer string
+
+	// RateLimitStore is "memory", "postgres" or "none".
+	RateLimitStore string
+
+	Log      Log
+	Database Database
+	JWT      JWT
+	WebAuthn WebAuthn
+	Mail     Mail
+
+	// OAuth holds the credentials of each OAuth provider that has both
+	// <PREFIX>_CLIENT_ID and <PREFIX>_CLIENT_SECRET set, by prefix.
+	OAuth map[string]OAuthClient
+}
+
+// Log configures the application log.
+type Log struct {
+	// Format is "text" or "json".
+	Format string
+	Level  slog.Level
+}
+
+// Database configures the Postgres connection.
+type Database struct {
+	Host     string
+	Port     string
+	Name     string
+	Username string
+	Password string
+	Schema   string
+
+	// AutoMigrate applies pending migrations when the API starts.
+	AutoMigrate bool
+}
+
+// JWT configures access and refresh tokens for clients that cannot use
+// cookies.
+type JWT struct {
+	Enabled bool
+
+	// Algorithm is the JWS signing algorithm. HMAC algorithms sign with
+	// SigningKey; the others with the PEM key in PrivateKeyFile, or an
+	// ephemeral key when it is empty.
+	Algorithm      string
+	SigningKey     string
+	PrivateKeyFile string
+
+	Issuer   string
+	Audience string
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// WebAuthn configures the passkey relying party.
+type WebAuthn struct {
+	// RPID defaults to the host of AppURI when empty.
+	RPID   string
+	RPName string
+}
+
+// Mail configures outgoing email.
+type Mail struct {
+	// Driver is "smtp" or "log".
+	Driver string
+	From   string
+
+	// LogFile receives messages from the log driver; stdout when empty.
+	LogFile string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// OAuthClient holds the credentials of an OAuth application.
+type OAuthClient struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// Load reads the configuration from the environment, the optional file at
+// path and .env, and validates it. The error lists every problem found.
+func Load(path string) (*Config, error) {
+	vars, err := readVars(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(vars)
+}
+
+// LoadDatabase is Load for tools that only need the database connection.
+func LoadDatabase(path string) (Database, error) {
+	vars, err := readVars(path)
+	if err != nil {
+		return Database{}, err
+	}
+	l := &loader{vars: vars}
+	db := l.database()
+	return db, l.err()
+}
+
+// readVars merges the variables from .env, the file at path and the
+// environment, later sources taking precedence. A missing .env is ignored.
+func readVars(path string) (map[string]string, error) {
+	vars, err := godotenv.Read()
+	if errors.Is(err, os.ErrNotExist) {
+		vars = map[string]string{}
+	} else if err != nil {
+		return nil, fmt.Errorf("config: read .env: %w", err)
+	}
+
+	if path != "" {
+		file, err := godotenv.Read(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: read %s: %w", path, err)
+		}
+		for k, v := range file {
+			vars[k] = v
+		}
+	}
+
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+	return vars, nil
+}
+
+// parse builds a Config from vars.
+func parse(vars map[string]string) (*Config, error) {
+	l := &loader{vars: vars}
+
+	cfg := &Config{
+		Env:        l.oneOf("APP_ENV", EnvLocal, EnvDevelopment, EnvTest, EnvStaging, EnvProduction),
+		Port:       l.port("PORT"),
+		BackendURI: strings.TrimRight(l.url("BACKEND_URI", true), "/"),
+		AppURI:     strings.TrimRight(l.url("APP_URI", false), "/"),
+
+		CORSAllowedOrigins: l.list("CORS_ALLOWED_ORIGINS"),
+		TrustedProxies:     l.prefixes("TRUSTED_PROXIES"),
+		CookieKeys:         l.cookieKeys(),
+
+		AutoLinkVerifiedEmails: l.bool("AUTO_LINK_VERIFIED_EMAILS", false),
+		MagicLinkTTL:           l.duration("MAGIC_LINK_TTL", 15*time.Minute),
+		InvitationTTL:          l.duration("INVITATION_TTL", 7*24*time.Hour),
+		TOTPIssuer:             l.string("TOTP_ISSUER", "Auth Starter"),
+		RateLimitStore:         l.oneOf("RATE_LIMIT_STORE", "memory", "postgres", "none"),
+
+		Log:      l.log(),
+		Database: l.database(),
+		WebAuthn: WebAuthn{
+			RPID:   l.string("WEBAUTHN_RP_ID", ""),
+			RPName: l.string("WEBAUTHN_RP_NAME", "Auth Starter"),
+		},
+		OAuth: l.oauth(),
+	}
+
+	cfg.PostLogoutRedirectURL = l.urlOr("POST_LOGOUT_REDIRECT_URL", cfg.AppURI)
+	cfg.PasswordResetURL = l.urlOr("PASSWORD_RESET_URL", cfg.AppURI+"/reset-password")
+	cfg.MFARedirectURL = l.urlOr("MFA_REDIRECT_URL", cfg.AppURI+"/mfa")
+	cfg.InvitationRedirectURL = l.urlOr("INVITATION_REDIRECT_URL", cfg.AppURI+"/login")
+
+	cfg.JWT = l.jwt(cfg.BackendURI)
+	cfg.Mail = l.mail()
+
+	if cfg.Production() {
+		l.production(cfg)
+	}
+
+	if err := l.err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Production reports whether APP_ENV is production.
+func (c *Config) Production() bool {
+	return c.Env == EnvProduction
+}
+
+// production applies the stricter checks of a production deployment.
+func (l *loader) production(cfg *Config) {
+	l.secret("COOKIE_STORE_KEY", l.string("COOKIE_STORE_KEY", ""))
+	if cfg.JWT.Enabled && strings.HasPrefix(cfg.JWT.Algorithm, "HS") {
+		l.secret("JWT_SIGNING_KEY", cfg.JWT.SigningKey)
+	}
+
+	for _, key := range []string{"BACKEND_URI", "APP_URI"} {
+		if uri := l.string(key, ""); uri != "" && !strings.HasPrefix(uri, "https://") {
+			l.problem("%s must use https in production, got %q", key, uri)
+		}
+	}
+
+	for _, origin := range cfg.CORSAllowedOrigins {
+		if strings.Contains(origin, "*") {
+			l.problem("CORS_ALLOWED_ORIGINS must list exact origins in production, got %q", origin)
+		}
+	}
+
+	// The log driver writes live sign-in, reset and invitation links
+	// where anyone who can read the logs could use them.
+	if cfg.Mail.Driver != "smtp" {
+		l.problem("MAIL_DRIVER must be smtp in production, got %q", cfg.Mail.Driver)
+	}
+}
+
+// logLevels maps LOG_LEVEL values to slog levels.
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+func (l *loader) log() Log {
+	return Log{
+		Format: l.oneOf("LOG_FORMAT", "text", "json"),
+		Level:  logLevels[l.oneOf("LOG_LEVEL", "info", "debug", "warn", "error")],
+	}
+}
+
+func (l *loader) database() Database {
+	return Database{
+		Host:        l.required("BLUEPRINT_DB_HOST"),
+		Port:        l.required("BLUEPRINT_DB_PORT"),
+		Name:        l.required("BLUEPRINT_DB_DATABASE"),
+		Username:    l.required("BLUEPRINT_DB_USERNAME"),
+		Password:    l.string("BLUEPRINT_DB_PASSWORD", ""),
+		Schema:      l.string("BLUEPRINT_DB_SCHEMA", "public"),
+		AutoMigrate: l.bool("DB_AUTO_MIGRATE", true),
+	}
+}
+
+func (l *loader) jwt(backendURI string) JWT {
+	cfg := JWT{
+		Enabled:         l.bool("JWT_ENABLED", false),
+		Algorithm:       l.string("JWT_SIGNING_ALG", "RS256"),
+		SigningKey:      l.string("JWT_SIGNING_KEY", ""),
+		PrivateKeyFile:  l.string("JWT_PRIVATE_KEY_FILE", ""),
+		Issuer:          l.string("JWT_ISSUER", backendURI),
+		Audience:        l.string("JWT_AUDIENCE", ""),
+		AccessTokenTTL:  l.duration("JWT_ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: l.duration("JWT_REFRESH_TOKEN_TTL", 30*24*time.Hour),
+	}
+	if cfg.Enabled && strings.HasPrefix(cfg.Algorithm, "HS") && cfg.SigningKey == "" {
+		l.problem("JWT_SIGNING_KEY is required when JWT_SIGNING_ALG is %s", cfg.Algorithm)
+	}
+	return cfg
+}
+
+func (l *loader) mail() Mail {
+	cfg := Mail{
+		Driver:       l.oneOf("MAIL_DRIVER", "log", "smtp"),
+		From:         l.string("MAIL_FROM", "no-reply@localhost"),
+		LogFile:      l.string("MAIL_LOG_FILE", ""),
+		SMTPHost:     l.string("SMTP_HOST", ""),
+		SMTPPort:     l.int("SMTP_PORT", 587),
+		SMTPUsername: l.string("SMTP_USERNAME", ""),
+		SMTPPassword: l.string("SMTP_PASSWORD", ""),
+	}
+	if cfg.Driver == "smtp" && cfg.SMTPHost == "" {
+		l.problem("SMTP_HOST is required when MAIL_DRIVER is smtp")
+	}
+	return cfg
+}
+
+// oauth collects the credentials of every <PREFIX>_CLIENT_ID that has a
+// matching <PREFIX>_CLIENT_SECRET.
+func (l *loader) oauth() map[string]OAuthClient {
+	clients := map[string]OAuthClient{}
+	for k, id := range l.vars {
+		prefix, ok := strings.CutSuffix(k, "_CLIENT_ID")
+		secret := l.vars[prefix+"_CLIENT_SECRET"]
+		if !ok || id == "" || secret == "" {
+			continue
+		}
+		clients[prefix] = OAuthClient{ClientID: id, ClientSecret: secret}
+	}
+	return clients
+}
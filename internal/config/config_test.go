@@ -0,0 +1,329 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// minimal returns the variables every configuration needs.
+func minimal() map[string]string {
+	return map[string]string{
+		"PORT":                  "8080",
+		"BACKEND_URI":           "http://localhost:8080/",
+		"COOKIE_STORE_KEY":      "cookie-secret",
+		"BLUEPRINT_DB_HOST":     "localhost",
+		"BLUEPRINT_DB_PORT":     "5432",
+		"BLUEPRINT_DB_DATABASE": "auth",
+		"BLUEPRINT_DB_USERNAME": "postgres",
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Run("should apply defaults", func(t *testing.T) {
+		vars := minimal()
+		vars["APP_URI"] = "http://localhost:5173"
+
+		cfg, err := parse(vars)
+		require.NoError(t, err)
+
+		assert.Equal(t, "local", cfg.Env)
+		assert.Equal(t, 8080, cfg.Port)
+		assert.Equal(t, "http://localhost:8080", cfg.BackendURI)
+		assert.Equal(t, "http://localhost:5173", cfg.PostLogoutRedirectURL)
+		assert.Equal(t, "http://localhost:5173/reset-password", cfg.PasswordResetURL)
+		assert.Equal(t, "http://localhost:5173/mfa", cfg.MFARedirectURL)
+		assert.Equal(t, "http://localhost:5173/login", cfg.InvitationRedirectURL)
+		assert.Equal(t, 15*time.Minute, cfg.MagicLinkTTL)
+		assert.Equal(t, 7*24*time.Hour, cfg.InvitationTTL)
+		assert.Equal(t, "memory", cfg.RateLimitStore)
+		assert.Equal(t, Log{Format: "text", Level: slog.LevelInfo}, cfg.Log)
+		assert.Equal(t, "public", cfg.Database.Schema)
+		assert.True(t, cfg.Database.AutoMigrate)
+		assert.Equal(t, "http://localhost:8080", cfg.JWT.Issuer)
+		assert.Equal(t, "log", cfg.Mail.Driver)
+		assert.Equal(t, 587, cfg.Mail.SMTPPort)
+	})
+
+	t.Run("should read typed values", func(t *testing.T) {
+		vars := minimal()
+		vars["CORS_ALLOWED_ORIGINS"] = " http://a.example.com, ,http://b.example.com"
+		vars["AUTO_LINK_VERIFIED_EMAILS"] = "true"
+		vars["MAGIC_LINK_TTL"] = "5m"
+		vars["DB_AUTO_MIGRATE"] = "false"
+		vars["JWT_ENABLED"] = "true"
+		vars["JWT_SIGNING_ALG"] = "HS256"
+		vars["JWT_SIGNING_KEY"] = "jwt-secret"
+		vars["LOG_FORMAT"] = "json"
+		vars["LOG_LEVEL"] = "debug"
+		vars["TRUSTED_PROXIES"] = "10.0.0.0/8, 192.168.1.7,fd00::1/64"
+
+		cfg, err := parse(vars)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"http://a.example.com", "http://b.example.com"}, cfg.CORSAllowedOrigins)
+		assert.True(t, cfg.AutoLinkVerifiedEmails)
+		assert.Equal(t, 5*time.Minute, cfg.MagicLinkTTL)
+		assert.False(t, cfg.Database.AutoMigrate)
+		assert.True(t, cfg.JWT.Enabled)
+		assert.Equal(t, "jwt-secret", cfg.JWT.SigningKey)
+		assert.Equal(t, Log{Format: "json", Level: slog.LevelDebug}, cfg.Log)
+		assert.Equal(t, []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("192.168.1.7/32"),
+			netip.MustParsePrefix("fd00::/64"),
+		}, cfg.TrustedProxies)
+	})
+
+	t.Run("should collect OAuth clients with both credentials", func(t *testing.T) {
+		vars := minimal()
+		vars["GOOGLE_CLIENT_ID"] = "google-id"
+		vars["GOOGLE_CLIENT_SECRET"] = "google-secret"
+		vars["GITHUB_CLIENT_ID"] = "github-id"
+
+		cfg, err := parse(vars)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]OAuthClient{
+			"GOOGLE": {ClientID: "google-id", ClientSecret: "google-secret"},
+		}, cfg.OAuth)
+	})
+
+	t.Run("should report every problem at once", func(t *testing.T) {
+		vars := minimal()
+		delete(vars, "COOKIE_STORE_KEY")
+		vars["PORT"] = "invalid"
+		vars["BACKEND_URI"] = "localhost:8080"
+		vars["MAGIC_LINK_TTL"] = "-1m"
+		vars["RATE_LIMIT_STORE"] = "redis"
+		vars["MAIL_DRIVER"] = "smtp"
+		vars["LOG_LEVEL"] = "verbose"
+		vars["TRUSTED_PROXIES"] = "10.0.0.0/8,proxy.internal"
+
+		_, err := parse(vars)
+		require.Error(t, err)
+
+		for _, want := range []string{
+			"COOKIE_STORE_KEYS or COOKIE_STORE_KEY is required",
+			"PORT must be a whole number",
+			"BACKEND_URI must be an absolute http or https URL",
+			"MAGIC_LINK_TTL must be a positive duration",
+			"RATE_LIMIT_STORE must be one of memory, postgres, none",
+			"SMTP_HOST is required when MAIL_DRIVER is smtp",
+			"LOG_LEVEL must be one of info, debug, warn, error",
+			`TRUSTED_PROXIES must list IP addresses or CIDR ranges, got "proxy.internal"`,
+		} {
+			assert.Contains(t, err.Error(), want)
+		}
+	})
+
+	t.Run("should reject ports out of range", func(t *testing.T) {
+		for _, port := range []string{"", "0", "70000"} {
+			vars := minimal()
+			vars["PORT"] = port
+
+			_, err := parse(vars)
+			assert.ErrorContains(t, err, "PORT", port)
+		}
+	})
+
+	t.Run("should require a signing key for HMAC tokens", func(t *testing.T) {
+		vars := minimal()
+		vars["JWT_ENABLED"] = "true"
+		vars["JWT_SIGNING_ALG"] = "HS256"
+
+		_, err := parse(vars)
+		assert.ErrorContains(t, err, "JWT_SIGNING_KEY is required")
+	})
+}
+
+func TestCookieKeys(t *testing.T) {
+	newKey := CookieKey{HashKey: bytes.Repeat([]byte{1}, CookieHashKeyLength), EncryptionKey: bytes.Repeat([]byte{2}, CookieEncryptionKeyLength)}
+	oldKey := CookieKey{HashKey: bytes.Repeat([]byte{3}, MinCookieHashKeyLength)}
+
+	t.Run("should round-trip formatted keys", func(t *testing.T) {
+		vars := minimal()
+		delete(vars, "COOKIE_STORE_KEY")
+		vars["COOKIE_STORE_KEYS"] = FormatCookieKeys([]CookieKey{newKey, oldKey})
+
+		cfg, err := parse(vars)
+		require.NoError(t, err)
+		assert.Equal(t, []CookieKey{newKey, oldKey}, cfg.CookieKeys)
+	})
+
+	t.Run("should accept the legacy key after the list", func(t *testing.T) {
+		vars := minimal()
+		vars["COOKIE_STORE_KEYS"] = FormatCookieKeys([]CookieKey{newKey})
+
+		cfg, err := parse(vars)
+		require.NoError(t, err)
+		require.Len(t, cfg.CookieKeys, 2)
+		assert.Equal(t, newKey, cfg.CookieKeys[0])
+		assert.Equal(t, []byte("cookie-secret"), cfg.CookieKeys[1].HashKey)
+		assert.Empty(t, cfg.CookieKeys[1].EncryptionKey)
+	})
+
+	t.Run("should reject malformed keys without echoing them", func(t *testing.T) {
+		short := base64.StdEncoding.EncodeToString([]byte("too-short-hash-key"))
+		for entry, want := range map[string]string{
+			"not base64!": "entry 1: hash key is not valid base64",
+			short:         "entry 1: hash key must be at least 32 bytes, got 18",
+			FormatCookieKeys([]CookieKey{{HashKey: oldKey.HashKey, EncryptionKey: []byte("12345")}}): "entry 1: encryption key must be 16, 24 or 32 bytes, got 5",
+		} {
+			vars := minimal()
+			vars["COOKIE_STORE_KEYS"] = entry
+
+			_, err := parse(vars)
+			require.ErrorContains(t, err, want)
+			assert.NotContains(t, err.Error(), entry)
+		}
+	})
+
+	t.Run("should read only the list for rotation", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		path := filepath.Join(t.TempDir(), "app.env")
+		content := "COOKIE_STORE_KEY=cookie-secret\nCOOKIE_STORE_KEYS=" + FormatCookieKeys([]CookieKey{newKey, oldKey}) + "\n"
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		keys, err := LoadCookieKeys(path)
+		require.NoError(t, err)
+		assert.Equal(t, []CookieKey{newKey, oldKey}, keys)
+	})
+}
+
+func TestParseProduction(t *testing.T) {
+	production := func() map[string]string {
+		vars := minimal()
+		vars["APP_ENV"] = "production"
+		vars["BACKEND_URI"] = "https://api.example.com"
+		vars["APP_URI"] = "https://app.example.com"
+		vars["COOKIE_STORE_KEY"] = "k7Qz2xR9vLp4Wm8Nc3Ht6Yb1Fd5Gs0Je"
+		vars["MAIL_DRIVER"] = "smtp"
+		vars["SMTP_HOST"] = "smtp.example.com"
+		return vars
+	}
+
+	t.Run("should accept a hardened configuration", func(t *testing.T) {
+		cfg, err := parse(production())
+		require.NoError(t, err)
+		assert.True(t, cfg.Production())
+	})
+
+	t.Run("should reject weak cookie keys", func(t *testing.T) {
+		for key, want := range map[string]string{
+			"randomString":                     "placeholder",
+			"short-but-random":                 "at least 32 characters",
+			"abababababababababababababababab": "too repetitive",
+		} {
+			vars := production()
+			vars["COOKIE_STORE_KEY"] = key
+
+			_, err := parse(vars)
+			assert.ErrorContains(t, err, want, key)
+		}
+	})
+
+	t.Run("should accept weak keys outside production", func(t *testing.T) {
+		vars := production()
+		vars["APP_ENV"] = "staging"
+		vars["COOKIE_STORE_KEY"] = "randomString"
+
+		_, err := parse(vars)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should require https and exact CORS origins", func(t *testing.T) {
+		vars := production()
+		vars["APP_URI"] = "http://app.example.com"
+		vars["CORS_ALLOWED_ORIGINS"] = "https://*.example.com"
+
+		_, err := parse(vars)
+		assert.ErrorContains(t, err, "APP_URI must use https in production")
+		assert.ErrorContains(t, err, "CORS_ALLOWED_ORIGINS must list exact origins")
+	})
+
+	t.Run("should refuse to only log mail", func(t *testing.T) {
+		for _, logFile := range []string{"", "/var/log/mail.log"} {
+			vars := production()
+			vars["MAIL_DRIVER"] = "log"
+			vars["MAIL_LOG_FILE"] = logFile
+
+			_, err := parse(vars)
+			assert.ErrorContains(t, err, `MAIL_DRIVER must be smtp in production, got "log"`)
+		}
+	})
+
+	t.Run("should check HMAC signing keys", func(t *testing.T) {
+		vars := production()
+		vars["JWT_ENABLED"] = "true"
+		vars["JWT_SIGNING_ALG"] = "HS256"
+		vars["JWT_SIGNING_KEY"] = "secret"
+
+		_, err := parse(vars)
+		assert.ErrorContains(t, err, "JWT_SIGNING_KEY is a placeholder")
+	})
+
+	t.Run("should reject unknown environments", func(t *testing.T) {
+		vars := production()
+		vars["APP_ENV"] = "prod"
+
+		_, err := parse(vars)
+		assert.ErrorContains(t, err, "APP_ENV must be one of")
+	})
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("should let the environment override the config file", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+
+		path := filepath.Join(t.TempDir(), "app.env")
+		content := "PORT=3000\nAPP_URI=http://file.example.com\n"
+		for k, v := range minimal() {
+			if k != "PORT" {
+				content += k + "=" + v + "\n"
+			}
+		}
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		t.Setenv("APP_URI", "http://env.example.com")
+
+		cfg, err := Load(path)
+		require.NoError(t, err)
+
+		assert.Equal(t, 3000, cfg.Port)
+		assert.Equal(t, "http://env.example.com", cfg.AppURI)
+	})
+
+	t.Run("should let the config file override .env", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Chdir(dir)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), []byte("TOTP_ISSUER=dotenv\nMAIL_FROM=dotenv@example.com\n"), 0o600))
+
+		path := filepath.Join(dir, "app.env")
+		content := "TOTP_ISSUER=file\n"
+		for k, v := range minimal() {
+			content += k + "=" + v + "\n"
+		}
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		cfg, err := Load(path)
+		require.NoError(t, err)
+
+		assert.Equal(t, "file", cfg.TOTPIssuer)
+		assert.Equal(t, "dotenv@example.com", cfg.Mail.From)
+	})
+
+	t.Run("should fail when the config file is missing", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+
+		_, err := Load("missing.env")
+		assert.ErrorContains(t, err, "missing.env")
+	})
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Key sizes in bytes. Hash keys in COOKIE_STORE_KEYS must be at least
+// MinCookieHashKeyLength long; generated keys use HMAC-SHA256 with a
+// 64-byte key and AES-256 encryption.
+const (
+	MinCookieHashKeyLength    = 32
+	CookieHashKeyLength       = 64
+	CookieEncryptionKeyLength = 32
+)
+
+// CookieKey signs, and optionally encrypts, session cookies.
+type CookieKey struct {
+	HashKey []byte
+
+	// EncryptionKey is empty for keys that only sign.
+	EncryptionKey []byte
+}
+
+// ParseCookieKey parses one COOKIE_STORE_KEYS entry: a base64 hash key,
+// optionally followed by a colon and a base64 encryption key. Errors never
+// include the key material.
+func ParseCookieKey(entry string) (CookieKey, error) {
+	hashPart, encPart, _ := strings.Cut(strings.TrimSpace(entry), ":")
+
+	hashKey, err := base64.StdEncoding.DecodeString(hashPart)
+	if err != nil {
+		return CookieKey{}, errors.New("hash key is not valid base64")
+	}
+	if len(hashKey) < MinCookieHashKeyLength {
+		return CookieKey{}, fmt.Errorf("hash key must be at least %d bytes, got %d", MinCookieHashKeyLength, len(hashKey))
+	}
+
+	key := CookieKey{HashKey: hashKey}
+	if encPart == "" {
+		return key, nil
+	}
+	key.EncryptionKey, err = base64.StdEncoding.DecodeString(encPart)
+	if err != nil {
+		return CookieKey{}, errors.New("encryption key is not valid base64")
+	}
+	switch len(key.EncryptionKey) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return CookieKey{}, fmt.Errorf("encryption key must be 16, 24 or 32 bytes, got %d", len(key.EncryptionKey))
+	}
+}
+
+// FormatCookieKeys renders keys, newest first, as a COOKIE_STORE_KEYS
+// value.
+func FormatCookieKeys(keys []CookieKey) string {
+	entries := make([]string, len(keys))
+	for i, key := range keys {
+		entries[i] = base64.StdEncoding.EncodeToString(key.HashKey)
+		if len(key.EncryptionKey) > 0 {
+			entries[i] += ":" + base64.StdEncoding.EncodeToString(key.EncryptionKey)
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// LoadCookieKeys returns the keys listed in COOKIE_STORE_KEYS, newest
+// first, for tools that rotate them. The legacy COOKIE_STORE_KEY is not
+// included.
+func LoadCookieKeys(path string) ([]CookieKey, error) {
+	vars, err := readVars(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &loader{vars: vars}
+	keys := l.cookieKeyList()
+	return keys, l.err()
+}
+
+// cookieKeys returns the keys from COOKIE_STORE_KEYS followed by the
+// legacy COOKIE_STORE_KEY as a signing-only key, so that cookies issued
+// before switching to the list still decode.
+func (l *loader) cookieKeys() []CookieKey {
+	keys := l.cookieKeyList()
+
+	if legacy := l.string("COOKIE_STORE_KEY", ""); legacy != "" {
+		keys = append(keys, CookieKey{HashKey: []byte(legacy)})
+	}
+
+	if len(keys) == 0 && l.string("COOKIE_STORE_KEYS", "") == "" {
+		l.problem("COOKIE_STORE_KEYS or COOKIE_STORE_KEY is required")
+	}
+	return keys
+}
+
+// cookieKeyList parses COOKIE_STORE_KEYS.
+func (l *loader) cookieKeyList() []CookieKey {
+	var keys []CookieKey
+	for i, entry := range l.list("COOKIE_STORE_KEYS") {
+		key, err := ParseCookieKey(entry)
+		if err != nil {
+			l.problem("COOKIE_STORE_KEYS entry %d: %v", i+1, err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
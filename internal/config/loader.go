@@ -0,0 +1,189 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loader reads typed values from a set of variables, collecting a problem
+// for each invalid or missing one instead of stopping at the first.
+type loader struct {
+	vars     map[string]string
+	problems []string
+}
+
+func (l *loader) problem(format string, args ...any) {
+	l.problems = append(l.problems, fmt.Sprintf(format, args...))
+}
+
+// err returns every problem found, one per line, or nil.
+func (l *loader) err() error {
+	if len(l.problems) == 0 {
+		return nil
+	}
+	return errors.New("invalid configuration:\n  " + strings.Join(l.problems, "\n  "))
+}
+
+// string returns the value of key, or def when it is unset or blank.
+func (l *loader) string(key, def string) string {
+	if v := strings.TrimSpace(l.vars[key]); v != "" {
+		return v
+	}
+	return def
+}
+
+func (l *loader) required(key string) string {
+	v := l.string(key, "")
+	if v == "" {
+		l.problem("%s is required", key)
+	}
+	return v
+}
+
+func (l *loader) int(key string, def int) int {
+	v := l.string(key, "")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		l.problem("%s must be a whole number, got %q", key, v)
+		return def
+	}
+	return n
+}
+
+func (l *loader) port(key string) int {
+	if l.required(key) == "" {
+		return 0
+	}
+	n := l.int(key, 0)
+	if n < 1 || n > 65535 {
+		l.problem("%s must be between 1 and 65535, got %q", key, l.vars[key])
+	}
+	return n
+}
+
+func (l *loader) bool(key string, def bool) bool {
+	v := l.string(key, "")
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		l.problem("%s must be true or false, got %q", key, v)
+		return def
+	}
+	return b
+}
+
+// duration reads a positive Go duration such as "15m" or "720h".
+func (l *loader) duration(key string, def time.Duration) time.Duration {
+	v := l.string(key, "")
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		l.problem("%s must be a positive duration such as 15m or 24h, got %q", key, v)
+		return def
+	}
+	return d
+}
+
+// url reads an absolute http or https URL.
+func (l *loader) url(key string, required bool) string {
+	v := l.string(key, "")
+	if v == "" {
+		if required {
+			l.problem("%s is required", key)
+		}
+		return ""
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		l.problem("%s must be an absolute http or https URL, got %q", key, v)
+	}
+	return v
+}
+
+func (l *loader) urlOr(key, def string) string {
+	if v := l.url(key, false); v != "" {
+		return v
+	}
+	return def
+}
+
+// list reads a comma-separated list, dropping empty items.
+func (l *loader) list(key string) []string {
+	var items []string
+	for _, item := range strings.Split(l.vars[key], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// prefixes reads a comma-separated list of IP addresses and CIDR ranges.
+// A single address becomes a range holding only that address.
+func (l *loader) prefixes(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, item := range l.list(key) {
+		if addr, err := netip.ParseAddr(item); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			l.problem("%s must list IP addresses or CIDR ranges, got %q", key, item)
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// oneOf reads one of the allowed values; the first is the default.
+func (l *loader) oneOf(key string, allowed ...string) string {
+	v := l.string(key, allowed[0])
+	if !slices.Contains(allowed, v) {
+		l.problem("%s must be one of %s, got %q", key, strings.Join(allowed, ", "), v)
+	}
+	return v
+}
+
+// placeholderSecrets are the sample values from the documentation.
+var placeholderSecrets = []string{
+	"randomString",
+	"your_random_secure_key_here",
+	"your_random_secure_key",
+	"changeme",
+	"secret",
+}
+
+// secret rejects a secret that is short, a documented placeholder, or made
+// of few distinct characters.
+func (l *loader) secret(key, value string) {
+	distinct := map[rune]bool{}
+	for _, r := range value {
+		distinct[r] = true
+	}
+
+	switch {
+	case value == "":
+		// Reported as missing elsewhere.
+	case slices.Contains(placeholderSecrets, value):
+		l.problem("%s is a placeholder; generate a key with `openssl rand -base64 32`", key)
+	case len(value) < MinSecretLength:
+		l.problem("%s must be at least %d characters in production, got %d", key, MinSecretLength, len(value))
+	case len(distinct) < 8:
+		l.problem("%s is too repetitive to be random; generate a key with `openssl rand -base64 32`", key)
+	}
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// UserSearch selects a page of users. Query matches a substring of the
+// email address or name; an empty Query matches every user.
+type UserSearch struct {
+	Query  string
+	Limit  int
+	Offset int
+}
+
+// AdminRepository backs the administration API.
+type AdminRepository interface {
+	// SearchUsers returns a page of users, newest first, and the number
+	// of users matching the search across all pages.
+	SearchUsers(ctx context.Context, search UserSearch) ([]User, int, error)
+
+	// SetUserDisabled disables or re-enables an account. It returns
+	// ErrNotFound if the user does not exist.
+	SetUserDisabled(ctx context.Context, userID string, disabled bool) error
+
+	// ResetUserMFA removes the user's authenticator app, recovery codes and
+	// passkeys. Passkeys are kept when the user has no password or linked
+	// identity left to sign in with, so that the reset never locks them
+	// out; passkeysKept reports whether that happened. It returns
+	// ErrNotFound if the user does not exist.
+	ResetUserMFA(ctx context.Context, userID string) (passkeysKept bool, err error)
+}
+
+func (s *service) SearchUsers(ctx context.Context, search UserSearch) ([]User, int, error) {
+	const where = `WHERE $1 = '' OR email ILIKE '%' || $1 || '%' OR name ILIKE '%' || $1 || '%'`
+
+	var total int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users `+where, search.Query).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+userColumns+` FROM users `+where+`
+		 ORDER BY created_at DESC, id LIMIT $2 OFFSET $3`,
+		search.Query, search.Limit, search.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *u)
+	}
+	return users, total, rows.Err()
+}
+
+func (s *service) SetUserDisabled(ctx context.Context, userID string, disabled bool) error {
+	if !validIDs(userID) {
+		return ErrNotFound
+	}
+	return s.execOne(ctx,
+		`UPDATE users SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, NOW()) END, updated_at = NOW()
+		 WHERE id = $1`, userID, disabled)
+}
+
+func (s *service) ResetUserMFA(ctx context.Context, userID string) (passkeysKept bool, err error) {
+	if !validIDs(userID) {
+		return false, ErrNotFound
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	hasPassword, err := lockLoginMethods(ctx, tx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	var identities int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM identities WHERE user_id = $1`, userID).Scan(&identities)
+	if err != nil {
+		return false, err
+	}
+
+	tables := []string{"user_totp", "recovery_codes"}
+	if passkeysKept = identities == 0 && !hasPassword; !passkeysKept {
+		tables = append(tables, "webauthn_credentials")
+	}
+	for _, table := range tables {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+			return false, fmt.Errorf("clear %s: %w", table, err)
+		}
+	}
+
+	return passkeysKept, tx.Commit()
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmin(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	alice, err := s.CreatePasswordUser(ctx, User{Email: "alice.admin@example.com", Name: "Alice"}, "hash")
+	require.NoError(t, err)
+	bob, err := s.CreatePasswordUser(ctx, User{Email: "bob.admin@example.com", Name: "Bob"}, "hash")
+	require.NoError(t, err)
+
+	t.Run("searches users by email or name and pages the results", func(t *testing.T) {
+		users, total, err := s.SearchUsers(ctx, UserSearch{Query: "ALICE.admin", Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		require.Len(t, users, 1)
+		assert.Equal(t, alice.ID, users[0].ID)
+
+		users, total, err = s.SearchUsers(ctx, UserSearch{Query: ".admin@", Limit: 1, Offset: 1})
+		require.NoError(t, err)
+		assert.Equal(t, 2, total)
+		require.Len(t, users, 1)
+		assert.Equal(t, alice.ID, users[0].ID)
+	})
+
+	t.Run("disables and re-enables accounts", func(t *testing.T) {
+		require.NoError(t, s.SetUserDisabled(ctx, bob.ID, true))
+		got, err := s.GetUserByID(ctx, bob.ID)
+		require.NoError(t, err)
+		assert.True(t, got.Disabled)
+
+		require.NoError(t, s.SetUserDisabled(ctx, bob.ID, false))
+		got, err = s.GetUserByID(ctx, bob.ID)
+		require.NoError(t, err)
+		assert.False(t, got.Disabled)
+
+		assert.ErrorIs(t, s.SetUserDisabled(ctx, "00000000-0000-0000-0000-000000000000", true), ErrNotFound)
+		assert.ErrorIs(t, s.SetUserDisabled(ctx, "not-an-id", true), ErrNotFound)
+	})
+
+	t.Run("resets MFA", func(t *testing.T) {
+		require.NoError(t, s.SaveTOTPSecret(ctx, alice.ID, "secret"))
+		require.NoError(t, s.EnableTOTP(ctx, alice.ID, 1, [][]byte{[]byte("code")}))
+		got, err := s.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		require.True(t, got.MFAEnabled)
+
+		require.NoError(t, s.CreateWebAuthnCredential(ctx, &WebAuthnCredential{UserID: alice.ID, CredentialID: []byte("alice-key"), Data: []byte(`{}`)}))
+
+		kept, err := s.ResetUserMFA(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.False(t, kept)
+		got, err = s.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.False(t, got.MFAEnabled)
+
+		_, err = s.ResetUserMFA(ctx, "00000000-0000-0000-0000-000000000000")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("keeps passkeys that are the last login method", func(t *testing.T) {
+		carol, err := s.UpsertOAuthUser(ctx, User{Email: "carol.admin@example.com"}, Identity{Provider: "google", ProviderUserID: "g-carol"})
+		require.NoError(t, err)
+		require.NoError(t, s.CreateWebAuthnCredential(ctx, &WebAuthnCredential{UserID: carol.ID, CredentialID: []byte("carol-key"), Data: []byte(`{}`)}))
+		identities, err := s.ListUserIdentities(ctx, carol.ID)
+		require.NoError(t, err)
+		require.NoError(t, s.UnlinkIdentity(ctx, carol.ID, identities[0].ID))
+
+		kept, err := s.ResetUserMFA(ctx, carol.ID)
+		require.NoError(t, err)
+		assert.True(t, kept)
+
+		list, err := s.ListWebAuthnCredentials(ctx, carol.ID)
+		require.NoError(t, err)
+		assert.Len(t, list, 1)
+	})
+}
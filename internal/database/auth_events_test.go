@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthEvents(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	user, err := s.CreatePasswordUser(ctx, User{Email: "events@example.com"}, "hash")
+	require.NoError(t, err)
+	admin, err := s.CreatePasswordUser(ctx, User{Email: "events.admin@example.com"}, "hash")
+	require.NoError(t, err)
+
+	t.Run("records and filters events", func(t *testing.T) {
+		login := &AuthEvent{Type: EventLoginSucceeded, UserID: user.ID, Provider: "password",
+			IP: "192.0.2.1", UserAgent: "test"}
+		require.NoError(t, s.RecordAuthEvent(ctx, login))
+		assert.NotEmpty(t, login.ID)
+		assert.False(t, login.CreatedAt.IsZero())
+
+		require.NoError(t, s.RecordAuthEvent(ctx, &AuthEvent{Type: EventLoginFailed,
+			Details: map[string]interface{}{"email": "nobody@example.com"}}))
+		require.NoError(t, s.RecordAuthEvent(ctx, &AuthEvent{Type: EventAdminUserDisabled,
+			UserID: user.ID, ActorID: admin.ID}))
+
+		events, err := s.ListAuthEvents(ctx, AuthEventQuery{UserID: user.ID, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, EventAdminUserDisabled, events[0].Type)
+		assert.Equal(t, admin.ID, events[0].ActorID)
+		assert.Equal(t, "192.0.2.1", events[1].IP)
+		assert.Equal(t, "password", events[1].Provider)
+
+		events, err = s.ListAuthEvents(ctx, AuthEventQuery{Type: EventLoginFailed, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "nobody@example.com", events[0].Details["email"])
+
+		events, err = s.ListAuthEvents(ctx, AuthEventQuery{Since: time.Now().Add(time.Hour), Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("refuses to change recorded events", func(t *testing.T) {
+		_, err := s.db.ExecContext(ctx, `UPDATE auth_events SET type = 'tampered'`)
+		assert.Error(t, err)
+
+		_, err = s.db.ExecContext(ctx, `DELETE FROM auth_events`)
+		assert.Error(t, err)
+	})
+}
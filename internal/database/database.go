@@ -4,13 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
-	_ "github.com/joho/godotenv/autoload"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
 )
 
 // Service represents a service that interacts with a database.
@@ -22,38 +23,55 @@ type Service interface {
 	// Close terminates the database connection.
 	// It returns an error if the connection cannot be closed.
 	Close() error
+
+	Migrator
+	UserRepository
+	SessionRepository
+	RefreshTokenRepository
+	OneTimeTokenRepository
+	MFARepository
+	WebAuthnRepository
+	RBACRepository
+	OrganizationRepository
+	AdminRepository
+	AuthEventRepository
+	RateLimitRepository
+	LoginThrottleRepository
 }
 
 type service struct {
-	db *sql.DB
+	db     *sql.DB
+	name   string
+	schema string
 }
 
-var (
-	database   = os.Getenv("BLUEPRINT_DB_DATABASE")
-	password   = os.Getenv("BLUEPRINT_DB_PASSWORD")
-	username   = os.Getenv("BLUEPRINT_DB_USERNAME")
-	port       = os.Getenv("BLUEPRINT_DB_PORT")
-	host       = os.Getenv("BLUEPRINT_DB_HOST")
-	schema     = os.Getenv("BLUEPRINT_DB_SCHEMA")
-	dbInstance *service
-)
+var dbInstance *service
 
-func New() Service {
+// New connects to the database described by cfg. The connection is shared,
+// so later calls return the first one.
+func New(cfg config.Database) Service {
 	// Reuse Connection
 	if dbInstance != nil {
 		return dbInstance
 	}
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s", username, password, host, port, database, schema)
-	db, err := sql.Open("pgx", connStr)
+	db, err := sql.Open("pgx", connString(cfg))
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("Failed to open database", "error", err)
+		os.Exit(1)
 	}
 	dbInstance = &service{
-		db: db,
+		db:     db,
+		name:   cfg.Name,
+		schema: cfg.Schema,
 	}
 	return dbInstance
 }
 
+func connString(cfg config.Database) string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s",
+		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.Name, cfg.Schema)
+}
+
 // Health checks the health of the database connection by pinging the database.
 // It returns a map with keys indicating various health statistics.
 func (s *service) Health() map[string]string {
@@ -67,7 +85,8 @@ func (s *service) Health() map[string]string {
 	if err != nil {
 		stats["status"] = "down"
 		stats["error"] = fmt.Sprintf("db down: %v", err)
-		log.Fatalf("db down: %v", err) // Log the error and terminate the program
+		slog.Error("Database is down", "error", err) // Log the error and terminate the program
+		os.Exit(1)
 		return stats
 	}
 
@@ -110,6 +129,6 @@ func (s *service) Health() map[string]string {
 // If the connection is successfully closed, it returns nil.
 // If an error occurs while closing the connection, it returns the error.
 func (s *service) Close() error {
-	log.Printf("Disconnected from database: %s", database)
+	slog.Info("Disconnected from database", "database", s.name)
 	return s.db.Close()
 }
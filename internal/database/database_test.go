@@ -9,8 +9,13 @@ import (
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
 )
 
+// testConfig points at the container started by TestMain.
+var testConfig = config.Database{Schema: "public"}
+
 func mustStartPostgresContainer() (func(context.Context, ...testcontainers.TerminateOption) error, error) {
 	var (
 		dbName = "database"
@@ -33,9 +38,9 @@ func mustStartPostgresContainer() (func(context.Context, ...testcontainers.Termi
 		return nil, err
 	}
 
-	database = dbName
-	password = dbPwd
-	username = dbUser
+	testConfig.Name = dbName
+	testConfig.Password = dbPwd
+	testConfig.Username = dbUser
 
 	dbHost, err := dbContainer.Host(context.Background())
 	if err != nil {
@@ -47,8 +52,8 @@ func mustStartPostgresContainer() (func(context.Context, ...testcontainers.Termi
 		return dbContainer.Terminate, err
 	}
 
-	host = dbHost
-	port = dbPort.Port()
+	testConfig.Host = dbHost
+	testConfig.Port = dbPort.Port()
 
 	return dbContainer.Terminate, err
 }
@@ -67,14 +72,14 @@ func TestMain(m *testing.M) {
 }
 
 func TestNew(t *testing.T) {
-	srv := New()
+	srv := New(testConfig)
 	if srv == nil {
-		t.Fatal("New() returned nil")
+		t.Fatal("New(testConfig) returned nil")
 	}
 }
 
 func TestHealth(t *testing.T) {
-	srv := New()
+	srv := New(testConfig)
 
 	stats := srv.Health()
 
@@ -92,7 +97,7 @@ func TestHealth(t *testing.T) {
 }
 
 func TestClose(t *testing.T) {
-	srv := New()
+	srv := New(testConfig)
 
 	if srv.Close() != nil {
 		t.Fatalf("expected Close() to return nil")
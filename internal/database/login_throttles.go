@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LoginThrottle counts recent failed sign-in attempts against a key, such
+// as an account or a client address, and records any lockout in force.
+type LoginThrottle struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time // zero when not locked
+}
+
+// LoginThrottleRepository tracks failed sign-in attempts.
+type LoginThrottleRepository interface {
+	// GetLoginThrottles returns the throttles for keys. Keys without
+	// recorded failures are left out.
+	GetLoginThrottles(ctx context.Context, keys []string) ([]LoginThrottle, error)
+
+	// RecordLoginFailure counts a failed attempt against key and returns
+	// the updated throttle. The count starts over when the previous
+	// failure is older than window.
+	RecordLoginFailure(ctx context.Context, key string, window time.Duration) (*LoginThrottle, error)
+
+	// LockLogin locks key until the given time. It returns ErrNotFound if
+	// no failures were recorded against key.
+	LockLogin(ctx context.Context, key string, until time.Time) error
+
+	// ClearLoginFailures forgets the failures and any lockout of key.
+	ClearLoginFailures(ctx context.Context, key string) error
+
+	// DeleteStaleLoginThrottles removes unlocked throttles whose last
+	// failure was before the given time and returns how many were removed.
+	DeleteStaleLoginThrottles(ctx context.Context, before time.Time) (int64, error)
+}
+
+const loginThrottleColumns = `key, failures, last_failure_at, locked_until`
+
+func scanLoginThrottle(row interface{ Scan(...any) error }) (LoginThrottle, error) {
+	var (
+		t           LoginThrottle
+		lockedUntil sql.NullTime
+	)
+	err := row.Scan(&t.Key, &t.Failures, &t.LastFailureAt, &lockedUntil)
+	t.LockedUntil = lockedUntil.Time
+	return t, err
+}
+
+func (s *service) GetLoginThrottles(ctx context.Context, keys []string) ([]LoginThrottle, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+loginThrottleColumns+` FROM login_throttles WHERE key = ANY($1)`, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var throttles []LoginThrottle
+	for rows.Next() {
+		t, err := scanLoginThrottle(rows)
+		if err != nil {
+			return nil, err
+		}
+		throttles = append(throttles, t)
+	}
+	return throttles, rows.Err()
+}
+
+func (s *service) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (*LoginThrottle, error) {
+	t, err := scanLoginThrottle(s.db.QueryRowContext(ctx,
+		`INSERT INTO login_throttles (key, failures, last_failure_at)
+		 VALUES ($1, 1, NOW())
+		 ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failure_at < NOW() - $2 * INTERVAL '1 microsecond' THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failure_at = NOW()
+		 RETURNING `+loginThrottleColumns,
+		key, window.Microseconds()))
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *service) LockLogin(ctx context.Context, key string, until time.Time) error {
+	return s.execOne(ctx,
+		`UPDATE login_throttles SET locked_until = $2 WHERE key = $1`, key, until)
+}
+
+func (s *service) ClearLoginFailures(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_throttles WHERE key = $1`, key)
+	return err
+}
+
+func (s *service) DeleteStaleLoginThrottles(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM login_throttles
+		 WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until <= NOW())`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginThrottles(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	t.Run("counts failures per key", func(t *testing.T) {
+		for want := 1; want <= 3; want++ {
+			throttle, err := s.RecordLoginFailure(ctx, "user:a", time.Hour)
+			require.NoError(t, err)
+			assert.Equal(t, want, throttle.Failures)
+		}
+		_, err := s.RecordLoginFailure(ctx, "ip:192.0.2.1", time.Hour)
+		require.NoError(t, err)
+
+		throttles, err := s.GetLoginThrottles(ctx, []string{"user:a", "ip:192.0.2.1", "user:b"})
+		require.NoError(t, err)
+		require.Len(t, throttles, 2)
+		for _, throttle := range throttles {
+			assert.True(t, throttle.LockedUntil.IsZero())
+		}
+	})
+
+	t.Run("starts over after the window", func(t *testing.T) {
+		_, err := s.RecordLoginFailure(ctx, "user:window", time.Hour)
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+
+		throttle, err := s.RecordLoginFailure(ctx, "user:window", time.Millisecond)
+		require.NoError(t, err)
+		assert.Equal(t, 1, throttle.Failures)
+	})
+
+	t.Run("locks and clears keys", func(t *testing.T) {
+		until := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+		require.NoError(t, s.LockLogin(ctx, "user:a", until))
+		assert.ErrorIs(t, s.LockLogin(ctx, "user:unknown", until), ErrNotFound)
+
+		throttles, err := s.GetLoginThrottles(ctx, []string{"user:a"})
+		require.NoError(t, err)
+		require.Len(t, throttles, 1)
+		assert.True(t, until.Equal(throttles[0].LockedUntil))
+
+		require.NoError(t, s.ClearLoginFailures(ctx, "user:a"))
+		throttles, err = s.GetLoginThrottles(ctx, []string{"user:a"})
+		require.NoError(t, err)
+		assert.Empty(t, throttles)
+	})
+
+	t.Run("deletes stale throttles but keeps lockouts", func(t *testing.T) {
+		_, err := s.RecordLoginFailure(ctx, "user:locked", time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, s.LockLogin(ctx, "user:locked", time.Now().Add(time.Hour)))
+
+		_, err = s.DeleteStaleLoginThrottles(ctx, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+
+		throttles, err := s.GetLoginThrottles(ctx, []string{"user:locked", "ip:192.0.2.1"})
+		require.NoError(t, err)
+		require.Len(t, throttles, 1)
+		assert.Equal(t, "user:locked", throttles[0].Key)
+	})
+}
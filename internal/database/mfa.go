@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrCodeUsed is returned when a TOTP code is presented for a time step
+// that has already been used.
+var ErrCodeUsed = errors.New("database: code already used")
+
+// TOTP is a user's authenticator app enrollment. It only takes effect once
+// Enabled, after the user has confirmed a code.
+type TOTP struct {
+	UserID  string
+	Secret  string
+	Enabled bool
+}
+
+// MFARepository persists second-factor enrollments and recovery codes.
+type MFARepository interface {
+	// GetTOTP returns the user's TOTP enrollment, or ErrNotFound.
+	GetTOTP(ctx context.Context, userID string) (*TOTP, error)
+
+	// SaveTOTPSecret starts or restarts enrollment with a new secret. It
+	// returns ErrNotFound if TOTP is already enabled for the user.
+	SaveTOTPSecret(ctx context.Context, userID, secret string) error
+
+	// EnableTOTP completes enrollment, recording step as used and
+	// replacing the user's recovery codes.
+	EnableTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes [][]byte) error
+
+	// DisableTOTP removes the user's TOTP enrollment and recovery codes.
+	DisableTOTP(ctx context.Context, userID string) error
+
+	// UseTOTPStep records that a code for step was accepted. It returns
+	// ErrCodeUsed if the step, or a later one, was used before.
+	UseTOTPStep(ctx context.Context, userID string, step int64) error
+
+	// UseRecoveryCode spends one of the user's recovery codes. It returns
+	// ErrNotFound if the code is unknown or already used.
+	UseRecoveryCode(ctx context.Context, userID string, codeHash []byte) error
+}
+
+func (s *service) GetTOTP(ctx context.Context, userID string) (*TOTP, error) {
+	t := TOTP{UserID: userID}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT secret, enabled_at IS NOT NULL FROM user_totp WHERE user_id = $1`, userID,
+	).Scan(&t.Secret, &t.Enabled)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &t, nil
+}
+
+func (s *service) SaveTOTPSecret(ctx context.Context, userID, secret string) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE
+		 SET secret = EXCLUDED.secret, last_used_step = NULL, created_at = NOW()
+		 WHERE user_totp.enabled_at IS NULL`,
+		userID, secret)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *service) EnableTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes [][]byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE user_totp SET enabled_at = NOW(), last_used_step = $2
+		 WHERE user_id = $1 AND enabled_at IS NULL`, userID, step)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string, hashes [][]byte) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) DisableTOTP(ctx context.Context, userID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *service) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE user_totp SET last_used_step = $2
+		 WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2)`,
+		userID, step)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCodeUsed
+	}
+	return nil
+}
+
+func (s *service) UseRecoveryCode(ctx context.Context, userID string, codeHash []byte) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE recovery_codes SET used_at = NOW()
+		 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
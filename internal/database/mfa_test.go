@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFA(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	user, err := s.CreatePasswordUser(ctx, User{Email: "mfa@example.com"}, "hash")
+	require.NoError(t, err)
+
+	t.Run("enrolls and enables TOTP", func(t *testing.T) {
+		require.NoError(t, s.SaveTOTPSecret(ctx, user.ID, "FIRST"))
+		require.NoError(t, s.SaveTOTPSecret(ctx, user.ID, "SECOND"))
+
+		totp, err := s.GetTOTP(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "SECOND", totp.Secret)
+		assert.False(t, totp.Enabled)
+
+		require.NoError(t, s.EnableTOTP(ctx, user.ID, 100, [][]byte{[]byte("code-1"), []byte("code-2")}))
+
+		got, err := s.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.True(t, got.MFAEnabled)
+
+		assert.ErrorIs(t, s.SaveTOTPSecret(ctx, user.ID, "THIRD"), ErrNotFound)
+	})
+
+	t.Run("refuses to reuse a time step", func(t *testing.T) {
+		assert.ErrorIs(t, s.UseTOTPStep(ctx, user.ID, 100), ErrCodeUsed)
+		assert.NoError(t, s.UseTOTPStep(ctx, user.ID, 101))
+		assert.ErrorIs(t, s.UseTOTPStep(ctx, user.ID, 101), ErrCodeUsed)
+	})
+
+	t.Run("spends each recovery code once", func(t *testing.T) {
+		require.NoError(t, s.UseRecoveryCode(ctx, user.ID, []byte("code-1")))
+		assert.ErrorIs(t, s.UseRecoveryCode(ctx, user.ID, []byte("code-1")), ErrNotFound)
+		assert.ErrorIs(t, s.UseRecoveryCode(ctx, user.ID, []byte("unknown")), ErrNotFound)
+	})
+
+	t.Run("disables TOTP", func(t *testing.T) {
+		require.NoError(t, s.DisableTOTP(ctx, user.ID))
+
+		_, err := s.GetTOTP(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, s.UseRecoveryCode(ctx, user.ID, []byte("code-2")), ErrNotFound)
+
+		got, err := s.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.False(t, got.MFAEnabled)
+	})
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.Up, "migration %d should have an up script", m.Version)
+		assert.NotEmpty(t, m.Down, "migration %d should have a down script", m.Version)
+		if i > 0 {
+			assert.Greater(t, m.Version, migrations[i-1].Version, "versions should be unique and sorted")
+		}
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+
+	t.Run("up is idempotent", func(t *testing.T) {
+		applied, err := s.MigrateUp(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, applied)
+	})
+
+	t.Run("status reports every migration as applied", func(t *testing.T) {
+		statuses, err := s.MigrationStatus(ctx)
+		require.NoError(t, err)
+		require.Len(t, statuses, len(migrations))
+
+		for _, st := range statuses {
+			assert.True(t, st.Applied, "migration %d should be applied", st.Version)
+			assert.False(t, st.AppliedAt.IsZero())
+		}
+	})
+
+	t.Run("down reverts and up reapplies the latest migration", func(t *testing.T) {
+		reverted, err := s.MigrateDown(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, reverted)
+
+		statuses, err := s.MigrationStatus(ctx)
+		require.NoError(t, err)
+		assert.False(t, statuses[len(statuses)-1].Applied)
+
+		applied, err := s.MigrateUp(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+	})
+}
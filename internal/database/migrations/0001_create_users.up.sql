@@ -0,0 +1,25 @@
+CREATE TABLE users (
+	id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	email      TEXT UNIQUE,
+	name       TEXT,
+	avatar_url TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE identities (
+	id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id          UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider         TEXT NOT NULL,
+	provider_user_id TEXT NOT NULL,
+	email            TEXT,
+	access_token     TEXT,
+	refresh_token    TEXT,
+	expires_at       TIMESTAMPTZ,
+	raw_data         JSONB NOT NULL DEFAULT '{}',
+	created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE (provider, provider_user_id)
+);
+
+CREATE INDEX identities_user_id_idx ON identities (user_id);
@@ -0,0 +1,9 @@
+CREATE TABLE sessions (
+	id         TEXT PRIMARY KEY,
+	data       BYTEA NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
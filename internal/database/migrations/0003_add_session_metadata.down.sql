@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS sessions_user_id_idx;
+
+ALTER TABLE sessions
+	DROP COLUMN IF EXISTS public_id,
+	DROP COLUMN IF EXISTS user_id,
+	DROP COLUMN IF EXISTS provider,
+	DROP COLUMN IF EXISTS ip,
+	DROP COLUMN IF EXISTS user_agent,
+	DROP COLUMN IF EXISTS last_seen_at;
@@ -0,0 +1,9 @@
+ALTER TABLE sessions
+	ADD COLUMN public_id    UUID NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	ADD COLUMN user_id      UUID REFERENCES users(id) ON DELETE CASCADE,
+	ADD COLUMN provider     TEXT,
+	ADD COLUMN ip           TEXT,
+	ADD COLUMN user_agent   TEXT,
+	ADD COLUMN last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
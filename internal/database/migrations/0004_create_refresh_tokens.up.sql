@@ -0,0 +1,13 @@
+CREATE TABLE refresh_tokens (
+	id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	family_id  UUID NOT NULL,
+	token_hash BYTEA NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at    TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+CREATE TABLE one_time_tokens (
+	id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	purpose    TEXT NOT NULL,
+	token_hash BYTEA NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX one_time_tokens_user_id_idx ON one_time_tokens (user_id);
+CREATE INDEX one_time_tokens_expires_at_idx ON one_time_tokens (expires_at);
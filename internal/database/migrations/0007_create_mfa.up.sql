@@ -0,0 +1,15 @@
+CREATE TABLE user_totp (
+	user_id        UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret         TEXT NOT NULL,
+	enabled_at     TIMESTAMPTZ,
+	last_used_step BIGINT,
+	created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE recovery_codes (
+	id        UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash BYTEA NOT NULL,
+	used_at   TIMESTAMPTZ,
+	UNIQUE (user_id, code_hash)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE webauthn_credentials (
+	id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	credential_id BYTEA NOT NULL UNIQUE,
+	name          TEXT,
+	data          JSONB NOT NULL,
+	created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at  TIMESTAMPTZ
+);
+
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
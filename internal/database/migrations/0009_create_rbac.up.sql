@@ -0,0 +1,37 @@
+CREATE TABLE roles (
+	name        TEXT PRIMARY KEY,
+	description TEXT,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE permissions (
+	name        TEXT PRIMARY KEY,
+	description TEXT
+);
+
+CREATE TABLE role_permissions (
+	role       TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+	permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+	PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE user_roles (
+	user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role       TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (user_id, role)
+);
+
+CREATE INDEX user_roles_role_idx ON user_roles (role);
+
+INSERT INTO permissions (name, description) VALUES
+	('users:read', 'View user accounts'),
+	('users:write', 'Modify user accounts'),
+	('roles:read', 'View roles and role assignments'),
+	('roles:write', 'Manage roles and assign them to users');
+
+INSERT INTO roles (name, description) VALUES
+	('admin', 'Full access to every permission');
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions;
@@ -0,0 +1,30 @@
+CREATE TABLE organizations (
+	id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	name       TEXT NOT NULL,
+	slug       TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE organization_members (
+	organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role            TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+	created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX organization_members_user_id_idx ON organization_members (user_id);
+
+CREATE TABLE organization_invitations (
+	id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	email           TEXT NOT NULL,
+	role            TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+	token_hash      BYTEA NOT NULL UNIQUE,
+	invited_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+	expires_at      TIMESTAMPTZ NOT NULL,
+	accepted_at     TIMESTAMPTZ,
+	created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX organization_invitations_organization_id_idx ON organization_invitations (organization_id);
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMPTZ;
+
+CREATE TABLE admin_audit_log (
+	id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	actor_id       UUID REFERENCES users(id) ON DELETE SET NULL,
+	action         TEXT NOT NULL,
+	target_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+	details        JSONB NOT NULL DEFAULT '{}',
+	ip             TEXT,
+	created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX admin_audit_log_target_user_id_idx ON admin_audit_log (target_user_id);
+CREATE INDEX admin_audit_log_created_at_idx ON admin_audit_log (created_at);
@@ -0,0 +1,28 @@
+CREATE TABLE admin_audit_log (
+	id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	actor_id       UUID REFERENCES users(id) ON DELETE SET NULL,
+	action         TEXT NOT NULL,
+	target_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+	details        JSONB NOT NULL DEFAULT '{}',
+	ip             TEXT,
+	created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX admin_audit_log_target_user_id_idx ON admin_audit_log (target_user_id);
+CREATE INDEX admin_audit_log_created_at_idx ON admin_audit_log (created_at);
+
+INSERT INTO admin_audit_log (actor_id, action, target_user_id, details, ip, created_at)
+SELECT (SELECT id FROM users WHERE id = e.actor_id),
+       CASE e.type
+	       WHEN 'admin.user_disabled' THEN 'user.disable'
+	       WHEN 'admin.user_enabled' THEN 'user.enable'
+	       WHEN 'admin.user_signed_out' THEN 'user.logout'
+	       WHEN 'admin.mfa_reset' THEN 'user.reset_mfa'
+	       ELSE substr(e.type, 7)
+       END,
+       (SELECT id FROM users WHERE id = e.user_id), e.details, e.ip, e.created_at
+FROM auth_events e
+WHERE e.type LIKE 'admin.%';
+
+DROP TABLE IF EXISTS auth_events;
+DROP FUNCTION IF EXISTS auth_events_append_only();
@@ -0,0 +1,41 @@
+-- auth_events is an append-only record of security-relevant activity. User
+-- IDs are not foreign keys so that history outlives the accounts it is about.
+CREATE TABLE auth_events (
+	id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	type       TEXT NOT NULL,
+	user_id    UUID,
+	actor_id   UUID,
+	provider   TEXT,
+	ip         TEXT,
+	user_agent TEXT,
+	details    JSONB NOT NULL DEFAULT '{}',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX auth_events_user_id_created_at_idx ON auth_events (user_id, created_at);
+CREATE INDEX auth_events_actor_id_idx ON auth_events (actor_id);
+CREATE INDEX auth_events_type_idx ON auth_events (type);
+CREATE INDEX auth_events_created_at_idx ON auth_events (created_at);
+
+CREATE FUNCTION auth_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'auth_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER auth_events_append_only
+	BEFORE UPDATE OR DELETE ON auth_events
+	FOR EACH ROW EXECUTE FUNCTION auth_events_append_only();
+
+INSERT INTO auth_events (type, user_id, actor_id, ip, details, created_at)
+SELECT CASE action
+	       WHEN 'user.disable' THEN 'admin.user_disabled'
+	       WHEN 'user.enable' THEN 'admin.user_enabled'
+	       WHEN 'user.logout' THEN 'admin.user_signed_out'
+	       WHEN 'user.reset_mfa' THEN 'admin.mfa_reset'
+	       ELSE 'admin.' || action
+       END,
+       target_user_id, actor_id, ip, details, created_at
+FROM admin_audit_log;
+
+DROP TABLE admin_audit_log;
@@ -0,0 +1,8 @@
+CREATE UNLOGGED TABLE rate_limit_buckets (
+	key        TEXT PRIMARY KEY,
+	tokens     DOUBLE PRECISION NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	full_at    TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limit_buckets_full_at_idx ON rate_limit_buckets (full_at);
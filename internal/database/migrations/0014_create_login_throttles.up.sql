@@ -0,0 +1,8 @@
+CREATE TABLE login_throttles (
+	key             TEXT PRIMARY KEY,
+	failures        INTEGER NOT NULL,
+	last_failure_at TIMESTAMPTZ NOT NULL,
+	locked_until    TIMESTAMPTZ
+);
+
+CREATE INDEX login_throttles_last_failure_at_idx ON login_throttles (last_failure_at);
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Purposes of one-time tokens. A token can only be redeemed for the
+// purpose it was issued for.
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+	TokenPurposeMagicLink     = "magic_link"
+)
+
+// OneTimeTokenRepository persists hashed single-use tokens that are sent
+// to users by email, such as verification links.
+type OneTimeTokenRepository interface {
+	// CreateOneTimeToken stores a token for userID that can be redeemed
+	// once for purpose until expiresAt.
+	CreateOneTimeToken(ctx context.Context, userID, purpose string, tokenHash []byte, expiresAt time.Time) error
+
+	// ConsumeOneTimeToken marks the token as used and returns its user ID.
+	// It returns ErrNotFound when the token is unknown, expired, already
+	// used or was issued for a different purpose.
+	ConsumeOneTimeToken(ctx context.Context, purpose string, tokenHash []byte) (string, error)
+
+	// LookupOneTimeToken returns the user ID of a token that could be
+	// consumed for purpose, without using it up. It returns ErrNotFound in
+	// the same cases as ConsumeOneTimeToken.
+	LookupOneTimeToken(ctx context.Context, purpose string, tokenHash []byte) (string, error)
+
+	// DeleteUserOneTimeTokens removes all of the user's tokens for purpose,
+	// invalidating any links that are still outstanding.
+	DeleteUserOneTimeTokens(ctx context.Context, userID, purpose string) error
+}
+
+func (s *service) CreateOneTimeToken(ctx context.Context, userID, purpose string, tokenHash []byte, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO one_time_tokens (user_id, purpose, token_hash, expires_at)
+		 VALUES ($1, $2, $3, $4)`,
+		userID, purpose, tokenHash, expiresAt)
+	return err
+}
+
+func (s *service) ConsumeOneTimeToken(ctx context.Context, purpose string, tokenHash []byte) (string, error) {
+	var userID string
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE one_time_tokens SET used_at = NOW()
+		 WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id`,
+		tokenHash, purpose,
+	).Scan(&userID)
+	if err != nil {
+		return "", notFound(err)
+	}
+	return userID, nil
+}
+
+func (s *service) LookupOneTimeToken(ctx context.Context, purpose string, tokenHash []byte) (string, error) {
+	var userID string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT user_id FROM one_time_tokens
+		 WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()`,
+		tokenHash, purpose,
+	).Scan(&userID)
+	if err != nil {
+		return "", notFound(err)
+	}
+	return userID, nil
+}
+
+func (s *service) DeleteUserOneTimeTokens(ctx context.Context, userID, purpose string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM one_time_tokens WHERE user_id = $1 AND purpose = $2`, userID, purpose)
+	return err
+}
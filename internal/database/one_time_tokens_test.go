@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOneTimeTokens(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	user, err := s.CreatePasswordUser(ctx, User{Email: "tokens@example.com"}, "hash")
+	require.NoError(t, err)
+
+	t.Run("consumes a token exactly once", func(t *testing.T) {
+		require.NoError(t, s.CreateOneTimeToken(ctx, user.ID, TokenPurposeVerifyEmail, []byte("ott-a"), time.Now().Add(time.Hour)))
+
+		userID, err := s.ConsumeOneTimeToken(ctx, TokenPurposeVerifyEmail, []byte("ott-a"))
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, userID)
+
+		_, err = s.ConsumeOneTimeToken(ctx, TokenPurposeVerifyEmail, []byte("ott-a"))
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("looks up a token without consuming it", func(t *testing.T) {
+		require.NoError(t, s.CreateOneTimeToken(ctx, user.ID, TokenPurposeResetPassword, []byte("ott-f"), time.Now().Add(time.Hour)))
+
+		userID, err := s.LookupOneTimeToken(ctx, TokenPurposeResetPassword, []byte("ott-f"))
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, userID)
+
+		_, err = s.LookupOneTimeToken(ctx, TokenPurposeVerifyEmail, []byte("ott-f"))
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = s.ConsumeOneTimeToken(ctx, TokenPurposeResetPassword, []byte("ott-f"))
+		require.NoError(t, err)
+		_, err = s.LookupOneTimeToken(ctx, TokenPurposeResetPassword, []byte("ott-f"))
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("rejects expired tokens and other purposes", func(t *testing.T) {
+		require.NoError(t, s.CreateOneTimeToken(ctx, user.ID, TokenPurposeVerifyEmail, []byte("ott-b"), time.Now().Add(-time.Minute)))
+		_, err := s.ConsumeOneTimeToken(ctx, TokenPurposeVerifyEmail, []byte("ott-b"))
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, s.CreateOneTimeToken(ctx, user.ID, TokenPurposeVerifyEmail, []byte("ott-c"), time.Now().Add(time.Hour)))
+		_, err = s.ConsumeOneTimeToken(ctx, "other", []byte("ott-c"))
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("deletes a user's outstanding tokens for one purpose", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour)
+		require.NoError(t, s.CreateOneTimeToken(ctx, user.ID, TokenPurposeResetPassword, []byte("ott-d"), expiresAt))
+		require.NoError(t, s.CreateOneTimeToken(ctx, user.ID, TokenPurposeVerifyEmail, []byte("ott-e"), expiresAt))
+
+		require.NoError(t, s.DeleteUserOneTimeTokens(ctx, user.ID, TokenPurposeResetPassword))
+
+		_, err := s.ConsumeOneTimeToken(ctx, TokenPurposeResetPassword, []byte("ott-d"))
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.ConsumeOneTimeToken(ctx, TokenPurposeVerifyEmail, []byte("ott-e"))
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,372 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Roles a user can hold within an organization, from most to least
+// privileged.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+var (
+	// ErrSlugTaken is returned when an organization would reuse the slug
+	// of an existing one.
+	ErrSlugTaken = errors.New("database: organization slug already in use")
+
+	// ErrLastOwner is returned when a change would leave an organization
+	// without an owner.
+	ErrLastOwner = errors.New("database: organization must keep an owner")
+
+	// ErrInvitationEmail is returned when a user accepts an invitation that
+	// was sent to an address other than their own verified one.
+	ErrInvitationEmail = errors.New("database: invitation is for another email address")
+)
+
+// Organization is a tenant that users belong to.
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Membership is a user's role in one organization.
+type Membership struct {
+	Organization Organization
+	UserID       string
+	Role         string
+	JoinedAt     time.Time
+}
+
+// Member is a user as seen from an organization they belong to.
+type Member struct {
+	User     User
+	Role     string
+	JoinedAt time.Time
+}
+
+// Invitation offers an email address a role in an organization. It is
+// redeemed with a token that was emailed to the address.
+type Invitation struct {
+	ID             string
+	OrganizationID string
+	Email          string
+	Role           string
+	InvitedBy      string
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
+
+// OrganizationRepository persists organizations, their members and
+// pending invitations.
+type OrganizationRepository interface {
+	// CreateOrganization stores org, fills in its ID and CreatedAt, and
+	// makes ownerID its owner. It returns ErrSlugTaken if the slug is in
+	// use.
+	CreateOrganization(ctx context.Context, org *Organization, ownerID string) error
+
+	// ListUserOrganizations returns the user's memberships, oldest first.
+	ListUserOrganizations(ctx context.Context, userID string) ([]Membership, error)
+
+	// GetMembership returns the user's membership of an organization, or
+	// ErrNotFound.
+	GetMembership(ctx context.Context, orgID, userID string) (*Membership, error)
+
+	// ListOrganizationMembers returns the members of an organization,
+	// oldest first.
+	ListOrganizationMembers(ctx context.Context, orgID string) ([]Member, error)
+
+	// SetMemberRole changes a member's role. It returns ErrNotFound if the
+	// user is not a member and ErrLastOwner when demoting the only owner.
+	SetMemberRole(ctx context.Context, orgID, userID, role string) error
+
+	// RemoveMember removes a user from an organization. It returns
+	// ErrNotFound if the user is not a member and ErrLastOwner when
+	// removing the only owner.
+	RemoveMember(ctx context.Context, orgID, userID string) error
+
+	// CreateInvitation stores an invitation redeemable with the token that
+	// hashes to tokenHash, and fills in its ID and CreatedAt.
+	CreateInvitation(ctx context.Context, inv *Invitation, tokenHash []byte) error
+
+	// ListInvitations returns an organization's pending, unexpired
+	// invitations, newest first.
+	ListInvitations(ctx context.Context, orgID string) ([]Invitation, error)
+
+	// DeleteInvitation revokes one of an organization's invitations. It
+	// returns ErrNotFound if there is no such invitation.
+	DeleteInvitation(ctx context.Context, orgID, id string) error
+
+	// AcceptInvitation redeems an invitation for userID and returns the
+	// resulting membership. A user who already belongs to the organization
+	// keeps their current role. It returns ErrNotFound when the token is
+	// unknown, expired or already used, and ErrInvitationEmail unless the
+	// user's verified email address is the one the invitation was sent to.
+	AcceptInvitation(ctx context.Context, tokenHash []byte, userID string) (*Membership, error)
+}
+
+const membershipColumns = `o.id, o.name, o.slug, o.created_at, m.user_id, m.role, m.created_at`
+
+func scanMembership(row interface{ Scan(...any) error }) (*Membership, error) {
+	var m Membership
+	err := row.Scan(&m.Organization.ID, &m.Organization.Name, &m.Organization.Slug, &m.Organization.CreatedAt,
+		&m.UserID, &m.Role, &m.JoinedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &m, nil
+}
+
+func (s *service) CreateOrganization(ctx context.Context, org *Organization, ownerID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO organizations (name, slug) VALUES ($1, $2) RETURNING id, created_at`,
+		org.Name, org.Slug,
+	).Scan(&org.ID, &org.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrSlugTaken
+	}
+	if err != nil {
+		return fmt.Errorf("insert organization: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)`,
+		org.ID, ownerID, OrgRoleOwner)
+	if err != nil {
+		return fmt.Errorf("insert owner: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) ListUserOrganizations(ctx context.Context, userID string) ([]Membership, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+membershipColumns+`
+		 FROM organization_members m JOIN organizations o ON o.id = m.organization_id
+		 WHERE m.user_id = $1 ORDER BY m.created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []Membership
+	for rows.Next() {
+		m, err := scanMembership(rows)
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, *m)
+	}
+	return memberships, rows.Err()
+}
+
+func (s *service) GetMembership(ctx context.Context, orgID, userID string) (*Membership, error) {
+	if !validIDs(orgID, userID) {
+		return nil, ErrNotFound
+	}
+	return scanMembership(s.db.QueryRowContext(ctx,
+		`SELECT `+membershipColumns+`
+		 FROM organization_members m JOIN organizations o ON o.id = m.organization_id
+		 WHERE m.organization_id = $1 AND m.user_id = $2`, orgID, userID))
+}
+
+func (s *service) ListOrganizationMembers(ctx context.Context, orgID string) ([]Member, error) {
+	if !validIDs(orgID) {
+		return nil, nil
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+userColumns+`, m.role, m.joined_at
+		 FROM users JOIN (
+		     SELECT user_id, role, created_at AS joined_at FROM organization_members
+		     WHERE organization_id = $1
+		 ) m ON m.user_id = users.id
+		 ORDER BY m.joined_at`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []Member
+	for rows.Next() {
+		var m Member
+		user, err := scanUser(rows, &m.Role, &m.JoinedAt)
+		if err != nil {
+			return nil, err
+		}
+		m.User = *user
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (s *service) SetMemberRole(ctx context.Context, orgID, userID, role string) error {
+	return s.changeMember(ctx, orgID, userID, role == OrgRoleOwner,
+		`UPDATE organization_members SET role = $3
+		 WHERE organization_id = $1 AND user_id = $2`, role)
+}
+
+func (s *service) RemoveMember(ctx context.Context, orgID, userID string) error {
+	return s.changeMember(ctx, orgID, userID, false,
+		`DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2`)
+}
+
+// changeMember runs query against one membership and fails with
+// ErrLastOwner if the organization is left without an owner. keepsOwner
+// reports whether the change leaves the member an owner.
+func (s *service) changeMember(ctx context.Context, orgID, userID string, keepsOwner bool, query string, args ...any) error {
+	if !validIDs(orgID, userID) {
+		return ErrNotFound
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the organization so that concurrent changes cannot each see
+	// another owner remaining and together remove them all.
+	var exists bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT TRUE FROM organizations WHERE id = $1 FOR UPDATE`, orgID,
+	).Scan(&exists)
+	if err != nil {
+		return notFound(err)
+	}
+
+	res, err := tx.ExecContext(ctx, query, append([]any{orgID, userID}, args...)...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+
+	if !keepsOwner {
+		var owners int
+		err = tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM organization_members WHERE organization_id = $1 AND role = $2`,
+			orgID, OrgRoleOwner,
+		).Scan(&owners)
+		if err != nil {
+			return err
+		}
+		if owners == 0 {
+			return ErrLastOwner
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) CreateInvitation(ctx context.Context, inv *Invitation, tokenHash []byte) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO organization_invitations (organization_id, email, role, token_hash, invited_by, expires_at)
+		 VALUES ($1, LOWER($2), $3, $4, NULLIF($5, '')::uuid, $6)
+		 RETURNING id, created_at`,
+		inv.OrganizationID, inv.Email, inv.Role, tokenHash, inv.InvitedBy, inv.ExpiresAt,
+	).Scan(&inv.ID, &inv.CreatedAt)
+}
+
+func (s *service) ListInvitations(ctx context.Context, orgID string) ([]Invitation, error) {
+	if !validIDs(orgID) {
+		return nil, nil
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, organization_id, email, role, COALESCE(invited_by::text, ''), expires_at, created_at
+		 FROM organization_invitations
+		 WHERE organization_id = $1 AND accepted_at IS NULL AND expires_at > NOW()
+		 ORDER BY created_at DESC`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []Invitation
+	for rows.Next() {
+		var i Invitation
+		if err := rows.Scan(&i.ID, &i.OrganizationID, &i.Email, &i.Role, &i.InvitedBy, &i.ExpiresAt, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+	return invitations, rows.Err()
+}
+
+func (s *service) DeleteInvitation(ctx context.Context, orgID, id string) error {
+	if !validIDs(orgID, id) {
+		return ErrNotFound
+	}
+	return s.execOne(ctx,
+		`DELETE FROM organization_invitations WHERE organization_id = $1 AND id = $2`, orgID, id)
+}
+
+func (s *service) AcceptInvitation(ctx context.Context, tokenHash []byte, userID string) (*Membership, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id, orgID, role string
+	var invitee bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT i.id, i.organization_id, i.role, EXISTS (
+		     SELECT 1 FROM users u
+		     WHERE u.id = $2 AND u.email = i.email AND u.email_verified_at IS NOT NULL)
+		 FROM organization_invitations i
+		 WHERE i.token_hash = $1 AND i.accepted_at IS NULL AND i.expires_at > NOW()
+		 FOR UPDATE OF i`, tokenHash, userID,
+	).Scan(&id, &orgID, &role, &invitee)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load invitation: %w", err)
+	}
+	if !invitee {
+		return nil, ErrInvitationEmail
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE organization_invitations SET accepted_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("redeem invitation: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)
+		 ON CONFLICT (organization_id, user_id) DO NOTHING`,
+		orgID, userID, role)
+	if err != nil {
+		return nil, fmt.Errorf("insert member: %w", err)
+	}
+
+	m, err := scanMembership(tx.QueryRowContext(ctx,
+		`SELECT `+membershipColumns+`
+		 FROM organization_members m JOIN organizations o ON o.id = m.organization_id
+		 WHERE m.organization_id = $1 AND m.user_id = $2`, orgID, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganizations(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	owner, err := s.CreatePasswordUser(ctx, User{Email: "org-owner@example.com"}, "hash")
+	require.NoError(t, err)
+	invitee, err := s.CreatePasswordUser(ctx, User{Email: "org-invitee@example.com"}, "hash")
+	require.NoError(t, err)
+
+	org := &Organization{Name: "Acme", Slug: "acme"}
+
+	t.Run("creates an organization owned by its creator", func(t *testing.T) {
+		require.NoError(t, s.CreateOrganization(ctx, org, owner.ID))
+		assert.NotEmpty(t, org.ID)
+
+		m, err := s.GetMembership(ctx, org.ID, owner.ID)
+		require.NoError(t, err)
+		assert.Equal(t, OrgRoleOwner, m.Role)
+		assert.Equal(t, "acme", m.Organization.Slug)
+
+		_, err = s.GetMembership(ctx, "not-an-id", owner.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		err = s.CreateOrganization(ctx, &Organization{Name: "Other", Slug: "acme"}, owner.ID)
+		assert.ErrorIs(t, err, ErrSlugTaken)
+	})
+
+	t.Run("accepts an invitation once", func(t *testing.T) {
+		inv := &Invitation{OrganizationID: org.ID, Email: "Org-Invitee@example.com", Role: OrgRoleAdmin,
+			InvitedBy: owner.ID, ExpiresAt: time.Now().Add(time.Hour)}
+		require.NoError(t, s.CreateInvitation(ctx, inv, []byte("invite-hash")))
+
+		pending, err := s.ListInvitations(ctx, org.ID)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		assert.Equal(t, "org-invitee@example.com", pending[0].Email)
+
+		_, err = s.AcceptInvitation(ctx, []byte("invite-hash"), invitee.ID)
+		assert.ErrorIs(t, err, ErrInvitationEmail)
+		require.NoError(t, s.MarkEmailVerified(ctx, owner.ID))
+		_, err = s.AcceptInvitation(ctx, []byte("invite-hash"), owner.ID)
+		assert.ErrorIs(t, err, ErrInvitationEmail)
+
+		require.NoError(t, s.MarkEmailVerified(ctx, invitee.ID))
+		m, err := s.AcceptInvitation(ctx, []byte("invite-hash"), invitee.ID)
+		require.NoError(t, err)
+		assert.Equal(t, org.ID, m.Organization.ID)
+		assert.Equal(t, OrgRoleAdmin, m.Role)
+
+		_, err = s.AcceptInvitation(ctx, []byte("invite-hash"), invitee.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		members, err := s.ListOrganizationMembers(ctx, org.ID)
+		require.NoError(t, err)
+		require.Len(t, members, 2)
+		assert.Equal(t, owner.ID, members[0].User.ID)
+	})
+
+	t.Run("rejects expired invitations", func(t *testing.T) {
+		inv := &Invitation{OrganizationID: org.ID, Email: "late@example.com", Role: OrgRoleMember,
+			ExpiresAt: time.Now().Add(-time.Second)}
+		require.NoError(t, s.CreateInvitation(ctx, inv, []byte("expired-hash")))
+
+		_, err := s.AcceptInvitation(ctx, []byte("expired-hash"), invitee.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("keeps at least one owner", func(t *testing.T) {
+		assert.ErrorIs(t, s.SetMemberRole(ctx, org.ID, owner.ID, OrgRoleMember), ErrLastOwner)
+		assert.ErrorIs(t, s.RemoveMember(ctx, org.ID, owner.ID), ErrLastOwner)
+
+		require.NoError(t, s.SetMemberRole(ctx, org.ID, invitee.ID, OrgRoleOwner))
+		require.NoError(t, s.RemoveMember(ctx, org.ID, owner.ID))
+
+		_, err := s.GetMembership(ctx, org.ID, owner.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("lists a user's organizations", func(t *testing.T) {
+		list, err := s.ListUserOrganizations(ctx, invitee.ID)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, OrgRoleOwner, list[0].Role)
+	})
+}
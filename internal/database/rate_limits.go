@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimitRepository stores token buckets so that rate limits are shared
+// by every server instance. Time is taken from the database clock, so
+// instances with skewed clocks still agree.
+type RateLimitRepository interface {
+	// TakeRateLimitToken refills the bucket for key at rate tokens per
+	// second, up to capacity, and then takes one token if there is one. A
+	// new bucket starts full. It returns whether a token was taken and how
+	// many tokens are left.
+	TakeRateLimitToken(ctx context.Context, key string, capacity, rate float64) (allowed bool, tokens float64, err error)
+
+	// DeleteFullRateLimitBuckets removes buckets that have refilled
+	// completely, which behave the same as missing ones, and returns how
+	// many were removed.
+	DeleteFullRateLimitBuckets(ctx context.Context) (int64, error)
+}
+
+func (s *service) TakeRateLimitToken(ctx context.Context, key string, capacity, rate float64) (bool, float64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO rate_limit_buckets (key, tokens, updated_at, full_at)
+		 VALUES ($1, $2, clock_timestamp(), clock_timestamp())
+		 ON CONFLICT (key) DO NOTHING`, key, capacity)
+	if err != nil {
+		return false, 0, err
+	}
+
+	// clock_timestamp() rather than NOW(): a transaction that waited for
+	// the row lock must not count time from before the previous update.
+	var tokens, elapsed float64
+	err = tx.QueryRowContext(ctx,
+		`SELECT tokens, GREATEST(EXTRACT(EPOCH FROM clock_timestamp() - updated_at), 0)
+		 FROM rate_limit_buckets WHERE key = $1 FOR UPDATE`, key,
+	).Scan(&tokens, &elapsed)
+	if err != nil {
+		return false, 0, err
+	}
+
+	tokens = min(capacity, tokens+elapsed*rate)
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	refill := time.Duration((capacity - tokens) / rate * float64(time.Second))
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE rate_limit_buckets
+		 SET tokens = $2, updated_at = clock_timestamp(), full_at = clock_timestamp() + $3 * INTERVAL '1 microsecond'
+		 WHERE key = $1`, key, tokens, refill.Microseconds())
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed, tokens, tx.Commit()
+}
+
+func (s *service) DeleteFullRateLimitBuckets(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE full_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
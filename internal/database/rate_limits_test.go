@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimits(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	t.Run("takes tokens until the bucket is empty", func(t *testing.T) {
+		for want := 2.0; want >= 0; want-- {
+			allowed, tokens, err := s.TakeRateLimitToken(ctx, "empty", 3, 0.001)
+			require.NoError(t, err)
+			assert.True(t, allowed)
+			assert.InDelta(t, want, tokens, 0.1)
+		}
+
+		allowed, tokens, err := s.TakeRateLimitToken(ctx, "empty", 3, 0.001)
+		require.NoError(t, err)
+		assert.False(t, allowed)
+		assert.Less(t, tokens, 1.0)
+	})
+
+	t.Run("keeps buckets separate", func(t *testing.T) {
+		allowed, _, err := s.TakeRateLimitToken(ctx, "other", 1, 0.001)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	})
+
+	t.Run("refills over time", func(t *testing.T) {
+		allowed, _, err := s.TakeRateLimitToken(ctx, "refill", 1, 20)
+		require.NoError(t, err)
+		require.True(t, allowed)
+
+		time.Sleep(100 * time.Millisecond)
+
+		allowed, _, err = s.TakeRateLimitToken(ctx, "refill", 1, 20)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	})
+
+	t.Run("deletes full buckets", func(t *testing.T) {
+		_, _, err := s.TakeRateLimitToken(ctx, "full", 1, 1000)
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+
+		n, err := s.DeleteFullRateLimitBuckets(ctx)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, n, int64(1))
+
+		allowed, _, err := s.TakeRateLimitToken(ctx, "empty", 3, 0.001)
+		require.NoError(t, err)
+		assert.False(t, allowed, "buckets that are not full are kept")
+	})
+}
@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// AdminRole is the role the RBAC migration seeds with every permission.
+// It cannot be deleted, so that the administration API stays reachable.
+const AdminRole = "admin"
+
+var (
+	// ErrRoleExists is returned when creating a role whose name is taken.
+	ErrRoleExists = errors.New("database: role already exists")
+
+	// ErrProtectedRole is returned when deleting AdminRole.
+	ErrProtectedRole = errors.New("database: role cannot be deleted")
+
+	// ErrUnknownPermission is returned when granting a permission that is
+	// not defined in the permissions table.
+	ErrUnknownPermission = errors.New("database: unknown permission")
+)
+
+// Role is a named set of permissions that can be assigned to users.
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Permission is an action that roles can grant, such as "users:read".
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// RBACRepository persists roles, their permissions and role assignments.
+type RBACRepository interface {
+	// ListRoles returns every role with its permissions, by name.
+	ListRoles(ctx context.Context) ([]Role, error)
+
+	// CreateRole stores a new role and grants it role.Permissions. It
+	// returns ErrRoleExists if the name is taken and ErrUnknownPermission
+	// if a permission is not defined.
+	CreateRole(ctx context.Context, role *Role) error
+
+	// DeleteRole removes a role and all of its assignments. It returns
+	// ErrProtectedRole for AdminRole and ErrNotFound if there is no such
+	// role.
+	DeleteRole(ctx context.Context, name string) error
+
+	// ListPermissions returns every defined permission, by name.
+	ListPermissions(ctx context.Context) ([]Permission, error)
+
+	// AssignRole gives a user a role; assigning a role twice is not an
+	// error. It returns ErrNotFound if the user or role does not exist.
+	AssignRole(ctx context.Context, userID, role string) error
+
+	// UnassignRole takes a role away from a user. It returns ErrNotFound
+	// if the user does not have the role.
+	UnassignRole(ctx context.Context, userID, role string) error
+
+	// ListUserRoles returns the names of the user's roles.
+	ListUserRoles(ctx context.Context, userID string) ([]string, error)
+
+	// GetUserPermissions returns the permissions granted to the user by
+	// all of their roles.
+	GetUserPermissions(ctx context.Context, userID string) ([]string, error)
+}
+
+func (s *service) ListRoles(ctx context.Context) ([]Role, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT r.name, COALESCE(r.description, ''), r.created_at,
+		        COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		 FROM roles r LEFT JOIN role_permissions rp ON rp.role = r.name
+		 GROUP BY r.name ORDER BY r.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types := pgtype.NewMap()
+
+	var roles []Role
+	for rows.Next() {
+		var r Role
+		if err := rows.Scan(&r.Name, &r.Description, &r.CreatedAt, types.SQLScanner(&r.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+func (s *service) CreateRole(ctx context.Context, role *Role) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO roles (name, description) VALUES ($1, NULLIF($2, '')) RETURNING created_at`,
+		role.Name, role.Description,
+	).Scan(&role.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrRoleExists
+	}
+	if err != nil {
+		return fmt.Errorf("insert role: %w", err)
+	}
+
+	for _, p := range role.Permissions {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO role_permissions (role, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			role.Name, p)
+		if isForeignKeyViolation(err) {
+			return ErrUnknownPermission
+		}
+		if err != nil {
+			return fmt.Errorf("grant permission: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) DeleteRole(ctx context.Context, name string) error {
+	if name == AdminRole {
+		return ErrProtectedRole
+	}
+	return s.execOne(ctx, `DELETE FROM roles WHERE name = $1`, name)
+}
+
+func (s *service) ListPermissions(ctx context.Context) ([]Permission, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT name, COALESCE(description, '') FROM permissions ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var perms []Permission
+	for rows.Next() {
+		var p Permission
+		if err := rows.Scan(&p.Name, &p.Description); err != nil {
+			return nil, err
+		}
+		perms = append(perms, p)
+	}
+	return perms, rows.Err()
+}
+
+func (s *service) AssignRole(ctx context.Context, userID, role string) error {
+	if !validIDs(userID) {
+		return ErrNotFound
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO user_roles (user_id, role)
+		 SELECT id, $2 FROM users WHERE id = $1
+		 ON CONFLICT DO NOTHING`, userID, role)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// The insert matches no user when userID is unknown, and does nothing
+	// when the role is already assigned; tell the two apart.
+	var exists bool
+	err = s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM user_roles WHERE user_id = $1 AND role = $2)`, userID, role,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *service) UnassignRole(ctx context.Context, userID, role string) error {
+	if !validIDs(userID) {
+		return ErrNotFound
+	}
+	return s.execOne(ctx,
+		`DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, userID, role)
+}
+
+func (s *service) ListUserRoles(ctx context.Context, userID string) ([]string, error) {
+	if !validIDs(userID) {
+		return nil, nil
+	}
+	return s.queryStrings(ctx,
+		`SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`, userID)
+}
+
+func (s *service) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	return s.queryStrings(ctx,
+		`SELECT DISTINCT rp.permission
+		 FROM user_roles ur JOIN role_permissions rp ON rp.role = ur.role
+		 WHERE ur.user_id = $1 ORDER BY rp.permission`, userID)
+}
+
+// queryStrings runs a query that selects a single text column.
+func (s *service) queryStrings(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// isForeignKeyViolation reports whether err is a Postgres
+// foreign_key_violation.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
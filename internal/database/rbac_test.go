@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRBAC(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	user, err := s.CreatePasswordUser(ctx, User{Email: "rbac@example.com"}, "hash")
+	require.NoError(t, err)
+
+	t.Run("seeds an admin role with every permission", func(t *testing.T) {
+		roles, err := s.ListRoles(ctx)
+		require.NoError(t, err)
+		require.NotEmpty(t, roles)
+		assert.Equal(t, "admin", roles[0].Name)
+
+		perms, err := s.ListPermissions(ctx)
+		require.NoError(t, err)
+		assert.Len(t, roles[0].Permissions, len(perms))
+	})
+
+	t.Run("creates roles and rejects duplicates and unknown permissions", func(t *testing.T) {
+		role := &Role{Name: "support", Description: "Help desk", Permissions: []string{"users:read"}}
+		require.NoError(t, s.CreateRole(ctx, role))
+		assert.False(t, role.CreatedAt.IsZero())
+
+		assert.ErrorIs(t, s.CreateRole(ctx, &Role{Name: "support"}), ErrRoleExists)
+		assert.ErrorIs(t, s.CreateRole(ctx, &Role{Name: "bogus", Permissions: []string{"nope"}}), ErrUnknownPermission)
+	})
+
+	t.Run("assigns roles and resolves permissions", func(t *testing.T) {
+		require.NoError(t, s.AssignRole(ctx, user.ID, "support"))
+		require.NoError(t, s.AssignRole(ctx, user.ID, "support"))
+
+		roles, err := s.ListUserRoles(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"support"}, roles)
+
+		perms, err := s.GetUserPermissions(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"users:read"}, perms)
+	})
+
+	t.Run("returns ErrNotFound for unknown users and roles", func(t *testing.T) {
+		assert.ErrorIs(t, s.AssignRole(ctx, user.ID, "nope"), ErrNotFound)
+		assert.ErrorIs(t, s.AssignRole(ctx, "00000000-0000-0000-0000-000000000000", "support"), ErrNotFound)
+		assert.ErrorIs(t, s.AssignRole(ctx, "not-an-id", "support"), ErrNotFound)
+		assert.ErrorIs(t, s.UnassignRole(ctx, user.ID, "admin"), ErrNotFound)
+	})
+
+	t.Run("unassigns roles and deletes roles with their assignments", func(t *testing.T) {
+		require.NoError(t, s.AssignRole(ctx, user.ID, "admin"))
+		require.NoError(t, s.UnassignRole(ctx, user.ID, "admin"))
+
+		require.NoError(t, s.DeleteRole(ctx, "support"))
+		assert.ErrorIs(t, s.DeleteRole(ctx, "support"), ErrNotFound)
+		assert.ErrorIs(t, s.DeleteRole(ctx, AdminRole), ErrProtectedRole)
+
+		roles, err := s.ListUserRoles(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, roles)
+	})
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrTokenReused is returned when a refresh token that was already
+// exchanged is presented again. The token's whole family is revoked.
+var ErrTokenReused = errors.New("database: refresh token reused")
+
+// RefreshToken is a long-lived token that can be exchanged for a new
+// access token exactly once. Tokens descending from the same login share
+// a family ID. Only a hash of the token value is stored.
+type RefreshToken struct {
+	ID        string
+	UserID    string
+	FamilyID  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// RefreshTokenRepository persists hashed refresh tokens.
+type RefreshTokenRepository interface {
+	// CreateRefreshToken stores a refresh token starting a new family.
+	CreateRefreshToken(ctx context.Context, userID string, tokenHash []byte, expiresAt time.Time) (*RefreshToken, error)
+
+	// RotateRefreshToken marks the token with oldHash as used and stores
+	// newHash in the same family. It returns ErrNotFound when the old
+	// token is unknown, expired or revoked, and ErrTokenReused (after
+	// revoking the family) along with the old token when it was already
+	// used.
+	RotateRefreshToken(ctx context.Context, oldHash, newHash []byte, expiresAt time.Time) (*RefreshToken, error)
+
+	// RevokeUserRefreshTokens revokes every active refresh token of a user.
+	RevokeUserRefreshTokens(ctx context.Context, userID string) error
+}
+
+func (s *service) CreateRefreshToken(ctx context.Context, userID string, tokenHash []byte, expiresAt time.Time) (*RefreshToken, error) {
+	t := RefreshToken{UserID: userID, ExpiresAt: expiresAt}
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		 VALUES ($1, gen_random_uuid(), $2, $3)
+		 RETURNING id, family_id, created_at`,
+		userID, tokenHash, expiresAt,
+	).Scan(&t.ID, &t.FamilyID, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *service) RotateRefreshToken(ctx context.Context, oldHash, newHash []byte, expiresAt time.Time) (*RefreshToken, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		old       RefreshToken
+		usedAt    sql.NullTime
+		revokedAt sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, user_id, family_id, expires_at, used_at, revoked_at
+		 FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`, oldHash,
+	).Scan(&old.ID, &old.UserID, &old.FamilyID, &old.ExpiresAt, &usedAt, &revokedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if revokedAt.Valid || !old.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+
+	if usedAt.Valid {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE refresh_tokens SET revoked_at = NOW()
+			 WHERE family_id = $1 AND revoked_at IS NULL`, old.FamilyID)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return &old, ErrTokenReused
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, old.ID); err != nil {
+		return nil, err
+	}
+
+	next := RefreshToken{UserID: old.UserID, FamilyID: old.FamilyID, ExpiresAt: expiresAt}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING id, created_at`,
+		old.UserID, old.FamilyID, newHash, expiresAt,
+	).Scan(&next.ID, &next.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+func (s *service) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	return err
+}
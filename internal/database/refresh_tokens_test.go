@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshTokens(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	user, err := s.UpsertOAuthUser(ctx, User{Email: "refresh@example.com"},
+		Identity{Provider: "google", ProviderUserID: "g-refresh"})
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+
+	t.Run("rotates a token within its family", func(t *testing.T) {
+		first, err := s.CreateRefreshToken(ctx, user.ID, []byte("hash-a1"), expiresAt)
+		require.NoError(t, err)
+
+		next, err := s.RotateRefreshToken(ctx, []byte("hash-a1"), []byte("hash-a2"), expiresAt)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, next.UserID)
+		assert.Equal(t, first.FamilyID, next.FamilyID)
+	})
+
+	t.Run("revokes the family when a used token is presented", func(t *testing.T) {
+		_, err := s.CreateRefreshToken(ctx, user.ID, []byte("hash-b1"), expiresAt)
+		require.NoError(t, err)
+		_, err = s.RotateRefreshToken(ctx, []byte("hash-b1"), []byte("hash-b2"), expiresAt)
+		require.NoError(t, err)
+
+		_, err = s.RotateRefreshToken(ctx, []byte("hash-b1"), []byte("hash-b3"), expiresAt)
+		assert.ErrorIs(t, err, ErrTokenReused)
+
+		_, err = s.RotateRefreshToken(ctx, []byte("hash-b2"), []byte("hash-b4"), expiresAt)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("rejects unknown and expired tokens", func(t *testing.T) {
+		_, err := s.RotateRefreshToken(ctx, []byte("unknown"), []byte("hash-c2"), expiresAt)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = s.CreateRefreshToken(ctx, user.ID, []byte("hash-d1"), time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		_, err = s.RotateRefreshToken(ctx, []byte("hash-d1"), []byte("hash-d2"), expiresAt)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("revokes all of a user's tokens", func(t *testing.T) {
+		_, err := s.CreateRefreshToken(ctx, user.ID, []byte("hash-e1"), expiresAt)
+		require.NoError(t, err)
+		require.NoError(t, s.RevokeUserRefreshTokens(ctx, user.ID))
+
+		_, err = s.RotateRefreshToken(ctx, []byte("hash-e1"), []byte("hash-e2"), expiresAt)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
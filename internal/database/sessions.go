@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Session is a server-side session record. Data holds the encoded session
+// values; the browser only ever sees the signed session ID. PublicID
+// identifies the session in APIs without exposing the ID itself.
+type Session struct {
+	ID         string
+	PublicID   string
+	UserID     string
+	Provider   string
+	IP         string
+	UserAgent  string
+	Data       []byte
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+// SessionRepository persists server-side sessions.
+type SessionRepository interface {
+	// GetSession returns an unexpired session, or ErrNotFound.
+	GetSession(ctx context.Context, id string) (*Session, error)
+
+	// SaveSession creates or replaces the session with sess.ID. Created
+	// at, public ID and last seen are managed by the database.
+	SaveSession(ctx context.Context, sess *Session) error
+
+	// TouchSession records activity on a session from the given client.
+	TouchSession(ctx context.Context, id, ip, userAgent string) error
+
+	// DeleteSession removes a session. Deleting a missing session is not
+	// an error.
+	DeleteSession(ctx context.Context, id string) error
+
+	// DeleteExpiredSessions removes every expired session and returns how
+	// many were removed.
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
+
+	// ListUserSessions returns the user's unexpired sessions, most
+	// recently active first.
+	ListUserSessions(ctx context.Context, userID string) ([]Session, error)
+
+	// DeleteUserSession removes the user's session with the given public
+	// ID, or returns ErrNotFound if the user has no such session.
+	DeleteUserSession(ctx context.Context, userID, publicID string) error
+
+	// DeleteUserSessionsExcept removes all of the user's sessions other
+	// than the one with session ID keepID and returns how many were removed.
+	// An empty keepID removes every session of the user.
+	DeleteUserSessionsExcept(ctx context.Context, userID, keepID string) (int64, error)
+}
+
+const sessionColumns = `id, public_id, COALESCE(user_id::text, ''), COALESCE(provider, ''),
+	COALESCE(ip, ''), COALESCE(user_agent, ''), data, created_at, updated_at, last_seen_at, expires_at`
+
+func scanSession(row interface{ Scan(...any) error }) (*Session, error) {
+	var sess Session
+	err := row.Scan(&sess.ID, &sess.PublicID, &sess.UserID, &sess.Provider,
+		&sess.IP, &sess.UserAgent, &sess.Data, &sess.CreatedAt, &sess.UpdatedAt,
+		&sess.LastSeenAt, &sess.ExpiresAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &sess, nil
+}
+
+func (s *service) GetSession(ctx context.Context, id string) (*Session, error) {
+	return scanSession(s.db.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE id = $1 AND expires_at > NOW()`, id))
+}
+
+func (s *service) SaveSession(ctx context.Context, sess *Session) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO sessions (id, user_id, provider, ip, user_agent, data, expires_at)
+		 VALUES ($1, NULLIF($2, '')::uuid, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7)
+		 ON CONFLICT (id) DO UPDATE
+		 SET user_id = EXCLUDED.user_id,
+		     provider = EXCLUDED.provider,
+		     ip = COALESCE(EXCLUDED.ip, sessions.ip),
+		     user_agent = COALESCE(EXCLUDED.user_agent, sessions.user_agent),
+		     data = EXCLUDED.data,
+		     expires_at = EXCLUDED.expires_at,
+		     updated_at = NOW(),
+		     last_seen_at = NOW()`,
+		sess.ID, sess.UserID, sess.Provider, sess.IP, sess.UserAgent, sess.Data, sess.ExpiresAt,
+	)
+	return err
+}
+
+func (s *service) TouchSession(ctx context.Context, id, ip, userAgent string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE sessions
+		 SET last_seen_at = NOW(),
+		     ip = COALESCE(NULLIF($2, ''), ip),
+		     user_agent = COALESCE(NULLIF($3, ''), user_agent)
+		 WHERE id = $1`,
+		id, ip, userAgent,
+	)
+	return err
+}
+
+func (s *service) DeleteSession(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1`, id)
+	return err
+}
+
+func (s *service) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *service) ListUserSessions(ctx context.Context, userID string) ([]Session, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions
+		 WHERE user_id = $1 AND expires_at > NOW()
+		 ORDER BY last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Session
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *sess)
+	}
+	return list, rows.Err()
+}
+
+func (s *service) DeleteUserSession(ctx context.Context, userID, publicID string) error {
+	if !validIDs(publicID) {
+		return ErrNotFound
+	}
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM sessions WHERE user_id = $1 AND public_id = $2`, userID, publicID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *service) DeleteUserSessionsExcept(ctx context.Context, userID, keepID string) (int64, error) {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM sessions WHERE user_id = $1 AND id <> $2`, userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
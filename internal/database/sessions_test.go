@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	user, err := s.UpsertOAuthUser(ctx, User{Email: "sessions@example.com"},
+		Identity{Provider: "google", ProviderUserID: "g-sessions"})
+	require.NoError(t, err)
+
+	save := func(id string, expiresAt time.Time) {
+		t.Helper()
+		require.NoError(t, s.SaveSession(ctx, &Session{
+			ID: id, UserID: user.ID, Provider: "google", IP: "203.0.113.7",
+			UserAgent: "test-agent", Data: []byte("data"), ExpiresAt: expiresAt,
+		}))
+	}
+
+	t.Run("saves and loads a session", func(t *testing.T) {
+		save("session-a", time.Now().Add(time.Hour))
+
+		sess, err := s.GetSession(ctx, "session-a")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, sess.UserID)
+		assert.Equal(t, "google", sess.Provider)
+		assert.Equal(t, "203.0.113.7", sess.IP)
+		assert.NotEmpty(t, sess.PublicID)
+		assert.Equal(t, []byte("data"), sess.Data)
+	})
+
+	t.Run("does not return expired sessions", func(t *testing.T) {
+		save("session-expired", time.Now().Add(-time.Minute))
+
+		_, err := s.GetSession(ctx, "session-expired")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		n, err := s.DeleteExpiredSessions(ctx)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, n, int64(1))
+	})
+
+	t.Run("lists and revokes the user's sessions", func(t *testing.T) {
+		save("session-b", time.Now().Add(time.Hour))
+		save("session-c", time.Now().Add(time.Hour))
+
+		list, err := s.ListUserSessions(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, list, 3)
+
+		b, err := s.GetSession(ctx, "session-b")
+		require.NoError(t, err)
+		require.NoError(t, s.DeleteUserSession(ctx, user.ID, b.PublicID))
+		assert.ErrorIs(t, s.DeleteUserSession(ctx, user.ID, b.PublicID), ErrNotFound)
+
+		n, err := s.DeleteUserSessionsExcept(ctx, user.ID, "session-a")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		list, err = s.ListUserSessions(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, "session-a", list[0].ID)
+	})
+}
@@ -0,0 +1,432 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrNotFound is returned when a requested record does not exist.
+	ErrNotFound = errors.New("database: record not found")
+
+	// ErrEmailTaken is returned when a new user would reuse the email
+	// address of an existing account.
+	ErrEmailTaken = errors.New("database: email address already in use")
+
+	// ErrIdentityTaken is returned when linking a provider account that is
+	// already linked to a different user.
+	ErrIdentityTaken = errors.New("database: identity linked to another user")
+
+	// ErrLastLoginMethod is returned when removing an identity would leave
+	// the user with no way to sign in.
+	ErrLastLoginMethod = errors.New("database: cannot remove the last login method")
+)
+
+// User is an account known to this service. A user may sign in through
+// one or more identities.
+type User struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	AvatarURL string    `json:"avatar_url,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// EmailVerified reports whether the user has proven control of Email,
+	// either through a verification link or a provider that asserts it.
+	EmailVerified bool `json:"email_verified"`
+
+	// MFAEnabled reports whether signing in requires a second factor: an
+	// authenticator app or a registered passkey.
+	MFAEnabled bool `json:"mfa_enabled"`
+
+	// Disabled reports whether an administrator has disabled the account.
+	// Disabled users cannot sign in or use existing credentials.
+	Disabled bool `json:"disabled"`
+}
+
+// Identity links a user to an account at an external OAuth provider.
+type Identity struct {
+	ID             string
+	UserID         string
+	Provider       string
+	ProviderUserID string
+	Email          string
+	EmailVerified  bool // the provider asserts that Email is verified
+	AccessToken    string
+	RefreshToken   string
+	ExpiresAt      time.Time
+	RawData        map[string]interface{}
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// UserRepository persists users and their provider identities.
+type UserRepository interface {
+	// UpsertOAuthUser records a successful provider login. The identity is
+	// matched on provider and provider user ID; when it is unknown a new
+	// user is created from the given profile. It returns the stored user.
+	UpsertOAuthUser(ctx context.Context, profile User, identity Identity) (*User, error)
+
+	// GetUserByID returns the user with the given ID, or ErrNotFound.
+	GetUserByID(ctx context.Context, id string) (*User, error)
+
+	// GetUserByEmail returns the user with the given email address, or
+	// ErrNotFound.
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+
+	// ListUserIdentities returns the provider identities linked to a user,
+	// oldest first. Provider tokens are not loaded.
+	ListUserIdentities(ctx context.Context, userID string) ([]Identity, error)
+
+	// LinkIdentity attaches a provider identity to an existing user, or
+	// refreshes it when it is already linked to that user. It returns
+	// ErrIdentityTaken when the identity belongs to someone else.
+	LinkIdentity(ctx context.Context, userID string, identity Identity) error
+
+	// UnlinkIdentity removes one of the user's identities by ID. It
+	// returns ErrNotFound if the user has no such identity and
+	// ErrLastLoginMethod if the user would be left without an identity,
+	// password or passkey to sign in with.
+	UnlinkIdentity(ctx context.Context, userID, identityID string) error
+
+	// MarkEmailVerified flags the user's email address as verified.
+	MarkEmailVerified(ctx context.Context, userID string) error
+
+	// SetUserPassword replaces the user's password hash. It returns
+	// ErrNotFound when the user does not exist.
+	SetUserPassword(ctx context.Context, userID, passwordHash string) error
+
+	// CreatePasswordUser creates a user who signs in with a password. It
+	// returns ErrEmailTaken when the email address is already in use.
+	CreatePasswordUser(ctx context.Context, profile User, passwordHash string) (*User, error)
+
+	// GetUserPasswordHash returns the user with the given email address and
+	// their password hash, which is empty for OAuth-only accounts. It
+	// returns ErrNotFound when no user has that address.
+	GetUserPasswordHash(ctx context.Context, email string) (*User, string, error)
+}
+
+const userColumns = `id, COALESCE(email, ''), COALESCE(name, ''), COALESCE(avatar_url, ''), created_at, updated_at, email_verified_at IS NOT NULL,
+	(EXISTS (SELECT 1 FROM user_totp WHERE user_totp.user_id = users.id AND enabled_at IS NOT NULL)
+	 OR EXISTS (SELECT 1 FROM webauthn_credentials WHERE webauthn_credentials.user_id = users.id)),
+	disabled_at IS NOT NULL`
+
+func scanUser(row interface{ Scan(...any) error }, extra ...any) (*User, error) {
+	var u User
+	dest := append([]any{&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &u.UpdatedAt, &u.EmailVerified, &u.MFAEnabled, &u.Disabled}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, notFound(err)
+	}
+	return &u, nil
+}
+
+func (s *service) UpsertOAuthUser(ctx context.Context, profile User, identity Identity) (*User, error) {
+	rawData, err := json.Marshal(identity.RawData)
+	if err != nil {
+		return nil, fmt.Errorf("encode raw provider data: %w", err)
+	}
+
+	var expiresAt sql.NullTime
+	if !identity.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: identity.ExpiresAt, Valid: true}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRowContext(ctx,
+		`SELECT user_id FROM identities WHERE provider = $1 AND provider_user_id = $2 FOR UPDATE`,
+		identity.Provider, identity.ProviderUserID,
+	).Scan(&userID)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = tx.QueryRowContext(ctx,
+			`INSERT INTO users (email, name, avatar_url, email_verified_at)
+			 VALUES (NULLIF(LOWER($1), ''), NULLIF($2, ''), NULLIF($3, ''),
+			         CASE WHEN $4 AND LOWER($1) = LOWER($5) THEN NOW() END)
+			 RETURNING id`,
+			profile.Email, profile.Name, profile.AvatarURL, identity.EmailVerified, identity.Email,
+		).Scan(&userID)
+		if isUniqueViolation(err) {
+			return nil, ErrEmailTaken
+		}
+		if err != nil {
+			return nil, fmt.Errorf("insert user: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO identities (user_id, provider, provider_user_id, email, access_token, refresh_token, expires_at, raw_data)
+			 VALUES ($1, $2, $3, NULLIF(LOWER($4), ''), NULLIF($5, ''), NULLIF($6, ''), $7, $8)`,
+			userID, identity.Provider, identity.ProviderUserID, identity.Email,
+			identity.AccessToken, identity.RefreshToken, expiresAt, rawData,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("insert identity: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("lookup identity: %w", err)
+	default:
+		_, err = tx.ExecContext(ctx,
+			`UPDATE identities
+			 SET email = NULLIF(LOWER($3), ''),
+			     access_token = NULLIF($4, ''),
+			     refresh_token = COALESCE(NULLIF($5, ''), refresh_token),
+			     expires_at = $6,
+			     raw_data = $7,
+			     updated_at = NOW()
+			 WHERE provider = $1 AND provider_user_id = $2`,
+			identity.Provider, identity.ProviderUserID, identity.Email,
+			identity.AccessToken, identity.RefreshToken, expiresAt, rawData,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("update identity: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE users
+			 SET name = COALESCE(NULLIF($2, ''), name),
+			     avatar_url = COALESCE(NULLIF($3, ''), avatar_url),
+			     email_verified_at = COALESCE(email_verified_at,
+			         CASE WHEN $4 AND email = LOWER($5) THEN NOW() END),
+			     updated_at = NOW()
+			 WHERE id = $1`,
+			userID, profile.Name, profile.AvatarURL, identity.EmailVerified, identity.Email,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("update user: %w", err)
+		}
+	}
+
+	user, err := scanUser(tx.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE id = $1`, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *service) GetUserByID(ctx context.Context, id string) (*User, error) {
+	if !validIDs(id) {
+		return nil, ErrNotFound
+	}
+	return scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+func (s *service) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE email = LOWER($1)`, email))
+}
+
+func (s *service) ListUserIdentities(ctx context.Context, userID string) ([]Identity, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, provider, provider_user_id, COALESCE(email, ''), created_at, updated_at
+		 FROM identities WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []Identity
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.ProviderUserID, &i.Email, &i.CreatedAt, &i.UpdatedAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+func (s *service) LinkIdentity(ctx context.Context, userID string, identity Identity) error {
+	rawData, err := json.Marshal(identity.RawData)
+	if err != nil {
+		return fmt.Errorf("encode raw provider data: %w", err)
+	}
+
+	var expiresAt sql.NullTime
+	if !identity.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: identity.ExpiresAt, Valid: true}
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO identities (user_id, provider, provider_user_id, email, access_token, refresh_token, expires_at, raw_data)
+		 VALUES ($1, $2, $3, NULLIF(LOWER($4), ''), NULLIF($5, ''), NULLIF($6, ''), $7, $8)
+		 ON CONFLICT (provider, provider_user_id) DO UPDATE
+		 SET email = EXCLUDED.email,
+		     access_token = EXCLUDED.access_token,
+		     refresh_token = COALESCE(EXCLUDED.refresh_token, identities.refresh_token),
+		     expires_at = EXCLUDED.expires_at,
+		     raw_data = EXCLUDED.raw_data,
+		     updated_at = NOW()
+		 WHERE identities.user_id = EXCLUDED.user_id`,
+		userID, identity.Provider, identity.ProviderUserID, identity.Email,
+		identity.AccessToken, identity.RefreshToken, expiresAt, rawData,
+	)
+	if err != nil {
+		return fmt.Errorf("link identity: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrIdentityTaken
+	}
+	return nil
+}
+
+func (s *service) UnlinkIdentity(ctx context.Context, userID, identityID string) error {
+	if !validIDs(identityID) {
+		return ErrNotFound
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hasPassword, err := lockLoginMethods(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM identities WHERE user_id = $1 AND id = $2`, userID, identityID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+
+	if err := loginMethodRemains(ctx, tx, userID, hasPassword); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockLoginMethods locks the user's row so that concurrent removals of
+// identities and passkeys cannot each see another login method remaining
+// and together remove them all. It reports whether the user has a password.
+func lockLoginMethods(ctx context.Context, tx *sql.Tx, userID string) (hasPassword bool, err error) {
+	err = tx.QueryRowContext(ctx,
+		`SELECT password_hash IS NOT NULL FROM users WHERE id = $1 FOR UPDATE`, userID,
+	).Scan(&hasPassword)
+	return hasPassword, notFound(err)
+}
+
+// loginMethodRemains returns ErrLastLoginMethod if the user is left without
+// an identity, passkey or password to sign in with.
+func loginMethodRemains(ctx context.Context, tx *sql.Tx, userID string, hasPassword bool) error {
+	var remaining int
+	err := tx.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM identities WHERE user_id = $1)
+		      + (SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = $1)`, userID,
+	).Scan(&remaining)
+	if err != nil {
+		return err
+	}
+	if remaining == 0 && !hasPassword {
+		return ErrLastLoginMethod
+	}
+	return nil
+}
+
+func (s *service) CreatePasswordUser(ctx context.Context, profile User, passwordHash string) (*User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx,
+		`INSERT INTO users (email, name, password_hash)
+		 VALUES (LOWER($1), NULLIF($2, ''), $3)
+		 RETURNING `+userColumns,
+		profile.Email, profile.Name, passwordHash,
+	))
+	if isUniqueViolation(err) {
+		return nil, ErrEmailTaken
+	}
+	return user, err
+}
+
+func (s *service) GetUserPasswordHash(ctx context.Context, email string) (*User, string, error) {
+	var hash sql.NullString
+	user, err := scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+`, password_hash FROM users WHERE email = LOWER($1)`, email,
+	), &hash)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, hash.String, nil
+}
+
+func (s *service) MarkEmailVerified(ctx context.Context, userID string) error {
+	return s.execOne(ctx,
+		`UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		 WHERE id = $1`, userID)
+}
+
+func (s *service) SetUserPassword(ctx context.Context, userID, passwordHash string) error {
+	return s.execOne(ctx,
+		`UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`, userID, passwordHash)
+}
+
+// execOne runs a statement that targets a single row and returns ErrNotFound
+// when no row matched.
+func (s *service) execOne(ctx context.Context, query string, args ...any) error {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// validIDs reports whether every id is a UUID in its canonical form. IDs
+// that come from URLs are checked before querying, so that a malformed one
+// is simply not found rather than a Postgres cast error, and the query can
+// still compare the uuid column directly and use its index.
+func validIDs(ids ...string) bool {
+	for _, id := range ids {
+		if len(id) != 36 || uuid.Validate(id) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// notFound translates sql.ErrNoRows into ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestService opens a dedicated connection with all migrations applied,
+// so tests do not depend on the shared instance that TestClose shuts down.
+func newTestService(t *testing.T) *service {
+	t.Helper()
+
+	db, err := sql.Open("pgx", connString(testConfig))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	s := &service{db: db, name: testConfig.Name, schema: testConfig.Schema}
+	_, err = s.MigrateUp(context.Background())
+	require.NoError(t, err)
+	return s
+}
+
+func TestUpsertOAuthUser(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	t.Run("creates a user on first login", func(t *testing.T) {
+		user, err := s.UpsertOAuthUser(ctx,
+			User{Email: "First@Example.com", Name: "First"},
+			Identity{Provider: "google", ProviderUserID: "g-1", Email: "First@Example.com", AccessToken: "token"},
+		)
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, user.ID)
+		assert.Equal(t, "first@example.com", user.Email)
+		assert.Equal(t, "First", user.Name)
+	})
+
+	t.Run("reuses the user for a known identity", func(t *testing.T) {
+		first, err := s.UpsertOAuthUser(ctx,
+			User{Email: "repeat@example.com", Name: "Before"},
+			Identity{Provider: "github", ProviderUserID: "gh-1"},
+		)
+		require.NoError(t, err)
+
+		second, err := s.UpsertOAuthUser(ctx,
+			User{Email: "repeat@example.com", Name: "After"},
+			Identity{Provider: "github", ProviderUserID: "gh-1"},
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, first.ID, second.ID)
+		assert.Equal(t, "After", second.Name)
+	})
+
+	t.Run("rejects a new identity with a taken email", func(t *testing.T) {
+		_, err := s.UpsertOAuthUser(ctx,
+			User{Email: "taken@example.com"},
+			Identity{Provider: "google", ProviderUserID: "g-taken"},
+		)
+		require.NoError(t, err)
+
+		_, err = s.UpsertOAuthUser(ctx,
+			User{Email: "taken@example.com"},
+			Identity{Provider: "github", ProviderUserID: "gh-taken"},
+		)
+		assert.ErrorIs(t, err, ErrEmailTaken)
+	})
+}
+
+func TestPasswordUsers(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	t.Run("creates a user and returns the password hash by email", func(t *testing.T) {
+		created, err := s.CreatePasswordUser(ctx, User{Email: "Local@Example.com", Name: "Local"}, "hash")
+		require.NoError(t, err)
+		assert.Equal(t, "local@example.com", created.Email)
+
+		user, hash, err := s.GetUserPasswordHash(ctx, "LOCAL@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, user.ID)
+		assert.Equal(t, "hash", hash)
+	})
+
+	t.Run("rejects a taken email", func(t *testing.T) {
+		_, err := s.UpsertOAuthUser(ctx, User{Email: "oauth-only@example.com"},
+			Identity{Provider: "google", ProviderUserID: "g-oauth-only"})
+		require.NoError(t, err)
+
+		_, err = s.CreatePasswordUser(ctx, User{Email: "oauth-only@example.com"}, "hash")
+		assert.ErrorIs(t, err, ErrEmailTaken)
+
+		_, hash, err := s.GetUserPasswordHash(ctx, "oauth-only@example.com")
+		require.NoError(t, err)
+		assert.Empty(t, hash)
+	})
+
+	t.Run("returns ErrNotFound for an unknown email", func(t *testing.T) {
+		_, _, err := s.GetUserPasswordHash(ctx, "nobody@example.com")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("replaces the password hash", func(t *testing.T) {
+		user, err := s.CreatePasswordUser(ctx, User{Email: "change@example.com"}, "old-hash")
+		require.NoError(t, err)
+
+		require.NoError(t, s.SetUserPassword(ctx, user.ID, "new-hash"))
+
+		_, hash, err := s.GetUserPasswordHash(ctx, "change@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "new-hash", hash)
+
+		err = s.SetUserPassword(ctx, "00000000-0000-0000-0000-000000000000", "hash")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestEmailVerification(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	t.Run("trusts a provider-verified email on first login", func(t *testing.T) {
+		user, err := s.UpsertOAuthUser(ctx, User{Email: "verified@example.com"},
+			Identity{Provider: "google", ProviderUserID: "g-verified", Email: "verified@example.com", EmailVerified: true})
+		require.NoError(t, err)
+		assert.True(t, user.EmailVerified)
+	})
+
+	t.Run("leaves unverified emails unverified until marked", func(t *testing.T) {
+		user, err := s.UpsertOAuthUser(ctx, User{Email: "unverified@example.com"},
+			Identity{Provider: "github", ProviderUserID: "gh-unverified", Email: "unverified@example.com"})
+		require.NoError(t, err)
+		assert.False(t, user.EmailVerified)
+
+		require.NoError(t, s.MarkEmailVerified(ctx, user.ID))
+
+		user, err = s.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.True(t, user.EmailVerified)
+	})
+
+	t.Run("returns ErrNotFound when marking an unknown user", func(t *testing.T) {
+		err := s.MarkEmailVerified(ctx, "00000000-0000-0000-0000-000000000000")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestAccountLinking(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	user, err := s.UpsertOAuthUser(ctx, User{Email: "linked@example.com"},
+		Identity{Provider: "google", ProviderUserID: "g-linked"})
+	require.NoError(t, err)
+
+	t.Run("links another provider to the same user", func(t *testing.T) {
+		require.NoError(t, s.LinkIdentity(ctx, user.ID,
+			Identity{Provider: "github", ProviderUserID: "gh-linked", Email: "linked@example.com"}))
+
+		again, err := s.UpsertOAuthUser(ctx, User{}, Identity{Provider: "github", ProviderUserID: "gh-linked"})
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, again.ID)
+
+		identities, err := s.ListUserIdentities(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, identities, 2)
+		assert.Equal(t, "google", identities[0].Provider)
+		assert.Equal(t, "github", identities[1].Provider)
+	})
+
+	t.Run("relinking to the same user is a no-op", func(t *testing.T) {
+		assert.NoError(t, s.LinkIdentity(ctx, user.ID, Identity{Provider: "github", ProviderUserID: "gh-linked"}))
+	})
+
+	t.Run("rejects an identity owned by another user", func(t *testing.T) {
+		other, err := s.CreatePasswordUser(ctx, User{Email: "other@example.com"}, "hash")
+		require.NoError(t, err)
+
+		err = s.LinkIdentity(ctx, other.ID, Identity{Provider: "google", ProviderUserID: "g-linked"})
+		assert.ErrorIs(t, err, ErrIdentityTaken)
+	})
+
+	t.Run("unlinks all but the last login method", func(t *testing.T) {
+		identities, err := s.ListUserIdentities(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, identities, 2)
+
+		require.NoError(t, s.UnlinkIdentity(ctx, user.ID, identities[0].ID))
+
+		err = s.UnlinkIdentity(ctx, user.ID, identities[1].ID)
+		assert.ErrorIs(t, err, ErrLastLoginMethod)
+
+		remaining, err := s.ListUserIdentities(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Len(t, remaining, 1)
+	})
+
+	t.Run("allows removing the last identity of a password user", func(t *testing.T) {
+		local, err := s.CreatePasswordUser(ctx, User{Email: "local-linked@example.com"}, "hash")
+		require.NoError(t, err)
+		require.NoError(t, s.LinkIdentity(ctx, local.ID, Identity{Provider: "google", ProviderUserID: "g-local"}))
+
+		identities, err := s.ListUserIdentities(ctx, local.ID)
+		require.NoError(t, err)
+		require.Len(t, identities, 1)
+
+		assert.NoError(t, s.UnlinkIdentity(ctx, local.ID, identities[0].ID))
+	})
+
+	t.Run("returns ErrNotFound for an unknown identity", func(t *testing.T) {
+		err := s.UnlinkIdentity(ctx, user.ID, "not-an-id")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("finds users by email", func(t *testing.T) {
+		found, err := s.GetUserByEmail(ctx, "LINKED@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, found.ID)
+
+		_, err = s.GetUserByEmail(ctx, "nobody@example.com")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("returns ErrNotFound for a malformed user id", func(t *testing.T) {
+		_, err := s.GetUserByID(ctx, "not-an-id")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// WebAuthnCredential is a passkey or security key registered by a user.
+// Data holds the JSON-encoded credential (public key, sign count and
+// flags) as produced by the WebAuthn library.
+type WebAuthnCredential struct {
+	ID           string
+	UserID       string
+	CredentialID []byte
+	Name         string
+	Data         []byte
+	CreatedAt    time.Time
+	LastUsedAt   time.Time
+}
+
+// WebAuthnRepository persists WebAuthn credentials.
+type WebAuthnRepository interface {
+	// ListWebAuthnCredentials returns the user's credentials, oldest first.
+	ListWebAuthnCredentials(ctx context.Context, userID string) ([]WebAuthnCredential, error)
+
+	// CreateWebAuthnCredential stores a newly registered credential and
+	// fills in its ID and CreatedAt.
+	CreateWebAuthnCredential(ctx context.Context, cred *WebAuthnCredential) error
+
+	// UpdateWebAuthnCredential replaces a credential's data after it was
+	// used to sign in and records the time of use.
+	UpdateWebAuthnCredential(ctx context.Context, credentialID, data []byte) error
+
+	// DeleteWebAuthnCredential removes one of the user's credentials by ID.
+	// It returns ErrNotFound if the user has no such credential and
+	// ErrLastLoginMethod if the user would be left without an identity,
+	// password or passkey to sign in with.
+	DeleteWebAuthnCredential(ctx context.Context, userID, id string) error
+}
+
+func (s *service) ListWebAuthnCredentials(ctx context.Context, userID string) ([]WebAuthnCredential, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, credential_id, COALESCE(name, ''), data, created_at, last_used_at
+		 FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []WebAuthnCredential
+	for rows.Next() {
+		var (
+			c        WebAuthnCredential
+			lastUsed sql.NullTime
+		)
+		if err := rows.Scan(&c.ID, &c.UserID, &c.CredentialID, &c.Name, &c.Data, &c.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		c.LastUsedAt = lastUsed.Time
+		creds = append(creds, c)
+	}
+	return creds, rows.Err()
+}
+
+func (s *service) CreateWebAuthnCredential(ctx context.Context, cred *WebAuthnCredential) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO webauthn_credentials (user_id, credential_id, name, data)
+		 VALUES ($1, $2, NULLIF($3, ''), $4)
+		 RETURNING id, created_at`,
+		cred.UserID, cred.CredentialID, cred.Name, cred.Data,
+	).Scan(&cred.ID, &cred.CreatedAt)
+}
+
+func (s *service) UpdateWebAuthnCredential(ctx context.Context, credentialID, data []byte) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE webauthn_credentials SET data = $2, last_used_at = NOW() WHERE credential_id = $1`,
+		credentialID, data)
+	return err
+}
+
+func (s *service) DeleteWebAuthnCredential(ctx context.Context, userID, id string) error {
+	if !validIDs(id) {
+		return ErrNotFound
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hasPassword, err := lockLoginMethods(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM webauthn_credentials WHERE user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+
+	if err := loginMethodRemains(ctx, tx, userID, hasPassword); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebAuthnCredentials(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	user, err := s.CreatePasswordUser(ctx, User{Email: "passkey@example.com"}, "hash")
+	require.NoError(t, err)
+
+	cred := &WebAuthnCredential{UserID: user.ID, CredentialID: []byte("cred-1"), Name: "Laptop", Data: []byte(`{"signCount": 0}`)}
+
+	t.Run("stores a credential and enables MFA", func(t *testing.T) {
+		require.NoError(t, s.CreateWebAuthnCredential(ctx, cred))
+		assert.NotEmpty(t, cred.ID)
+
+		list, err := s.ListWebAuthnCredentials(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, "Laptop", list[0].Name)
+		assert.Equal(t, []byte("cred-1"), list[0].CredentialID)
+		assert.True(t, list[0].LastUsedAt.IsZero())
+
+		got, err := s.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.True(t, got.MFAEnabled)
+	})
+
+	t.Run("updates a credential after use", func(t *testing.T) {
+		require.NoError(t, s.UpdateWebAuthnCredential(ctx, []byte("cred-1"), []byte(`{"signCount": 1}`)))
+
+		list, err := s.ListWebAuthnCredentials(ctx, user.ID)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"signCount": 1}`, string(list[0].Data))
+		assert.False(t, list[0].LastUsedAt.IsZero())
+	})
+
+	t.Run("deletes only the user's own credentials", func(t *testing.T) {
+		other, err := s.CreatePasswordUser(ctx, User{Email: "other-passkey@example.com"}, "hash")
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, s.DeleteWebAuthnCredential(ctx, other.ID, cred.ID), ErrNotFound)
+		require.NoError(t, s.DeleteWebAuthnCredential(ctx, user.ID, cred.ID))
+
+		list, err := s.ListWebAuthnCredentials(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, list)
+	})
+
+	t.Run("keeps the last login method after unlinking", func(t *testing.T) {
+		oauth, err := s.UpsertOAuthUser(ctx, User{Email: "oauth-passkey@example.com"}, Identity{Provider: "google", ProviderUserID: "g-passkey"})
+		require.NoError(t, err)
+		passkey := &WebAuthnCredential{UserID: oauth.ID, CredentialID: []byte("cred-2"), Data: []byte(`{}`)}
+		require.NoError(t, s.CreateWebAuthnCredential(ctx, passkey))
+
+		identities, err := s.ListUserIdentities(ctx, oauth.ID)
+		require.NoError(t, err)
+		require.NoError(t, s.UnlinkIdentity(ctx, oauth.ID, identities[0].ID))
+
+		err = s.DeleteWebAuthnCredential(ctx, oauth.ID, passkey.ID)
+		assert.ErrorIs(t, err, ErrLastLoginMethod)
+
+		list, err := s.ListWebAuthnCredentials(ctx, oauth.ID)
+		require.NoError(t, err)
+		assert.Len(t, list, 1)
+	})
+}
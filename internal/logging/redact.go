@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces sensitive values in the log.
+const redacted = "[REDACTED]"
+
+// sensitiveKeyParts mark attributes whose values are never logged.
+var sensitiveKeyParts = []string{"password", "secret", "token", "authorization", "cookie", "otp", "credential"}
+
+// sensitiveValues find secrets inside otherwise harmless strings, such as
+// a URL with a token in its query or an error that quotes a header. The
+// first group of each match is kept.
+var sensitiveValues = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)([?&](?:token|code|state|password|secret|access_token|refresh_token|id_token)=)[^&#\s"]+`),
+	regexp.MustCompile(`(?i)(bearer\s+)[^\s"]+`),
+	regexp.MustCompile(`()eyJ[\w-]*\.[\w-]+\.[\w-]*`),
+}
+
+// redact is the ReplaceAttr hook of every handler. It hides attributes
+// with sensitive names entirely and scrubs secrets out of string and error
+// values, including the message.
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	var s string
+	switch v := a.Value.Any().(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	default:
+		return a
+	}
+	if scrubbed := redactString(s); scrubbed != s {
+		return slog.String(a.Key, scrubbed)
+	}
+	return a
+}
+
+// redactString removes tokens, bearer credentials and sensitive query
+// parameters from s.
+func redactString(s string) string {
+	for _, re := range sensitiveValues {
+		s = re.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
+
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if key == "code" || strings.HasSuffix(key, "_key") || strings.HasSuffix(key, "-key") {
+		return true
+	}
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+// Package mail sends transactional email such as verification links.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromConfig returns the mailer selected by cfg.Driver:
+//
+//   - "smtp" sends through cfg.SMTPHost:cfg.SMTPPort, authenticating with
+//     cfg.SMTPUsername and cfg.SMTPPassword when set.
+//   - "log" (the default) writes messages to cfg.LogFile, or to stdout
+//     when it is empty. Use it for local development and tests.
+func NewFromConfig(cfg config.Mail) (Mailer, error) {
+	from := cfg.From
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("mail: SMTP_HOST is required when MAIL_DRIVER=smtp")
+		}
+		port := cfg.SMTPPort
+		if port == 0 {
+			port = 587
+		}
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     port,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     from,
+		}, nil
+	case "", "log":
+		var w io.Writer = os.Stdout
+		if cfg.LogFile != "" {
+			f, err := os.OpenFile(cfg.LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+			if err != nil {
+				return nil, fmt.Errorf("mail: open MAIL_LOG_FILE: %w", err)
+			}
+			w = f
+		}
+		return NewLogMailer(w, from), nil
+	default:
+		return nil, fmt.Errorf("mail: unknown MAIL_DRIVER %q", cfg.Driver)
+	}
+}
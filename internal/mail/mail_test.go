@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+func TestLogMailer(t *testing.T) {
+	t.Run("should write the message", func(t *testing.T) {
+		var buf bytes.Buffer
+		m := NewLogMailer(&buf, "app@example.com")
+
+		require.NoError(t, m.Send(context.Background(), Message{
+			To: "jane@example.com", Subject: "Hello", Body: "Body text",
+		}))
+
+		out := buf.String()
+		assert.Contains(t, out, "From: app@example.com")
+		assert.Contains(t, out, "To: jane@example.com")
+		assert.Contains(t, out, "Subject: Hello")
+		assert.Contains(t, out, "Body text")
+	})
+}
+
+func TestSMTPMailerFormat(t *testing.T) {
+	t.Run("should render headers and CRLF line endings", func(t *testing.T) {
+		m := &SMTPMailer{From: "app@example.com"}
+
+		raw := string(m.format(Message{To: "jane@example.com", Subject: "Hi", Body: "line 1\nline 2"}))
+
+		assert.True(t, strings.HasPrefix(raw, "From: app@example.com\r\nTo: jane@example.com\r\nSubject: Hi\r\n"))
+		assert.True(t, strings.HasSuffix(raw, "\r\n\r\nline 1\r\nline 2"))
+	})
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	t.Run("should give up on a server that does not answer", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { ln.Close() })
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			if conn, err := ln.Accept(); err == nil {
+				accepted <- conn
+			}
+		}()
+
+		addr := ln.Addr().(*net.TCPAddr)
+		m := &SMTPMailer{Host: "127.0.0.1", Port: addr.Port, From: "app@example.com", Timeout: 50 * time.Millisecond}
+
+		start := time.Now()
+		err = m.Send(context.Background(), Message{To: "jane@example.com", Subject: "Hi"})
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 5*time.Second)
+		(<-accepted).Close()
+	})
+}
+
+func TestNewFromConfig(t *testing.T) {
+	t.Run("should default to the log mailer", func(t *testing.T) {
+		m, err := NewFromConfig(config.Mail{})
+		require.NoError(t, err)
+		assert.IsType(t, &LogMailer{}, m)
+	})
+
+	t.Run("should append to the log file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "mail.log")
+
+		m, err := NewFromConfig(config.Mail{Driver: "log", LogFile: path})
+		require.NoError(t, err)
+		require.NoError(t, m.Send(context.Background(), Message{To: "jane@example.com", Subject: "Hi"}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "To: jane@example.com")
+	})
+
+	t.Run("should configure SMTP", func(t *testing.T) {
+		m, err := NewFromConfig(config.Mail{
+			Driver:   "smtp",
+			From:     "app@example.com",
+			SMTPHost: "smtp.example.com",
+			SMTPPort: 2525,
+		})
+		require.NoError(t, err)
+		smtpMailer, ok := m.(*SMTPMailer)
+		require.True(t, ok)
+		assert.Equal(t, "smtp.example.com", smtpMailer.Host)
+		assert.Equal(t, 2525, smtpMailer.Port)
+		assert.Equal(t, "app@example.com", smtpMailer.From)
+	})
+
+	t.Run("should reject incomplete configuration", func(t *testing.T) {
+		_, err := NewFromConfig(config.Mail{Driver: "smtp"})
+		assert.Error(t, err)
+
+		_, err = NewFromConfig(config.Mail{Driver: "carrier-pigeon"})
+		assert.Error(t, err)
+	})
+}
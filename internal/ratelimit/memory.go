@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxIdleBuckets is how many buckets MemoryStore holds before it drops
+// those that have refilled.
+const maxIdleBuckets = 10000
+
+// MemoryStore keeps buckets in memory, so each server instance counts
+// requests separately.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if len(s.buckets) > maxIdleBuckets {
+		for k, b := range s.buckets {
+			if !now.Before(b.fullAt) {
+				delete(s.buckets, k)
+			}
+		}
+	}
+
+	capacity := float64(limit.Requests)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updatedAt: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = min(capacity, b.tokens+now.Sub(b.updatedAt).Seconds()*limit.rate())
+	b.updatedAt = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	res := newResult(limit, allowed, b.tokens)
+	b.fullAt = now.Add(res.Reset)
+	return res, nil
+}
@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// PGStore keeps buckets in Postgres so that every server instance shares
+// the same limits.
+type PGStore struct {
+	db database.RateLimitRepository
+}
+
+// NewPGStore returns a store that persists buckets through db.
+func NewPGStore(db database.RateLimitRepository) *PGStore {
+	return &PGStore{db: db}
+}
+
+func (s *PGStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	allowed, tokens, err := s.db.TakeRateLimitToken(ctx, key, float64(limit.Requests), limit.rate())
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(limit, allowed, tokens), nil
+}
+
+// Cleanup deletes buckets that have refilled every interval until ctx is
+// done.
+func (s *PGStore) Cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.db.DeleteFullRateLimitBuckets(ctx); err != nil {
+				slog.ErrorContext(ctx, "Failed to clean up rate limits", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package ratelimit implements token-bucket rate limits with pluggable
+// storage: in memory for a single instance, or in Postgres so that several
+// instances share their counts.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limit allows bursts of up to Requests requests, refilled evenly so that
+// Requests more are allowed every Period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// PerMinute allows n requests a minute.
+func PerMinute(n int) Limit {
+	return Limit{Requests: n, Period: time.Minute}
+}
+
+// PerHour allows n requests an hour.
+func PerHour(n int) Limit {
+	return Limit{Requests: n, Period: time.Hour}
+}
+
+// rate returns how many tokens are added to the bucket per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed bool
+	Limit   Limit
+
+	// Remaining is how many more requests would be allowed right now.
+	Remaining int
+
+	// Reset is how long until the bucket is full again, and RetryAfter how
+	// long until the next request would be allowed.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// newResult describes a bucket of limit left with tokens after a take.
+func newResult(limit Limit, allowed bool, tokens float64) Result {
+	rate := limit.rate()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(limit.Requests) - tokens) / rate * float64(time.Second)),
+	}
+	if tokens < 1 {
+		res.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return res
+}
+
+// Store keeps token buckets.
+type Store interface {
+	// Take refills the bucket for key according to limit and takes one
+	// token from it if there is one.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// SetHeaders describes res in the RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset and RateLimit-Policy headers, and in Retry-After when the
+// request was rejected. Durations are rounded up to whole seconds.
+func SetHeaders(h http.Header, res Result) {
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit.Requests))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", res.Limit.Requests, seconds(res.Limit.Period)))
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(max(seconds(res.RetryAfter), 1)))
+	}
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
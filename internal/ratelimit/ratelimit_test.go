@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	newStore := func() (*MemoryStore, *time.Time) {
+		s := NewMemoryStore()
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		s.now = func() time.Time { return now }
+		return s, &now
+	}
+
+	t.Run("should allow a burst and then reject", func(t *testing.T) {
+		s, _ := newStore()
+		limit := PerMinute(3)
+
+		for want := 2; want >= 0; want-- {
+			res, err := s.Take(ctx, "key", limit)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+			assert.Equal(t, want, res.Remaining)
+		}
+
+		res, err := s.Take(ctx, "key", limit)
+		require.NoError(t, err)
+		assert.False(t, res.Allowed)
+		assert.Equal(t, 0, res.Remaining)
+		assert.Equal(t, 20*time.Second, res.RetryAfter)
+		assert.Equal(t, time.Minute, res.Reset)
+	})
+
+	t.Run("should refill evenly over the period", func(t *testing.T) {
+		s, now := newStore()
+		limit := PerMinute(3)
+		for range 3 {
+			_, _ = s.Take(ctx, "key", limit)
+		}
+
+		*now = now.Add(19 * time.Second)
+		res, _ := s.Take(ctx, "key", limit)
+		assert.False(t, res.Allowed)
+
+		*now = now.Add(time.Second)
+		res, _ = s.Take(ctx, "key", limit)
+		assert.True(t, res.Allowed)
+
+		*now = now.Add(time.Hour)
+		res, _ = s.Take(ctx, "key", limit)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 2, res.Remaining, "buckets never hold more than the limit")
+	})
+
+	t.Run("should count keys separately", func(t *testing.T) {
+		s, _ := newStore()
+		limit := PerMinute(1)
+
+		res, _ := s.Take(ctx, "a", limit)
+		assert.True(t, res.Allowed)
+		res, _ = s.Take(ctx, "b", limit)
+		assert.True(t, res.Allowed)
+		res, _ = s.Take(ctx, "a", limit)
+		assert.False(t, res.Allowed)
+	})
+}
+
+// memoryBuckets is an in-memory database.RateLimitRepository.
+type memoryBuckets struct {
+	tokens map[string]float64
+}
+
+func (m *memoryBuckets) TakeRateLimitToken(_ context.Context, key string, capacity, _ float64) (bool, float64, error) {
+	tokens, ok := m.tokens[key]
+	if !ok {
+		tokens = capacity
+	}
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	m.tokens[key] = tokens
+	return allowed, tokens, nil
+}
+
+func (m *memoryBuckets) DeleteFullRateLimitBuckets(context.Context) (int64, error) {
+	return 0, nil
+}
+
+func TestPGStore(t *testing.T) {
+	s := NewPGStore(&memoryBuckets{tokens: map[string]float64{}})
+	limit := Limit{Requests: 2, Period: 10 * time.Second}
+
+	res, err := s.Take(context.Background(), "key", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+	assert.Equal(t, 5*time.Second, res.Reset)
+
+	_, _ = s.Take(context.Background(), "key", limit)
+	res, err = s.Take(context.Background(), "key", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 5*time.Second, res.RetryAfter)
+}
+
+func TestSetHeaders(t *testing.T) {
+	h := http.Header{}
+	SetHeaders(h, Result{Allowed: true, Limit: PerMinute(10), Remaining: 7, Reset: 17500 * time.Millisecond})
+
+	assert.Equal(t, "10", h.Get("RateLimit-Limit"))
+	assert.Equal(t, "7", h.Get("RateLimit-Remaining"))
+	assert.Equal(t, "18", h.Get("RateLimit-Reset"))
+	assert.Equal(t, "10;w=60", h.Get("RateLimit-Policy"))
+	assert.Empty(t, h.Get("Retry-After"))
+
+	SetHeaders(h, Result{Limit: PerMinute(10), RetryAfter: 100 * time.Millisecond})
+	assert.Equal(t, "1", h.Get("Retry-After"))
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// AdminRole is the role required to use the /admin API.
+const AdminRole = database.AdminRole
+
+// Page sizes for admin listings.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// pageParams reads the limit and offset query parameters. It reports false
+// if either is not a valid number.
+func pageParams(r *http.Request) (limit, offset int, ok bool) {
+	limit, offset = defaultPageSize, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, false
+		}
+		limit = min(n, maxPageSize)
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return limit, offset, true
+}
+
+// targetUser loads the user named by the id URL parameter, responding with
+// 404 or 500 and returning nil if it cannot.
+func (s *Server) targetUser(w http.ResponseWriter, r *http.Request) *database.User {
+	user, err := s.db.GetUserByID(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "user not found")
+		return nil
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load user", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+	return user
+}
+
+// audit records an action by the signed-in administrator on targetUserID,
+// or on no user when it is empty, in the security log. The change has
+// already been made, so a failure is logged and reported but not undone.
+func (s *Server) audit(w http.ResponseWriter, r *http.Request, eventType, targetUserID string, details map[string]interface{}) bool {
+	actor, _ := userFromContext(r.Context())
+	err := s.db.RecordAuthEvent(r.Context(), &database.AuthEvent{
+		Type:      eventType,
+		UserID:    targetUserID,
+		ActorID:   actor.ID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Details:   details,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record event", "type", eventType, "user_id", targetUserID, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return false
+	}
+	return true
+}
+
+// signOutEverywhere ends all of the user's sessions and revokes their
+// refresh tokens, returning how many sessions were ended.
+func (s *Server) signOutEverywhere(r *http.Request, userID string) (int64, error) {
+	revoked, err := s.db.DeleteUserSessionsExcept(r.Context(), userID, "")
+	if err != nil {
+		return 0, err
+	}
+	return revoked, s.db.RevokeUserRefreshTokens(r.Context(), userID)
+}
+
+// adminListUsersHandler searches users by email or name, a page at a time.
+func (s *Server) adminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := pageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "limit and offset must be non-negative numbers")
+		return
+	}
+
+	users, total, err := s.db.SearchUsers(r.Context(), database.UserSearch{
+		Query:  r.URL.Query().Get("q"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to search users", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if users == nil {
+		users = []database.User{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"users":  users,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (s *Server) adminGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	if user := s.targetUser(w, r); user != nil {
+		writeJSON(w, http.StatusOK, user)
+	}
+}
+
+func (s *Server) adminListIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if user := s.targetUser(w, r); user != nil {
+		s.writeIdentities(w, r, user.ID)
+	}
+}
+
+func (s *Server) adminListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if user := s.targetUser(w, r); user != nil {
+		s.writeSessions(w, r, user.ID, "")
+	}
+}
+
+// adminDisableUserHandler disables an account and signs it out everywhere.
+// Administrators cannot disable themselves, so that the last admin is not
+// locked out by mistake.
+func (s *Server) adminDisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	actor, _ := userFromContext(r.Context())
+	user := s.targetUser(w, r)
+	if user == nil {
+		return
+	}
+	if user.ID == actor.ID {
+		writeError(w, http.StatusBadRequest, "you cannot disable your own account")
+		return
+	}
+
+	err := s.db.SetUserDisabled(r.Context(), user.ID, true)
+	var revoked int64
+	if err == nil {
+		revoked, err = s.signOutEverywhere(r, user.ID)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to disable user", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if s.audit(w, r, database.EventAdminUserDisabled, user.ID, map[string]interface{}{"sessions_revoked": revoked}) {
+		user.Disabled = true
+		writeJSON(w, http.StatusOK, user)
+	}
+}
+
+func (s *Server) adminEnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := s.targetUser(w, r)
+	if user == nil {
+		return
+	}
+
+	if err := s.db.SetUserDisabled(r.Context(), user.ID, false); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to enable user", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if s.audit(w, r, database.EventAdminUserEnabled, user.ID, nil) {
+		user.Disabled = false
+		writeJSON(w, http.StatusOK, user)
+	}
+}
+
+// adminLogoutUserHandler ends all of a user's sessions and revokes their
+// refresh tokens. Access tokens already issued stay valid until they expire.
+func (s *Server) adminLogoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := s.targetUser(w, r)
+	if user == nil {
+		return
+	}
+
+	revoked, err := s.signOutEverywhere(r, user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to sign out user", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if s.audit(w, r, database.EventAdminUserSignedOut, user.ID, map[string]interface{}{"sessions_revoked": revoked}) {
+		writeJSON(w, http.StatusOK, map[string]int64{"revoked": revoked})
+	}
+}
+
+// adminResetMFAHandler removes a user's second factors so that they can
+// sign in with their first factor alone and enroll again. Passkeys that
+// are the user's only way to sign in are kept, which the response and the
+// security log both report.
+func (s *Server) adminResetMFAHandler(w http.ResponseWriter, r *http.Request) {
+	user := s.targetUser(w, r)
+	if user == nil {
+		return
+	}
+
+	passkeysKept, err := s.db.ResetUserMFA(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to reset MFA", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if s.audit(w, r, database.EventAdminMFAReset, user.ID, map[string]interface{}{"passkeys_kept": passkeysKept}) {
+		writeJSON(w, http.StatusOK, map[string]bool{"passkeys_kept": passkeysKept})
+	}
+}
+
+// adminUnlockUserHandler lifts a lockout of an account and resets its
+// failure count. Lockouts of the client addresses involved still expire
+// on their own.
+func (s *Server) adminUnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := s.targetUser(w, r)
+	if user == nil {
+		return
+	}
+
+	if err := s.db.ClearLoginFailures(r.Context(), accountThrottleKey(user.ID, "")); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to unlock user", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if s.audit(w, r, database.EventAdminUserUnlocked, user.ID, nil) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+func TestAdminAPI(t *testing.T) {
+	newServer := func(t *testing.T) (*Server, *MockDatabaseService) {
+		useTestStore(t)
+		db := &MockDatabaseService{
+			Users: map[string]*database.User{
+				"admin-1": {ID: "admin-1", Email: "admin@example.com"},
+				"user-1":  {ID: "user-1", Email: "jane@example.com", Name: "Jane"},
+				"user-2":  {ID: "user-2", Email: "john@example.com", Name: "John"},
+			},
+			Passwords: map[string]string{"user-1": auth.HashPassword("correct horse battery")},
+			Sessions: []database.Session{
+				{ID: "s1", PublicID: "p1", UserID: "user-1"},
+				{ID: "s2", PublicID: "p2", UserID: "user-1"},
+				{ID: "s3", PublicID: "p3", UserID: "user-2"},
+			},
+			Identities: []database.Identity{{ID: "identity-1", UserID: "user-1", Provider: "google"}},
+			Roles:      []database.Role{{Name: AdminRole}},
+			UserRoles:  map[string][]string{"admin-1": {AdminRole}},
+		}
+		return &Server{db: db}, db
+	}
+
+	serve := func(s *Server, method, target, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("should require the admin role", func(t *testing.T) {
+		s, _ := newServer(t)
+
+		w := serve(s, http.MethodGet, "/admin/users", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = serve(s, http.MethodGet, "/admin/users", "", sessionCookies(t, "user-1"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("should search and page through users", func(t *testing.T) {
+		s, _ := newServer(t)
+
+		w := serve(s, http.MethodGet, "/admin/users?q=example.com&limit=2&offset=1", "", sessionCookies(t, "admin-1"))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Users []database.User `json:"users"`
+			Total int             `json:"total"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, 3, body.Total)
+		require.Len(t, body.Users, 2)
+		assert.Equal(t, "user-1", body.Users[0].ID)
+
+		w = serve(s, http.MethodGet, "/admin/users?limit=-1", "", sessionCookies(t, "admin-1"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("should show a user's identities and sessions", func(t *testing.T) {
+		s, _ := newServer(t)
+
+		w := serve(s, http.MethodGet, "/admin/users/user-1/identities", "", sessionCookies(t, "admin-1"))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"provider":"google"`)
+
+		w = serve(s, http.MethodGet, "/admin/users/user-1/sessions", "", sessionCookies(t, "admin-1"))
+		require.Equal(t, http.StatusOK, w.Code)
+		var body struct {
+			Sessions []sessionResponse `json:"sessions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Len(t, body.Sessions, 2)
+
+		w = serve(s, http.MethodGet, "/admin/users/nobody/sessions", "", sessionCookies(t, "admin-1"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("should disable a user and sign them out everywhere", func(t *testing.T) {
+		s, db := newServer(t)
+		userCookies := sessionCookies(t, "user-1")
+
+		w := serve(s, http.MethodPost, "/admin/users/user-1/disable", "", sessionCookies(t, "admin-1"))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, db.Users["user-1"].Disabled)
+		assert.Len(t, db.Sessions, 1)
+
+		w = serve(s, http.MethodGet, "/me", "", userCookies)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = serve(s, http.MethodPost, "/auth/login", `{"email": "jane@example.com", "password": "correct horse battery"}`, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = serve(s, http.MethodPost, "/admin/users/user-1/enable", "", sessionCookies(t, "admin-1"))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.False(t, db.Users["user-1"].Disabled)
+
+		w = serve(s, http.MethodPost, "/auth/login", `{"email": "jane@example.com", "password": "correct horse battery"}`, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("should not let admins disable themselves", func(t *testing.T) {
+		s, db := newServer(t)
+
+		w := serve(s, http.MethodPost, "/admin/users/admin-1/disable", "", sessionCookies(t, "admin-1"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.False(t, db.Users["admin-1"].Disabled)
+	})
+
+	t.Run("should force logout", func(t *testing.T) {
+		s, db := newServer(t)
+		_, err := db.CreateRefreshToken(t.Context(), "user-1", []byte("hash"), db.Users["user-1"].CreatedAt)
+		require.NoError(t, err)
+
+		w := serve(s, http.MethodPost, "/admin/users/user-1/logout", "", sessionCookies(t, "admin-1"))
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"revoked": 2}`, w.Body.String())
+		assert.Empty(t, db.RefreshTokens)
+	})
+
+	t.Run("should reset MFA", func(t *testing.T) {
+		s, db := newServer(t)
+		db.Users["user-1"].MFAEnabled = true
+		db.TOTP = map[string]*mockTOTP{"user-1": {TOTP: database.TOTP{UserID: "user-1", Enabled: true}}}
+		db.Passkeys = []database.WebAuthnCredential{{ID: "cred-1", UserID: "user-1"}}
+
+		w := serve(s, http.MethodDelete, "/admin/users/user-1/mfa", "", sessionCookies(t, "admin-1"))
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"passkeys_kept": false}`, w.Body.String())
+		assert.False(t, db.Users["user-1"].MFAEnabled)
+		assert.Empty(t, db.TOTP)
+		assert.Empty(t, db.Passkeys)
+	})
+
+	t.Run("should keep passkeys that are the last login method", func(t *testing.T) {
+		s, db := newServer(t)
+		db.Users["user-2"].MFAEnabled = true
+		db.TOTP = map[string]*mockTOTP{"user-2": {TOTP: database.TOTP{UserID: "user-2", Enabled: true}}}
+		db.Passkeys = []database.WebAuthnCredential{{ID: "cred-1", UserID: "user-2"}}
+
+		w := serve(s, http.MethodDelete, "/admin/users/user-2/mfa", "", sessionCookies(t, "admin-1"))
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"passkeys_kept": true}`, w.Body.String())
+		assert.Empty(t, db.TOTP)
+		assert.Len(t, db.Passkeys, 1)
+		assert.Equal(t, true, db.AuthEvents[len(db.AuthEvents)-1].Details["passkeys_kept"])
+	})
+
+	t.Run("should record every change in the security log", func(t *testing.T) {
+		s, _ := newServer(t)
+		cookies := sessionCookies(t, "admin-1")
+		serve(s, http.MethodPost, "/admin/users/user-1/disable", "", cookies)
+		serve(s, http.MethodPost, "/admin/users/user-1/enable", "", cookies)
+		serve(s, http.MethodPost, "/admin/users/user-2/logout", "", cookies)
+
+		w := serve(s, http.MethodGet, "/admin/events?user_id=user-1", "", cookies)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Events []database.AuthEvent `json:"events"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.Len(t, body.Events, 2)
+		assert.Equal(t, database.EventAdminUserEnabled, body.Events[0].Type)
+		assert.Equal(t, database.EventAdminUserDisabled, body.Events[1].Type)
+		assert.Equal(t, "admin-1", body.Events[1].ActorID)
+		assert.Equal(t, "192.0.2.1", body.Events[1].IP)
+	})
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// defaultActivityLimit is how many events the security activity page shows
+// unless asked for more.
+const defaultActivityLimit = 20
+
+// recordEvent appends event to the security log, filling in the client's
+// IP address and user agent from r. The log must never stop someone from
+// signing in, so failures are only logged.
+func (s *Server) recordEvent(r *http.Request, event database.AuthEvent) {
+	event.IP = clientIP(r)
+	event.UserAgent = r.UserAgent()
+	if err := s.db.RecordAuthEvent(r.Context(), &event); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record event", "type", event.Type, "error", err)
+	}
+}
+
+// recordLoginFailure logs a rejected sign-in. userID is empty when the
+// attempt did not identify an account.
+func (s *Server) recordLoginFailure(r *http.Request, userID, provider, reason string, details map[string]interface{}) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["reason"] = reason
+	s.recordEvent(r, database.AuthEvent{
+		Type:     database.EventLoginFailed,
+		UserID:   userID,
+		Provider: provider,
+		Details:  details,
+	})
+}
+
+// myActivityHandler returns the signed-in user's recent security activity,
+// newest first.
+func (s *Server) myActivityHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	limit, offset, ok := pageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "limit and offset must be non-negative numbers")
+		return
+	}
+	if r.URL.Query().Get("limit") == "" {
+		limit = defaultActivityLimit
+	}
+
+	s.writeEvents(w, r, database.AuthEventQuery{UserID: user.ID, Limit: limit, Offset: offset})
+}
+
+// adminEventsHandler searches the security log. It can be filtered by the
+// user an event is about, the actor, the event type and a start time.
+func (s *Server) adminEventsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := pageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "limit and offset must be non-negative numbers")
+		return
+	}
+
+	q := r.URL.Query()
+	query := database.AuthEventQuery{
+		UserID:  q.Get("user_id"),
+		ActorID: q.Get("actor_id"),
+		Type:    q.Get("type"),
+		Limit:   limit,
+		Offset:  offset,
+	}
+	if since := q.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+		query.Since = t
+	}
+
+	s.writeEvents(w, r, query)
+}
+
+// writeEvents responds with the events matching query.
+func (s *Server) writeEvents(w http.ResponseWriter, r *http.Request, query database.AuthEventQuery) {
+	events, err := s.db.ListAuthEvents(r.Context(), query)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list auth events", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if events == nil {
+		events = []database.AuthEvent{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"events": events,
+		"limit":  query.Limit,
+		"offset": query.Offset,
+	})
+}
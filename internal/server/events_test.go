@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+func TestAuthEvents(t *testing.T) {
+	newServer := func(t *testing.T) (*Server, *MockDatabaseService) {
+		useTestStore(t)
+		db := &MockDatabaseService{
+			Users: map[string]*database.User{
+				"user-1":  {ID: "user-1", Email: "jane@example.com"},
+				"admin-1": {ID: "admin-1", Email: "admin@example.com"},
+			},
+			Passwords: map[string]string{"user-1": auth.HashPassword("correct horse battery")},
+			Roles:     []database.Role{{Name: AdminRole}},
+			UserRoles: map[string][]string{"admin-1": {AdminRole}},
+		}
+		return &Server{db: db}, db
+	}
+
+	serve := func(s *Server, method, target, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("User-Agent", "events-test")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("should record failed and successful logins", func(t *testing.T) {
+		s, db := newServer(t)
+
+		serve(s, http.MethodPost, "/auth/login", `{"email": "jane@example.com", "password": "wrong"}`, nil)
+		serve(s, http.MethodPost, "/auth/login", `{"email": "nobody@example.com", "password": "wrong"}`, nil)
+		serve(s, http.MethodPost, "/auth/login", `{"email": "jane@example.com", "password": "correct horse battery"}`, nil)
+
+		require.Equal(t, []string{database.EventLoginFailed, database.EventLoginFailed, database.EventLoginSucceeded}, db.eventTypes())
+
+		failed := db.AuthEvents[0]
+		assert.Equal(t, "user-1", failed.UserID)
+		assert.Equal(t, auth.PasswordProvider, failed.Provider)
+		assert.Equal(t, "invalid_credentials", failed.Details["reason"])
+		assert.Equal(t, "192.0.2.1", failed.IP)
+		assert.Equal(t, "events-test", failed.UserAgent)
+
+		assert.Empty(t, db.AuthEvents[1].UserID)
+		assert.Equal(t, "nobody@example.com", db.AuthEvents[1].Details["email"])
+
+		assert.Equal(t, "user-1", db.AuthEvents[2].UserID)
+	})
+
+	t.Run("should show users only their own activity", func(t *testing.T) {
+		s, db := newServer(t)
+		db.AuthEvents = []database.AuthEvent{
+			{Type: database.EventLoginSucceeded, UserID: "user-1"},
+			{Type: database.EventLoginSucceeded, UserID: "admin-1"},
+			{Type: database.EventTOTPEnabled, UserID: "user-1"},
+		}
+
+		w := serve(s, http.MethodGet, "/me/security-activity", "", sessionCookies(t, "user-1"))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Events []database.AuthEvent `json:"events"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.Len(t, body.Events, 2)
+		assert.Equal(t, database.EventTOTPEnabled, body.Events[0].Type)
+	})
+
+	t.Run("should let admins query the log", func(t *testing.T) {
+		s, db := newServer(t)
+		serve(s, http.MethodPost, "/auth/login", `{"email": "jane@example.com", "password": "wrong"}`, nil)
+		serve(s, http.MethodPost, "/auth/login", `{"email": "jane@example.com", "password": "correct horse battery"}`, nil)
+
+		w := serve(s, http.MethodGet, "/admin/events?type=login.failed", "", sessionCookies(t, "admin-1"))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Events []database.AuthEvent `json:"events"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.Len(t, body.Events, 1)
+		assert.Equal(t, database.EventLoginFailed, body.Events[0].Type)
+
+		w = serve(s, http.MethodGet, "/admin/events?since=yesterday", "", sessionCookies(t, "admin-1"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = serve(s, http.MethodGet, "/admin/events", "", sessionCookies(t, "user-1"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Len(t, db.AuthEvents, 2)
+	})
+}
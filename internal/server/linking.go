@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/markbates/goth/gothic"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+type identityResponse struct {
+	ID        string    `json:"id"`
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// setLinkUser records userID as the user an OAuth flow in progress will
+// link to, or clears it when userID is empty.
+func setLinkUser(w http.ResponseWriter, r *http.Request, userID string) error {
+	session, _ := gothic.Store.Get(r, auth.SessionName)
+	current, _ := session.Values[auth.SessionLinkUserIDKey].(string)
+	if current == userID {
+		return nil
+	}
+
+	if userID == "" {
+		delete(session.Values, auth.SessionLinkUserIDKey)
+	} else {
+		session.Values[auth.SessionLinkUserIDKey] = userID
+	}
+	return session.Save(r, w)
+}
+
+// takeLinkUser removes and returns the user recorded by setLinkUser. It
+// returns "" unless that user is still the one signed in.
+func takeLinkUser(w http.ResponseWriter, r *http.Request) (string, error) {
+	session, _ := gothic.Store.Get(r, auth.SessionName)
+	linkUserID, _ := session.Values[auth.SessionLinkUserIDKey].(string)
+	if linkUserID == "" {
+		return "", nil
+	}
+
+	delete(session.Values, auth.SessionLinkUserIDKey)
+	if err := session.Save(r, w); err != nil {
+		return "", err
+	}
+
+	userID, _ := session.Values[auth.SessionUserIDKey].(string)
+	if userID != linkUserID {
+		return "", nil
+	}
+	return linkUserID, nil
+}
+
+// completeLink attaches identity to the user who started the OAuth flow
+// in link mode and sends them back to the frontend. Their session is left
+// as it is.
+func (s *Server) completeLink(w http.ResponseWriter, r *http.Request, userID string, identity database.Identity) {
+	err := s.db.LinkIdentity(r.Context(), userID, identity)
+	if errors.Is(err, database.ErrIdentityTaken) {
+		http.Error(w, "This account is already linked to another user", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to link identity", "error", err)
+		http.Error(w, "Linking failed", http.StatusInternalServerError)
+		return
+	}
+	s.recordEvent(r, database.AuthEvent{Type: database.EventIdentityLinked, UserID: userID, Provider: identity.Provider})
+
+	http.Redirect(w, r, s.config.AppURI, http.StatusFound)
+}
+
+// autoLink attaches a new identity to the existing user with the same
+// email address. Both the provider and the existing account must vouch
+// for the address; otherwise it returns database.ErrEmailTaken, so that
+// nobody can take over an account by registering its address elsewhere.
+func (s *Server) autoLink(ctx context.Context, identity database.Identity) (*database.User, error) {
+	if !identity.EmailVerified {
+		return nil, database.ErrEmailTaken
+	}
+
+	user, err := s.db.GetUserByEmail(ctx, identity.Email)
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified {
+		return nil, database.ErrEmailTaken
+	}
+
+	if err := s.db.LinkIdentity(ctx, user.ID, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *Server) listIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	s.writeIdentities(w, r, user.ID)
+}
+
+// writeIdentities responds with the provider identities linked to userID.
+func (s *Server) writeIdentities(w http.ResponseWriter, r *http.Request, userID string) {
+	list, err := s.db.ListUserIdentities(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list identities", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	resp := make([]identityResponse, 0, len(list))
+	for _, i := range list {
+		resp = append(resp, identityResponse{
+			ID:        i.ID,
+			Provider:  i.Provider,
+			Email:     i.Email,
+			CreatedAt: i.CreatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"identities": resp})
+}
+
+func (s *Server) unlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	err := s.db.UnlinkIdentity(r.Context(), user.ID, chi.URLParam(r, "id"))
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		writeError(w, http.StatusNotFound, "identity not found")
+	case errors.Is(err, database.ErrLastLoginMethod):
+		writeError(w, http.StatusConflict, "cannot remove the last login method")
+	case err != nil:
+		slog.ErrorContext(r.Context(), "Failed to unlink identity", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	default:
+		s.recordEvent(r, database.AuthEvent{
+			Type:    database.EventIdentityUnlinked,
+			UserID:  user.ID,
+			Details: map[string]interface{}{"identity_id": chi.URLParam(r, "id")},
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
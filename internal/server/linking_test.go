@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+func TestIdentityHandlers(t *testing.T) {
+	user := &database.User{ID: "user-1"}
+
+	newDB := func() *MockDatabaseService {
+		return &MockDatabaseService{
+			Users: map[string]*database.User{user.ID: user},
+			Identities: []database.Identity{
+				{ID: "i1", UserID: user.ID, Provider: "google", Email: "jane@example.com"},
+				{ID: "i2", UserID: user.ID, Provider: "github"},
+				{ID: "i3", UserID: "someone-else", Provider: "google"},
+			},
+		}
+	}
+
+	serve := func(t *testing.T, db *MockDatabaseService, method, target string) *httptest.ResponseRecorder {
+		t.Helper()
+		useTestStore(t)
+
+		req := httptest.NewRequest(method, target, nil)
+		for _, c := range sessionCookies(t, user.ID) {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		(&Server{db: db}).RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("should list the user's identities", func(t *testing.T) {
+		w := serve(t, newDB(), http.MethodGet, "/me/identities")
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Identities []identityResponse `json:"identities"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.Len(t, body.Identities, 2)
+		assert.Equal(t, "google", body.Identities[0].Provider)
+		assert.Equal(t, "jane@example.com", body.Identities[0].Email)
+		assert.Equal(t, "github", body.Identities[1].Provider)
+	})
+
+	t.Run("should unlink an identity", func(t *testing.T) {
+		db := newDB()
+		w := serve(t, db, http.MethodDelete, "/me/identities/i2")
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Len(t, db.Identities, 2)
+	})
+
+	t.Run("should refuse to unlink the last login method", func(t *testing.T) {
+		db := newDB()
+		db.Identities = db.Identities[:1]
+		w := serve(t, db, http.MethodDelete, "/me/identities/i1")
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Len(t, db.Identities, 1)
+	})
+
+	t.Run("should not unlink another user's identity", func(t *testing.T) {
+		w := serve(t, newDB(), http.MethodDelete, "/me/identities/i3")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestLinkMode(t *testing.T) {
+	user := &database.User{ID: "user-1"}
+	newServer := func() *Server {
+		return &Server{db: &MockDatabaseService{Users: map[string]*database.User{user.ID: user}}}
+	}
+
+	t.Run("should require a session", func(t *testing.T) {
+		useTestStore(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/auth/github?mode=link", nil)
+		w := httptest.NewRecorder()
+		newServer().RegisterRoutes().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("should remember the signed-in user for the callback", func(t *testing.T) {
+		useTestStore(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/auth/github?mode=link", nil)
+		for _, c := range sessionCookies(t, user.ID) {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		newServer().RegisterRoutes().ServeHTTP(w, req)
+
+		callback := httptest.NewRequest(http.MethodGet, "/auth/github/callback", nil)
+		for _, c := range w.Result().Cookies() {
+			callback.AddCookie(c)
+		}
+		linkUserID, err := takeLinkUser(httptest.NewRecorder(), callback)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, linkUserID)
+	})
+
+	t.Run("should ignore a link started by another user", func(t *testing.T) {
+		useTestStore(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range sessionCookies(t, "user-2") {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		require.NoError(t, setLinkUser(w, req, user.ID))
+
+		callback := httptest.NewRequest(http.MethodGet, "/auth/github/callback", nil)
+		for _, c := range w.Result().Cookies() {
+			callback.AddCookie(c)
+		}
+		linkUserID, err := takeLinkUser(httptest.NewRecorder(), callback)
+		require.NoError(t, err)
+		assert.Empty(t, linkUserID)
+	})
+}
+
+func TestAutoLink(t *testing.T) {
+	ctx := context.Background()
+	identity := database.Identity{Provider: "github", ProviderUserID: "gh-1", Email: "jane@example.com", EmailVerified: true}
+
+	newDB := func(verified bool) *MockDatabaseService {
+		return &MockDatabaseService{Users: map[string]*database.User{
+			"user-1": {ID: "user-1", Email: "jane@example.com", EmailVerified: verified},
+		}}
+	}
+
+	t.Run("should link when both sides verified the email", func(t *testing.T) {
+		db := newDB(true)
+
+		user, err := (&Server{db: db}).autoLink(ctx, identity)
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", user.ID)
+		require.Len(t, db.Identities, 1)
+		assert.Equal(t, "user-1", db.Identities[0].UserID)
+	})
+
+	t.Run("should not trust an unverified provider email", func(t *testing.T) {
+		db := newDB(true)
+		unverified := identity
+		unverified.EmailVerified = false
+
+		_, err := (&Server{db: db}).autoLink(ctx, unverified)
+		assert.ErrorIs(t, err, database.ErrEmailTaken)
+		assert.Empty(t, db.Identities)
+	})
+
+	t.Run("should not link to an unverified account", func(t *testing.T) {
+		db := newDB(false)
+
+		_, err := (&Server{db: db}).autoLink(ctx, identity)
+		assert.ErrorIs(t, err, database.ErrEmailTaken)
+		assert.Empty(t, db.Identities)
+	})
+}
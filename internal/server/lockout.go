@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// Failed password and second-factor checks are counted per account and per
+// client address. Past a few free attempts each failure blocks further
+// attempts for a doubling delay, and enough failures lock the account or
+// address out for lockoutDuration. Attempts against unknown email
+// addresses are counted the same way, so lockouts do not reveal which
+// addresses have accounts.
+const (
+	// loginFailureWindow is how long failures are remembered after the
+	// most recent one.
+	loginFailureWindow = time.Hour
+
+	maxLoginDelay   = time.Minute
+	lockoutDuration = 15 * time.Minute
+
+	loginThrottleCleanupInterval = time.Hour
+)
+
+// lockoutPolicy sets how many failures are tolerated before delays start
+// and before a lockout.
+type lockoutPolicy struct {
+	freeAttempts int
+	lockoutAfter int
+}
+
+var (
+	accountLockout = lockoutPolicy{freeAttempts: 3, lockoutAfter: 10}
+	addressLockout = lockoutPolicy{freeAttempts: 10, lockoutAfter: 50}
+)
+
+// delay returns how long attempts are blocked after the given number of
+// consecutive failures.
+func (p lockoutPolicy) delay(failures int) time.Duration {
+	switch {
+	case failures >= p.lockoutAfter:
+		return lockoutDuration
+	case failures <= p.freeAttempts:
+		return 0
+	}
+	return min(time.Second<<(failures-p.freeAttempts-1), maxLoginDelay)
+}
+
+// errTooManyAttempts is returned while an account or address is blocked.
+var errTooManyAttempts = errors.New("too many failed attempts; try again later")
+
+// accountThrottleKey returns the key failures against an account are
+// counted under: its user ID, or the email address when no account has it.
+func accountThrottleKey(userID, email string) string {
+	if userID != "" {
+		return "user:" + userID
+	}
+	return "email:" + email
+}
+
+func addressThrottleKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// checkLoginThrottle reports whether attempts against accountKey from the
+// client's address are allowed. If not, it responds with 429 and returns
+// false.
+func (s *Server) checkLoginThrottle(w http.ResponseWriter, r *http.Request, accountKey string) bool {
+	throttles, err := s.db.GetLoginThrottles(r.Context(), []string{accountKey, addressThrottleKey(r)})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load login throttles", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return false
+	}
+
+	var wait time.Duration
+	for _, t := range throttles {
+		wait = max(wait, time.Until(t.LockedUntil))
+	}
+	if wait <= 0 {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeError(w, http.StatusTooManyRequests, errTooManyAttempts.Error())
+	return false
+}
+
+// throttleLoginFailure counts a failed attempt against accountKey and the
+// client's address. userID is empty when the attempt did not match an
+// account.
+func (s *Server) throttleLoginFailure(r *http.Request, userID, accountKey string) {
+	s.countLoginFailure(r, userID, accountKey, "account", accountLockout)
+	s.countLoginFailure(r, "", addressThrottleKey(r), "address", addressLockout)
+}
+
+// countLoginFailure records a failure against key and blocks it as policy
+// requires, logging the start of a lockout in the security log. Failures
+// are only logged, as the attempt has already been rejected.
+func (s *Server) countLoginFailure(r *http.Request, userID, key, scope string, policy lockoutPolicy) {
+	throttle, err := s.db.RecordLoginFailure(r.Context(), key, loginFailureWindow)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record login failure", "error", err)
+		return
+	}
+
+	delay := policy.delay(throttle.Failures)
+	if delay == 0 {
+		return
+	}
+	until := time.Now().Add(delay)
+	if err := s.db.LockLogin(r.Context(), key, until); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to lock out login", "throttle", key, "error", err)
+		return
+	}
+
+	if delay == lockoutDuration {
+		s.recordEvent(r, database.AuthEvent{
+			Type:   database.EventLoginLockedOut,
+			UserID: userID,
+			Details: map[string]interface{}{
+				"scope":        scope,
+				"key":          key,
+				"failures":     throttle.Failures,
+				"locked_until": until,
+			},
+		})
+	}
+}
+
+// clearLoginFailures forgets the failures against an account after it
+// signs in.
+func (s *Server) clearLoginFailures(r *http.Request, userID string) {
+	if err := s.db.ClearLoginFailures(r.Context(), accountThrottleKey(userID, "")); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to clear login failures", "error", err)
+	}
+}
+
+// cleanupLoginThrottles deletes forgotten failures every interval until ctx
+// is done.
+func (s *Server) cleanupLoginThrottles(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.db.DeleteStaleLoginThrottles(ctx, time.Now().Add(-loginFailureWindow)); err != nil {
+				slog.ErrorContext(ctx, "Failed to clean up login throttles", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+func TestLockoutPolicy(t *testing.T) {
+	p := lockoutPolicy{freeAttempts: 3, lockoutAfter: 10}
+
+	assert.Zero(t, p.delay(3))
+	assert.Equal(t, time.Second, p.delay(4))
+	assert.Equal(t, 2*time.Second, p.delay(5))
+	assert.Equal(t, 32*time.Second, p.delay(9))
+	assert.Equal(t, lockoutDuration, p.delay(10))
+	assert.Equal(t, maxLoginDelay, lockoutPolicy{freeAttempts: 0, lockoutAfter: 50}.delay(20))
+}
+
+func TestLoginLockout(t *testing.T) {
+	newServer := func(t *testing.T) (*Server, *MockDatabaseService) {
+		useTestStore(t)
+		db := &MockDatabaseService{
+			Users: map[string]*database.User{
+				"user-1":  {ID: "user-1", Email: "jane@example.com"},
+				"admin-1": {ID: "admin-1", Email: "admin@example.com"},
+			},
+			Passwords: map[string]string{"user-1": auth.HashPassword("correct horse battery")},
+			Roles:     []database.Role{{Name: AdminRole}},
+			UserRoles: map[string][]string{"admin-1": {AdminRole}},
+		}
+		return &Server{db: db}, db
+	}
+
+	serve := func(s *Server, method, target, body, remoteAddr string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if remoteAddr != "" {
+			req.RemoteAddr = remoteAddr
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	login := func(s *Server, email, password string) *httptest.ResponseRecorder {
+		return serve(s, http.MethodPost, "/auth/login", `{"email": "`+email+`", "password": "`+password+`"}`, "", nil)
+	}
+
+	// expire lifts any block on key without forgetting its failures.
+	expire := func(db *MockDatabaseService, key string) {
+		db.Throttles[key].LockedUntil = time.Time{}
+	}
+
+	t.Run("should delay attempts after repeated failures", func(t *testing.T) {
+		s, _ := newServer(t)
+
+		for range 3 {
+			require.Equal(t, http.StatusUnauthorized, login(s, "jane@example.com", "wrong").Code)
+		}
+		assert.Equal(t, http.StatusUnauthorized, login(s, "jane@example.com", "wrong").Code)
+
+		w := login(s, "jane@example.com", "correct horse battery")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("should respond the same whether or not the account exists", func(t *testing.T) {
+		s, _ := newServer(t)
+
+		for range 4 {
+			a, b := login(s, "jane@example.com", "wrong"), login(s, "nobody@example.com", "wrong")
+			assert.Equal(t, a.Code, b.Code)
+			assert.Equal(t, a.Body.String(), b.Body.String())
+		}
+
+		a, b := login(s, "jane@example.com", "wrong"), login(s, "nobody@example.com", "wrong")
+		assert.Equal(t, http.StatusTooManyRequests, a.Code)
+		assert.Equal(t, a.Code, b.Code)
+		assert.Equal(t, a.Body.String(), b.Body.String())
+		assert.Equal(t, a.Header().Get("Retry-After"), b.Header().Get("Retry-After"))
+	})
+
+	t.Run("should lock the account and record it", func(t *testing.T) {
+		s, db := newServer(t)
+
+		for range accountLockout.lockoutAfter {
+			login(s, "jane@example.com", "wrong")
+			expire(db, "user:user-1")
+			expire(db, "ip:192.0.2.1")
+		}
+
+		locked := db.AuthEvents[len(db.AuthEvents)-1]
+		require.Equal(t, database.EventLoginLockedOut, locked.Type)
+		assert.Equal(t, "user-1", locked.UserID)
+		assert.Equal(t, "account", locked.Details["scope"])
+		assert.Equal(t, accountLockout.lockoutAfter, locked.Details["failures"])
+
+		db.Throttles["user:user-1"].LockedUntil = time.Now().Add(lockoutDuration)
+		w := serve(s, http.MethodPost, "/auth/login", `{"email": "jane@example.com", "password": "correct horse battery"}`, "198.51.100.7:1234", nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "900", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("should block addresses that fail across accounts", func(t *testing.T) {
+		s, db := newServer(t)
+		db.Throttles = map[string]*database.LoginThrottle{
+			"ip:192.0.2.1": {Key: "ip:192.0.2.1", Failures: addressLockout.lockoutAfter, LockedUntil: time.Now().Add(time.Minute)},
+		}
+
+		assert.Equal(t, http.StatusTooManyRequests, login(s, "jane@example.com", "correct horse battery").Code)
+
+		w := serve(s, http.MethodPost, "/auth/login", `{"email": "jane@example.com", "password": "correct horse battery"}`, "198.51.100.7:1234", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("should clear failures after signing in", func(t *testing.T) {
+		s, db := newServer(t)
+
+		login(s, "jane@example.com", "wrong")
+		require.Contains(t, db.Throttles, "user:user-1")
+
+		require.Equal(t, http.StatusOK, login(s, "jane@example.com", "correct horse battery").Code)
+		assert.NotContains(t, db.Throttles, "user:user-1")
+		assert.Contains(t, db.Throttles, "ip:192.0.2.1")
+	})
+
+	t.Run("should throttle second factor attempts", func(t *testing.T) {
+		s, db := newServer(t)
+		db.Users["user-1"].MFAEnabled = true
+		db.TOTP = map[string]*mockTOTP{"user-1": {TOTP: database.TOTP{UserID: "user-1", Secret: auth.GenerateTOTPSecret(), Enabled: true}}}
+
+		w := login(s, "jane@example.com", "correct horse battery")
+		require.JSONEq(t, `{"mfa_required": true}`, w.Body.String())
+		cookies := w.Result().Cookies()
+
+		for range 4 {
+			w = serve(s, http.MethodPost, "/auth/mfa/verify", `{"code": "000000"}`, "", cookies)
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+		w = serve(s, http.MethodPost, "/auth/mfa/verify", `{"code": "000000"}`, "", cookies)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+		assert.Equal(t, http.StatusTooManyRequests, login(s, "jane@example.com", "correct horse battery").Code,
+			"a correct password does not reset failed codes")
+	})
+
+	t.Run("should throttle codes given to disable TOTP", func(t *testing.T) {
+		s, db := newServer(t)
+		secret := auth.GenerateTOTPSecret()
+		db.Users["user-1"].MFAEnabled = true
+		db.TOTP = map[string]*mockTOTP{"user-1": {TOTP: database.TOTP{UserID: "user-1", Secret: secret, Enabled: true}}}
+		cookies := sessionCookies(t, "user-1")
+
+		for range 4 {
+			w := serve(s, http.MethodDelete, "/me/mfa/totp", `{"code": "000000"}`, "", cookies)
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+		code, err := auth.TOTPCode(secret, time.Now())
+		require.NoError(t, err)
+		w := serve(s, http.MethodDelete, "/me/mfa/totp", `{"code": "`+code+`"}`, "", cookies)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.True(t, db.TOTP["user-1"].Enabled)
+
+		rejected := 0
+		for _, e := range db.AuthEvents {
+			if e.Type == database.EventMFACodeRejected {
+				rejected++
+				assert.Equal(t, "totp_disable", e.Details["action"])
+			}
+		}
+		assert.Equal(t, 4, rejected)
+	})
+
+	t.Run("should throttle codes given to confirm TOTP", func(t *testing.T) {
+		s, db := newServer(t)
+		db.TOTP = map[string]*mockTOTP{"user-1": {TOTP: database.TOTP{UserID: "user-1", Secret: auth.GenerateTOTPSecret()}}}
+		cookies := sessionCookies(t, "user-1")
+
+		for range 4 {
+			w := serve(s, http.MethodPost, "/me/mfa/totp/confirm", `{"code": "000000"}`, "", cookies)
+			require.Equal(t, http.StatusBadRequest, w.Code)
+		}
+		w := serve(s, http.MethodPost, "/me/mfa/totp/confirm", `{"code": "000000"}`, "", cookies)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("should let admins unlock accounts", func(t *testing.T) {
+		s, db := newServer(t)
+		db.Throttles = map[string]*database.LoginThrottle{
+			"user:user-1": {Key: "user:user-1", Failures: 10, LockedUntil: time.Now().Add(lockoutDuration)},
+		}
+
+		w := serve(s, http.MethodPost, "/admin/users/user-1/unlock", "", "", sessionCookies(t, "user-1"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = serve(s, http.MethodPost, "/admin/users/user-1/unlock", "", "", sessionCookies(t, "admin-1"))
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, http.StatusOK, login(s, "jane@example.com", "correct horse battery").Code)
+
+		unlocked := db.AuthEvents[0]
+		assert.Equal(t, database.EventAdminUserUnlocked, unlocked.Type)
+		assert.Equal(t, "admin-1", unlocked.ActorID)
+	})
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/mail"
+	"github.com/GRACENOBLE/auth-starter/internal/ratelimit"
+)
+
+// DefaultMagicLinkTTL is how long a magic link stays valid when
+// MAGIC_LINK_TTL is not set.
+const DefaultMagicLinkTTL = 15 * time.Minute
+
+// magicLinkLimit is how many magic links may be requested per address. It
+// goes through the shared limiter, so all instances count together.
+var magicLinkLimit = ratelimit.Limit{Requests: 3, Period: 15 * time.Minute}
+
+type magicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+// requestMagicLinkHandler emails a single-use sign-in link. Like
+// forgotPasswordHandler, it responds the same way whether or not the
+// address has an account. Requests are limited per address.
+func (s *Server) requestMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var req magicLinkRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "a valid email address is required")
+		return
+	}
+
+	byEmail := func(*http.Request) string { return "email:" + email }
+	if !s.checkRateLimit(w, r, "magic-link", rateLimitRule{magicLinkLimit, byEmail}) {
+		return
+	}
+
+	go func(ctx context.Context) {
+		if err := s.sendMagicLink(ctx, email); err != nil {
+			slog.ErrorContext(ctx, "Failed to send magic link", "error", err)
+		}
+	}(context.WithoutCancel(r.Context()))
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendMagicLink emails a sign-in link to the account with the given
+// address, if there is one.
+func (s *Server) sendMagicLink(ctx context.Context, email string) error {
+	if s.mailer == nil {
+		return nil
+	}
+
+	user, _, err := s.db.GetUserPasswordHash(ctx, email)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ttl := s.config.MagicLinkTTL
+	if ttl == 0 {
+		ttl = DefaultMagicLinkTTL
+	}
+
+	token, hash := auth.GenerateToken()
+	err = s.db.CreateOneTimeToken(ctx, user.ID, database.TokenPurposeMagicLink, hash, time.Now().Add(ttl))
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Open the link below to sign in:\n\n%s\n\n"+
+			"The link expires in %s and works once. If you did not ask to sign in, you can ignore this email.\n",
+			tokenLink(s.config.BackendURI+"/auth/magic-link/callback", token), ttl),
+	})
+}
+
+// magicLinkCallbackHandler redeems a magic link, signs the user in and
+// redirects to the frontend, as the OAuth callback does.
+func (s *Server) magicLinkCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	userID, err := s.db.ConsumeOneTimeToken(r.Context(), database.TokenPurposeMagicLink, auth.HashToken(token))
+	if errors.Is(err, database.ErrNotFound) {
+		s.recordLoginFailure(r, "", auth.MagicLinkProvider, "invalid_token", nil)
+		http.Error(w, "This sign-in link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to redeem magic link", "error", err)
+		http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		return
+	}
+
+	// Opening the link proves control of the address.
+	if err := s.db.MarkEmailVerified(r.Context(), userID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to mark email verified", "error", err)
+		http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := s.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load user", "error", err)
+		http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		return
+	}
+
+	redirectURL := s.config.AppURI
+	pending, err := s.beginLogin(w, r, user, auth.MagicLinkProvider)
+	if errors.Is(err, errAccountDisabled) {
+		http.Error(w, "Account disabled", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save session", "error", err)
+		http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		return
+	}
+	if pending {
+		redirectURL = s.config.MFARedirectURL
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/ratelimit"
+)
+
+func TestMagicLink(t *testing.T) {
+	newServer := func(t *testing.T) (*Server, *MockDatabaseService, *recordingMailer) {
+		useTestStore(t)
+		db := &MockDatabaseService{Users: map[string]*database.User{
+			"user-1": {ID: "user-1", Email: "jane@example.com"},
+		}}
+		mailer := &recordingMailer{}
+		return &Server{
+			config: config.Config{
+				AppURI:         "http://localhost:5173",
+				MFARedirectURL: "http://localhost:5173/mfa",
+				MagicLinkTTL:   time.Minute,
+			},
+			db:      db,
+			mailer:  mailer,
+			limiter: ratelimit.NewMemoryStore(),
+		}, db, mailer
+	}
+
+	serve := func(s *Server, method, target, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	// requestLink asks for a magic link and returns its token.
+	requestLink := func(t *testing.T, s *Server, mailer *recordingMailer) string {
+		t.Helper()
+		w := serve(s, http.MethodPost, "/auth/magic-link", `{"email": "Jane@Example.com"}`, nil)
+		require.Equal(t, http.StatusAccepted, w.Code)
+
+		require.Eventually(t, func() bool { return len(mailer.messages()) == 1 }, time.Second, time.Millisecond)
+		msg := mailer.messages()[0]
+		assert.Contains(t, msg.Body, "/auth/magic-link/callback?token=")
+		assert.Contains(t, msg.Body, "1m0s")
+		return linkToken(t, msg)
+	}
+
+	t.Run("should sign in and redirect to the app", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		token := requestLink(t, s, mailer)
+
+		w := serve(s, http.MethodGet, "/auth/magic-link/callback?token="+url.QueryEscape(token), "", nil)
+
+		require.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "http://localhost:5173", w.Header().Get("Location"))
+		assert.Equal(t, http.StatusOK, serve(s, http.MethodGet, "/me", "", w.Result().Cookies()).Code)
+		assert.True(t, db.Users["user-1"].EmailVerified)
+	})
+
+	t.Run("should accept a link only once", func(t *testing.T) {
+		s, _, mailer := newServer(t)
+		target := "/auth/magic-link/callback?token=" + url.QueryEscape(requestLink(t, s, mailer))
+
+		require.Equal(t, http.StatusFound, serve(s, http.MethodGet, target, "", nil).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(s, http.MethodGet, target, "", nil).Code)
+	})
+
+	t.Run("should reject an expired link", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		target := "/auth/magic-link/callback?token=" + url.QueryEscape(requestLink(t, s, mailer))
+		for _, tok := range db.OneTimeTokens {
+			tok.ExpiresAt = time.Now().Add(-time.Second)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, serve(s, http.MethodGet, target, "", nil).Code)
+	})
+
+	t.Run("should require the second factor when MFA is enabled", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		db.Users["user-1"].MFAEnabled = true
+		token := requestLink(t, s, mailer)
+
+		w := serve(s, http.MethodGet, "/auth/magic-link/callback?token="+url.QueryEscape(token), "", nil)
+
+		require.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "http://localhost:5173/mfa", w.Header().Get("Location"))
+		assert.Equal(t, http.StatusUnauthorized, serve(s, http.MethodGet, "/me", "", w.Result().Cookies()).Code)
+	})
+
+	t.Run("should not reveal whether an account exists", func(t *testing.T) {
+		s, _, mailer := newServer(t)
+
+		w := serve(s, http.MethodPost, "/auth/magic-link", `{"email": "nobody@example.com"}`, nil)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Never(t, func() bool { return len(mailer.messages()) > 0 }, 50*time.Millisecond, time.Millisecond)
+	})
+
+	t.Run("should limit requests per address", func(t *testing.T) {
+		s, _, _ := newServer(t)
+		request := func(email string) int {
+			return serve(s, http.MethodPost, "/auth/magic-link", `{"email": "`+email+`"}`, nil).Code
+		}
+
+		assert.Equal(t, http.StatusAccepted, request("nobody@example.com"))
+		assert.Equal(t, http.StatusAccepted, request("NOBODY@example.com"))
+		assert.Equal(t, http.StatusAccepted, request("nobody@example.com"))
+		assert.Equal(t, http.StatusTooManyRequests, request("nobody@example.com"))
+		assert.Equal(t, http.StatusAccepted, request("someone@example.com"))
+	})
+}
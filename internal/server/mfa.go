@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// errInvalidCode is returned for any second factor that does not check out.
+var errInvalidCode = errors.New("invalid code")
+
+// mfaCodeRequest carries a second factor: either a TOTP code from an
+// authenticator app or one of the user's recovery codes.
+type mfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type totpEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// checkSecondFactor verifies and spends a TOTP or recovery code for
+// userID. It returns errInvalidCode when the code is rejected.
+func (s *Server) checkSecondFactor(ctx context.Context, userID string, req mfaCodeRequest) error {
+	if req.RecoveryCode != "" {
+		err := s.db.UseRecoveryCode(ctx, userID, auth.HashRecoveryCode(req.RecoveryCode))
+		if errors.Is(err, database.ErrNotFound) {
+			return errInvalidCode
+		}
+		return err
+	}
+
+	totp, err := s.db.GetTOTP(ctx, userID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && !totp.Enabled) {
+		return errInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, req.Code, time.Now())
+	if !ok {
+		return errInvalidCode
+	}
+	if err := s.db.UseTOTPStep(ctx, userID, step); errors.Is(err, database.ErrCodeUsed) {
+		return errInvalidCode
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// rejectCode counts a wrong code given by the signed-in user against their
+// account, as failed logins are, so that a hijacked session cannot guess
+// codes, and records it in the security log.
+func (s *Server) rejectCode(r *http.Request, userID, action string) {
+	s.recordEvent(r, database.AuthEvent{
+		Type:    database.EventMFACodeRejected,
+		UserID:  userID,
+		Details: map[string]interface{}{"action": action},
+	})
+	s.throttleLoginFailure(r, userID, accountThrottleKey(userID, ""))
+}
+
+// verifyMFAHandler completes a login that is waiting for a second factor.
+func (s *Server) verifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	userID, provider, ok := pendingMFAUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "no pending sign-in; start again")
+		return
+	}
+
+	var req mfaCodeRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	accountKey := accountThrottleKey(userID, "")
+	if !s.checkLoginThrottle(w, r, accountKey) {
+		return
+	}
+	if err := s.checkSecondFactor(r.Context(), userID, req); errors.Is(err, errInvalidCode) {
+		s.recordLoginFailure(r, userID, provider, "invalid_code", nil)
+		s.throttleLoginFailure(r, userID, accountKey)
+		writeError(w, http.StatusUnauthorized, errInvalidCode.Error())
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check second factor", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	secondFactor := "totp"
+	if req.RecoveryCode != "" {
+		secondFactor = "recovery_code"
+		s.recordEvent(r, database.AuthEvent{Type: database.EventRecoveryCodeUsed, UserID: userID})
+	}
+
+	user, err := s.db.GetUserByID(r.Context(), userID)
+	if err == nil && user.Disabled {
+		s.recordLoginFailure(r, userID, provider, "account_disabled", nil)
+		writeError(w, http.StatusForbidden, errAccountDisabled.Error())
+		return
+	}
+	if err == nil {
+		err = s.completeLogin(w, r, userID, provider, map[string]interface{}{"mfa": true, "second_factor": secondFactor})
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to complete sign-in", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	s.clearLoginFailures(r, userID)
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// enrollTOTPHandler starts TOTP enrollment by generating a new secret. The
+// secret has no effect until confirmed with a code from the app.
+func (s *Server) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	secret := auth.GenerateTOTPSecret()
+	err := s.db.SaveTOTPSecret(r.Context(), user.ID, secret)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save TOTP secret", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.ID
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, totpEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, s.config.TOTPIssuer, account),
+	})
+}
+
+// confirmTOTPHandler enables TOTP once the user proves their app produces
+// valid codes, and returns a fresh set of recovery codes. They are shown
+// only this once.
+func (s *Server) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	var req mfaCodeRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	totp, err := s.db.GetTOTP(r.Context(), user.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusBadRequest, "start enrollment first")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load TOTP enrollment", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if totp.Enabled {
+		writeError(w, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	if !s.checkLoginThrottle(w, r, accountThrottleKey(user.ID, "")) {
+		return
+	}
+	step, ok := auth.ValidateTOTP(totp.Secret, req.Code, time.Now())
+	if !ok {
+		s.rejectCode(r, user.ID, "totp_confirm")
+		writeError(w, http.StatusBadRequest, errInvalidCode.Error())
+		return
+	}
+
+	codes, hashes := auth.GenerateRecoveryCodes()
+	if err := s.db.EnableTOTP(r.Context(), user.ID, step, hashes); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to enable TOTP", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	s.recordEvent(r, database.AuthEvent{Type: database.EventTOTPEnabled, UserID: user.ID})
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+// disableTOTPHandler turns off TOTP. A current code or recovery code is
+// required so that a hijacked session cannot remove the second factor.
+func (s *Server) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	totp, err := s.db.GetTOTP(r.Context(), user.ID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && !totp.Enabled) {
+		writeError(w, http.StatusConflict, "two-factor authentication is not enabled")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load TOTP enrollment", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	var req mfaCodeRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if !s.checkLoginThrottle(w, r, accountThrottleKey(user.ID, "")) {
+		return
+	}
+	if err := s.checkSecondFactor(r.Context(), user.ID, req); errors.Is(err, errInvalidCode) {
+		s.rejectCode(r, user.ID, "totp_disable")
+		writeError(w, http.StatusUnauthorized, errInvalidCode.Error())
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check second factor", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if err := s.db.DisableTOTP(r.Context(), user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to disable TOTP", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	s.recordEvent(r, database.AuthEvent{Type: database.EventTOTPDisabled, UserID: user.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
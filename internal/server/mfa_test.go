@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+func TestMFA(t *testing.T) {
+	const password = "correct horse battery"
+
+	newServer := func(t *testing.T) (*Server, *MockDatabaseService) {
+		useTestStore(t)
+		db := &MockDatabaseService{
+			Users:     map[string]*database.User{"user-1": {ID: "user-1", Email: "jane@example.com"}},
+			Passwords: map[string]string{"user-1": auth.HashPassword(password)},
+		}
+		return &Server{db: db}, db
+	}
+
+	serve := func(s *Server, method, target, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	// code returns the TOTP code offset time steps from now. Each step can
+	// be used only once, so later calls use a later step.
+	code := func(t *testing.T, secret string, offset int) string {
+		t.Helper()
+		c, err := auth.TOTPCode(secret, time.Now().Add(time.Duration(offset)*30*time.Second))
+		require.NoError(t, err)
+		return c
+	}
+
+	// enroll enables TOTP for user-1 and returns the secret and recovery codes.
+	enroll := func(t *testing.T, s *Server) (string, []string) {
+		t.Helper()
+		cookies := sessionCookies(t, "user-1")
+
+		w := serve(s, http.MethodPost, "/me/mfa/totp", "", cookies)
+		require.Equal(t, http.StatusOK, w.Code)
+		var enrollment totpEnrollmentResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+		assert.Contains(t, enrollment.OTPAuthURI, "secret="+enrollment.Secret)
+
+		w = serve(s, http.MethodPost, "/me/mfa/totp/confirm", `{"code": "`+code(t, enrollment.Secret, 0)+`"}`, cookies)
+		require.Equal(t, http.StatusOK, w.Code)
+		var body struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.NotEmpty(t, body.RecoveryCodes)
+
+		return enrollment.Secret, body.RecoveryCodes
+	}
+
+	// login signs in with the password and returns the pending session.
+	login := func(t *testing.T, s *Server) []*http.Cookie {
+		t.Helper()
+		w := serve(s, http.MethodPost, "/auth/login", `{"email": "jane@example.com", "password": "`+password+`"}`, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"mfa_required": true}`, w.Body.String())
+		return w.Result().Cookies()
+	}
+
+	t.Run("should enable TOTP after confirming a code", func(t *testing.T) {
+		s, db := newServer(t)
+		enroll(t, s)
+
+		assert.True(t, db.Users["user-1"].MFAEnabled)
+	})
+
+	t.Run("should not enable TOTP with a wrong code", func(t *testing.T) {
+		s, db := newServer(t)
+		cookies := sessionCookies(t, "user-1")
+		require.Equal(t, http.StatusOK, serve(s, http.MethodPost, "/me/mfa/totp", "", cookies).Code)
+
+		w := serve(s, http.MethodPost, "/me/mfa/totp/confirm", `{"code": "000000"}`, cookies)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.False(t, db.Users["user-1"].MFAEnabled)
+	})
+
+	t.Run("should hold a login until the second factor is given", func(t *testing.T) {
+		s, _ := newServer(t)
+		secret, _ := enroll(t, s)
+		pending := login(t, s)
+
+		assert.Equal(t, http.StatusUnauthorized, serve(s, http.MethodGet, "/me", "", pending).Code)
+
+		w := serve(s, http.MethodPost, "/auth/mfa/verify", `{"code": "`+code(t, secret, 1)+`"}`, pending)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusOK, serve(s, http.MethodGet, "/me", "", w.Result().Cookies()).Code)
+	})
+
+	t.Run("should not accept the same code twice", func(t *testing.T) {
+		s, _ := newServer(t)
+		secret, _ := enroll(t, s)
+		body := `{"code": "` + code(t, secret, 1) + `"}`
+
+		require.Equal(t, http.StatusOK, serve(s, http.MethodPost, "/auth/mfa/verify", body, login(t, s)).Code)
+		assert.Equal(t, http.StatusUnauthorized, serve(s, http.MethodPost, "/auth/mfa/verify", body, login(t, s)).Code)
+	})
+
+	t.Run("should accept each recovery code once", func(t *testing.T) {
+		s, _ := newServer(t)
+		_, recovery := enroll(t, s)
+		body := `{"recovery_code": "` + strings.ToUpper(recovery[0]) + `"}`
+
+		require.Equal(t, http.StatusOK, serve(s, http.MethodPost, "/auth/mfa/verify", body, login(t, s)).Code)
+		assert.Equal(t, http.StatusUnauthorized, serve(s, http.MethodPost, "/auth/mfa/verify", body, login(t, s)).Code)
+	})
+
+	t.Run("should reject a wrong code and a missing challenge", func(t *testing.T) {
+		s, _ := newServer(t)
+		enroll(t, s)
+
+		assert.Equal(t, http.StatusUnauthorized, serve(s, http.MethodPost, "/auth/mfa/verify", `{"code": "000000"}`, login(t, s)).Code)
+		assert.Equal(t, http.StatusUnauthorized, serve(s, http.MethodPost, "/auth/mfa/verify", `{"code": "000000"}`, nil).Code)
+	})
+
+	t.Run("should require a code to disable TOTP", func(t *testing.T) {
+		s, db := newServer(t)
+		secret, _ := enroll(t, s)
+		cookies := sessionCookies(t, "user-1")
+
+		assert.Equal(t, http.StatusUnauthorized, serve(s, http.MethodDelete, "/me/mfa/totp", `{"code": "000000"}`, cookies).Code)
+		assert.True(t, db.Users["user-1"].MFAEnabled)
+
+		w := serve(s, http.MethodDelete, "/me/mfa/totp", `{"code": "`+code(t, secret, 1)+`"}`, cookies)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.False(t, db.Users["user-1"].MFAEnabled)
+	})
+}
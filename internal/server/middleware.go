@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/markbates/goth/gothic"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/logging"
+)
+
+type contextKey string
+
+const (
+	userContextKey        contextKey = "user"
+	sessionIDContextKey   contextKey = "session_id"
+	permissionsContextKey contextKey = "permissions"
+)
+
+// errNotAuthenticated means the request carries no valid credentials.
+var errNotAuthenticated = errors.New("not authenticated")
+
+// userFromContext returns the signed-in user stored by the auth middleware.
+func userFromContext(ctx context.Context) (*database.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*database.User)
+	return user, ok
+}
+
+// sessionIDFromContext returns the server-side ID of the current session.
+// It is empty for bearer token requests and when sessions are kept in
+// cookies only.
+func sessionIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(sessionIDContextKey).(string)
+	return id
+}
+
+// requireSession loads the signed-in user from the auth session and adds it
+// to the request context. Requests without a valid session get a 401.
+func (s *Server) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serveAuthenticated(w, r, next, s.sessionUser)
+	})
+}
+
+// requireBearerToken loads the user named by a valid "Authorization: Bearer"
+// access token. Requests without one get a 401.
+func (s *Server) requireBearerToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serveAuthenticated(w, r, next, s.bearerUser)
+	})
+}
+
+// requireUser accepts either a bearer access token or a session. A request
+// with an Authorization header is only checked against the token.
+func (s *Server) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			s.serveAuthenticated(w, r, next, s.bearerUser)
+			return
+		}
+		s.serveAuthenticated(w, r, next, s.sessionUser)
+	})
+}
+
+// authenticator resolves the user making a request. It returns the user ID
+// and, for session requests, the server-side session ID.
+type authenticator func(r *http.Request) (userID, sessionID string, err error)
+
+func (s *Server) serveAuthenticated(w http.ResponseWriter, r *http.Request, next http.Handler, authenticate authenticator) {
+	userID, sessionID, err := authenticate(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, errNotAuthenticated.Error())
+		return
+	}
+
+	user, err := s.db.GetUserByID(r.Context(), userID)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusUnauthorized, errNotAuthenticated.Error())
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load user", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if user.Disabled {
+		writeError(w, http.StatusForbidden, errAccountDisabled.Error())
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	ctx = context.WithValue(ctx, sessionIDContextKey, sessionID)
+	ctx = context.WithValue(ctx, permissionsContextKey, &permissionCache{})
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// hstsPolicy tells browsers to use HTTPS for two years, including on
+// subdomains.
+const hstsPolicy = "max-age=63072000; includeSubDomains"
+
+// strictTransportSecurity sets the Strict-Transport-Security header. It is
+// only installed in production, where the API is served over HTTPS.
+func strictTransportSecurity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", hstsPolicy)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDHeader carries the request ID. A well-formed ID sent by a client
+// or proxy is kept so that their logs can be matched with ours; otherwise a
+// new one is generated. It is always echoed in the response.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID matches request IDs accepted from clients.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// assignRequestID adds a request ID to the request context, from where it
+// is added to every log line written for the request.
+func assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = rand.Text()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// logRequests logs each request once it has been served. Server errors are
+// logged at error level, everything else at info.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "Request served",
+			"method", r.Method,
+			"path", r.URL.RequestURI(),
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"duration", time.Since(start),
+			"ip", clientIP(r),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// forwardedFor replaces the remote address of requests that come from a
+// trusted proxy with the address of the client, so that rate limits, logs,
+// audit events and sessions record the client rather than the proxy.
+// X-Forwarded-For is read from the right, skipping trusted proxies, and the
+// first other address is the client; entries further left were sent by the
+// client and could be forged. Other requests are left alone.
+func (s *Server) forwardedFor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, port, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if proxy, err := netip.ParseAddr(host); err == nil && s.trustedProxy(proxy) {
+			r.RemoteAddr = net.JoinHostPort(s.forwardedClient(r, proxy).String(), port)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedClient walks the X-Forwarded-For hops added by trusted proxies,
+// starting from the proxy that connected to us. An entry that is not an
+// address ends the walk at the last proxy that could be trusted.
+func (s *Server) forwardedClient(r *http.Request, proxy netip.Addr) netip.Addr {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	client := proxy
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr
+		if !s.trustedProxy(client) {
+			break
+		}
+	}
+	return client
+}
+
+func (s *Server) trustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range s.config.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *Server) sessionUser(r *http.Request) (string, string, error) {
+	session, err := gothic.Store.Get(r, auth.SessionName)
+	if err != nil {
+		return "", "", errNotAuthenticated
+	}
+
+	userID, ok := session.Values[auth.SessionUserIDKey].(string)
+	if !ok || userID == "" {
+		return "", "", errNotAuthenticated
+	}
+	return userID, session.ID, nil
+}
+
+func (s *Server) bearerUser(r *http.Request) (string, string, error) {
+	if s.tokens == nil {
+		return "", "", errNotAuthenticated
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", "", errNotAuthenticated
+	}
+
+	claims, err := s.tokens.Verify(token)
+	if err != nil {
+		return "", "", errNotAuthenticated
+	}
+	return claims.Subject, "", nil
+}
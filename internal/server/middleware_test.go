@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/markbates/goth/gothic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/logging"
+)
+
+// useTestStore installs a cookie store with a fixed key for the duration
+// of the test.
+func useTestStore(t *testing.T) {
+	t.Helper()
+
+	original := gothic.Store
+	gothic.Store = sessions.NewCookieStore([]byte("test-session-key"))
+	t.Cleanup(func() { gothic.Store = original })
+}
+
+// sessionCookies returns the cookies set when userID signs in.
+func sessionCookies(t *testing.T, userID string) []*http.Cookie {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	require.NoError(t, startSession(w, req, userID, "google"))
+
+	return w.Result().Cookies()
+}
+
+func TestMeHandler(t *testing.T) {
+	user := &database.User{ID: "user-1", Email: "jane@example.com", Name: "Jane"}
+
+	newServer := func() *Server {
+		return &Server{db: &MockDatabaseService{Users: map[string]*database.User{user.ID: user}}}
+	}
+
+	t.Run("should return the signed-in user", func(t *testing.T) {
+		useTestStore(t)
+		handler := newServer().RegisterRoutes()
+
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		for _, c := range sessionCookies(t, user.ID) {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var got database.User
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		assert.Equal(t, user.ID, got.ID)
+		assert.Equal(t, user.Email, got.Email)
+	})
+
+	t.Run("should return 401 without a session", func(t *testing.T) {
+		useTestStore(t)
+		handler := newServer().RegisterRoutes()
+
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("should return 401 when the session user no longer exists", func(t *testing.T) {
+		useTestStore(t)
+		handler := newServer().RegisterRoutes()
+
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		for _, c := range sessionCookies(t, "deleted-user") {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("should return 401 for a tampered cookie", func(t *testing.T) {
+		useTestStore(t)
+		handler := newServer().RegisterRoutes()
+
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.AddCookie(&http.Cookie{Name: "auth_session", Value: "garbage"})
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestRequestLogging(t *testing.T) {
+	// useTestLogger sends the default logger to a buffer for the duration
+	// of the test.
+	useTestLogger := func(t *testing.T) *bytes.Buffer {
+		var buf bytes.Buffer
+		original := slog.Default()
+		slog.SetDefault(logging.New(config.Log{Format: "json"}, &buf))
+		t.Cleanup(func() { slog.SetDefault(original) })
+		return &buf
+	}
+
+	serve := func(target, requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if requestID != "" {
+			req.Header.Set(requestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		(&Server{db: &MockDatabaseService{}}).RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("should log each request with its ID", func(t *testing.T) {
+		buf := useTestLogger(t)
+
+		w := serve("/?token=s3cr3t", "")
+
+		id := w.Header().Get(requestIDHeader)
+		require.NotEmpty(t, id)
+
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		assert.Equal(t, "Request served", record["msg"])
+		assert.Equal(t, id, record[logging.RequestIDKey])
+		assert.Equal(t, "/?token=[REDACTED]", record["path"])
+		assert.Equal(t, float64(http.StatusOK), record["status"])
+		assert.NotContains(t, buf.String(), "s3cr3t")
+	})
+
+	t.Run("should keep well-formed request IDs from clients", func(t *testing.T) {
+		useTestLogger(t)
+
+		w := serve("/", "edge-7f3a.1")
+		assert.Equal(t, "edge-7f3a.1", w.Header().Get(requestIDHeader))
+
+		w = serve("/", "bad id\nforged=1")
+		assert.NotEqual(t, "bad id\nforged=1", w.Header().Get(requestIDHeader))
+		assert.NotEmpty(t, w.Header().Get(requestIDHeader))
+	})
+}
+
+func TestForwardedFor(t *testing.T) {
+	s := &Server{config: config.Config{TrustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/64"),
+	}}}
+
+	serve := func(remoteAddr string, forwardedFor ...string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		for _, v := range forwardedFor {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+
+		var got string
+		s.forwardedFor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = clientIP(r)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+		return got
+	}
+
+	t.Run("should ignore the header from other addresses", func(t *testing.T) {
+		assert.Equal(t, "203.0.113.9", serve("203.0.113.9:4000", "198.51.100.1"))
+	})
+
+	t.Run("should take the client from a trusted proxy", func(t *testing.T) {
+		assert.Equal(t, "198.51.100.1", serve("10.0.0.2:4000", "198.51.100.1"))
+		assert.Equal(t, "2001:db8::1", serve("[fd00::2]:4000", "2001:db8::1"))
+	})
+
+	t.Run("should skip trusted hops but not addresses the client sent", func(t *testing.T) {
+		assert.Equal(t, "198.51.100.1", serve("10.0.0.2:4000", "192.0.2.66, 198.51.100.1, 10.0.0.3"))
+		assert.Equal(t, "198.51.100.1", serve("10.0.0.2:4000", "192.0.2.66", "198.51.100.1,10.0.0.3"))
+	})
+
+	t.Run("should stop at entries that are not addresses", func(t *testing.T) {
+		assert.Equal(t, "10.0.0.3", serve("10.0.0.2:4000", "198.51.100.1, unknown, 10.0.0.3"))
+		assert.Equal(t, "10.0.0.2", serve("10.0.0.2:4000"))
+	})
+}
@@ -0,0 +1,562 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/markbates/goth/gothic"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/mail"
+)
+
+// DefaultInvitationTTL is how long an organization invitation stays valid
+// when INVITATION_TTL is not set.
+const DefaultInvitationTTL = 7 * 24 * time.Hour
+
+const membershipContextKey contextKey = "membership"
+
+// orgSlugPattern restricts organization slugs to lowercase URL-safe names.
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// orgRoleRank orders organization roles by privilege.
+var orgRoleRank = map[string]int{
+	database.OrgRoleMember: 1,
+	database.OrgRoleAdmin:  2,
+	database.OrgRoleOwner:  3,
+}
+
+type organizationRequest struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type organizationResponse struct {
+	database.Organization
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+	Active   bool      `json:"active"`
+}
+
+type setActiveOrganizationRequest struct {
+	OrganizationID string `json:"organization_id"`
+}
+
+// memberUserResponse is the part of a member's profile other members may
+// see.
+type memberUserResponse struct {
+	ID        string `json:"id"`
+	Name      string `json:"name,omitempty"`
+	Email     string `json:"email,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+type memberResponse struct {
+	User     memberUserResponse `json:"user"`
+	Role     string             `json:"role"`
+	JoinedAt time.Time          `json:"joined_at"`
+}
+
+type memberRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type invitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type invitationResponse struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invited_by,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type acceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+func newOrganizationResponse(m database.Membership, activeID string) organizationResponse {
+	return organizationResponse{
+		Organization: m.Organization,
+		Role:         m.Role,
+		JoinedAt:     m.JoinedAt,
+		Active:       m.Organization.ID == activeID,
+	}
+}
+
+func newMemberResponse(m database.Member) memberResponse {
+	return memberResponse{
+		User: memberUserResponse{
+			ID:        m.User.ID,
+			Name:      m.User.Name,
+			Email:     m.User.Email,
+			AvatarURL: m.User.AvatarURL,
+		},
+		Role:     m.Role,
+		JoinedAt: m.JoinedAt,
+	}
+}
+
+func newInvitationResponse(i database.Invitation) invitationResponse {
+	return invitationResponse{
+		ID:        i.ID,
+		Email:     i.Email,
+		Role:      i.Role,
+		InvitedBy: i.InvitedBy,
+		ExpiresAt: i.ExpiresAt,
+		CreatedAt: i.CreatedAt,
+	}
+}
+
+// membershipFromContext returns the membership loaded by requireOrgRole.
+func membershipFromContext(ctx context.Context) *database.Membership {
+	m, _ := ctx.Value(membershipContextKey).(*database.Membership)
+	return m
+}
+
+// activeOrganizationID returns the organization selected in the auth
+// session, if any.
+func activeOrganizationID(r *http.Request) string {
+	session, err := gothic.Store.Get(r, auth.SessionName)
+	if err != nil {
+		return ""
+	}
+	id, _ := session.Values[auth.SessionOrganizationIDKey].(string)
+	return id
+}
+
+// setActiveOrganization selects orgID in the auth session.
+func setActiveOrganization(w http.ResponseWriter, r *http.Request, orgID string) error {
+	session, _ := gothic.Store.Get(r, auth.SessionName)
+	session.Values[auth.SessionOrganizationIDKey] = orgID
+	return session.Save(r, w)
+}
+
+// usesSession reports whether the request was authenticated by the auth
+// session rather than a bearer token, so that session values can be set.
+func usesSession(r *http.Request) bool {
+	return r.Header.Get("Authorization") == ""
+}
+
+// requireOrgRole loads the signed-in user's membership of the organization
+// named by the {id} URL parameter and rejects the request unless their role
+// is at least minRole. Non-members get a 404 so that organization IDs are
+// not revealed. It must run after requireUser.
+func (s *Server) requireOrgRole(minRole string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := userFromContext(r.Context())
+
+			m, err := s.db.GetMembership(r.Context(), chi.URLParam(r, "id"), user.ID)
+			if errors.Is(err, database.ErrNotFound) {
+				writeError(w, http.StatusNotFound, "organization not found")
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to load membership", "error", err)
+				writeError(w, http.StatusInternalServerError, "internal server error")
+				return
+			}
+			if orgRoleRank[m.Role] < orgRoleRank[minRole] {
+				writeError(w, http.StatusForbidden, "permission denied")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), membershipContextKey, m)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// createOrganizationHandler creates an organization owned by the signed-in
+// user.
+func (s *Server) createOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	var req organizationRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if !orgSlugPattern.MatchString(req.Slug) {
+		writeError(w, http.StatusBadRequest, "slug must be 2 to 63 lowercase letters, digits or hyphens")
+		return
+	}
+
+	org := &database.Organization{Name: req.Name, Slug: req.Slug}
+	err := s.db.CreateOrganization(r.Context(), org, user.ID)
+	if errors.Is(err, database.ErrSlugTaken) {
+		writeError(w, http.StatusConflict, "slug is already in use")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to create organization", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, org)
+}
+
+// listMyOrganizationsHandler lists the organizations the signed-in user
+// belongs to and flags the active one.
+func (s *Server) listMyOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	var activeID string
+	if usesSession(r) {
+		activeID = activeOrganizationID(r)
+	}
+
+	list, err := s.db.ListUserOrganizations(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list organizations", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	resp := make([]organizationResponse, 0, len(list))
+	for _, m := range list {
+		resp = append(resp, newOrganizationResponse(m, activeID))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"organizations": resp})
+}
+
+// setActiveOrganizationHandler selects the organization the session acts
+// in. The user must be a member of it.
+func (s *Server) setActiveOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	if !usesSession(r) {
+		writeError(w, http.StatusBadRequest, "an active organization can only be set on a session")
+		return
+	}
+
+	var req setActiveOrganizationRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	m, err := s.db.GetMembership(r.Context(), req.OrganizationID, user.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "organization not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load membership", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if err := setActiveOrganization(w, r, m.Organization.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save session", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	writeJSON(w, http.StatusOK, newOrganizationResponse(*m, m.Organization.ID))
+}
+
+func (s *Server) listMembersHandler(w http.ResponseWriter, r *http.Request) {
+	m := membershipFromContext(r.Context())
+
+	list, err := s.db.ListOrganizationMembers(r.Context(), m.Organization.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list members", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	resp := make([]memberResponse, 0, len(list))
+	for i := range list {
+		resp = append(resp, newMemberResponse(list[i]))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"members": resp})
+}
+
+// updateMemberHandler changes a member's role. Only owners can make or
+// unmake owners.
+func (s *Server) updateMemberHandler(w http.ResponseWriter, r *http.Request) {
+	m := membershipFromContext(r.Context())
+	userID := chi.URLParam(r, "userID")
+
+	var req memberRoleRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if _, ok := orgRoleRank[req.Role]; !ok {
+		writeError(w, http.StatusBadRequest, "role must be owner, admin or member")
+		return
+	}
+
+	target, err := s.db.GetMembership(r.Context(), m.Organization.ID, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "member not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load membership", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if (req.Role == database.OrgRoleOwner || target.Role == database.OrgRoleOwner) && m.Role != database.OrgRoleOwner {
+		writeError(w, http.StatusForbidden, "only owners can change owners")
+		return
+	}
+
+	s.writeMemberChange(w, r, s.db.SetMemberRole(r.Context(), m.Organization.ID, userID, req.Role))
+}
+
+// removeMemberHandler removes a member. Members may remove themselves;
+// removing someone else requires admin, and removing an owner requires
+// owner.
+func (s *Server) removeMemberHandler(w http.ResponseWriter, r *http.Request) {
+	m := membershipFromContext(r.Context())
+	userID := chi.URLParam(r, "userID")
+
+	if userID != m.UserID {
+		target, err := s.db.GetMembership(r.Context(), m.Organization.ID, userID)
+		if errors.Is(err, database.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "member not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to load membership", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		if orgRoleRank[m.Role] < orgRoleRank[database.OrgRoleAdmin] || orgRoleRank[target.Role] > orgRoleRank[m.Role] {
+			writeError(w, http.StatusForbidden, "permission denied")
+			return
+		}
+	}
+
+	s.writeMemberChange(w, r, s.db.RemoveMember(r.Context(), m.Organization.ID, userID))
+}
+
+// writeMemberChange responds to the result of changing a membership.
+func (s *Server) writeMemberChange(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		writeError(w, http.StatusNotFound, "member not found")
+	case errors.Is(err, database.ErrLastOwner):
+		writeError(w, http.StatusConflict, "an organization must keep at least one owner")
+	case err != nil:
+		slog.ErrorContext(r.Context(), "Failed to change membership", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// createInvitationHandler invites an email address to the organization and
+// emails it an invitation link. Only owners can invite owners.
+func (s *Server) createInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	m := membershipFromContext(r.Context())
+
+	var req invitationRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "a valid email address is required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = database.OrgRoleMember
+	}
+	if _, ok := orgRoleRank[req.Role]; !ok {
+		writeError(w, http.StatusBadRequest, "role must be owner, admin or member")
+		return
+	}
+	if orgRoleRank[req.Role] > orgRoleRank[m.Role] {
+		writeError(w, http.StatusForbidden, "cannot invite with a role above your own")
+		return
+	}
+
+	ttl := s.config.InvitationTTL
+	if ttl == 0 {
+		ttl = DefaultInvitationTTL
+	}
+
+	token, hash := auth.GenerateToken()
+	inv := &database.Invitation{
+		OrganizationID: m.Organization.ID,
+		Email:          email,
+		Role:           req.Role,
+		InvitedBy:      m.UserID,
+		ExpiresAt:      time.Now().Add(ttl),
+	}
+	if err := s.db.CreateInvitation(r.Context(), inv, hash); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to create invitation", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if err := s.sendInvitationEmail(r.Context(), m.Organization, inv, token); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to send invitation email", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newInvitationResponse(*inv))
+}
+
+// sendInvitationEmail emails an invitation link to the invited address.
+func (s *Server) sendInvitationEmail(ctx context.Context, org database.Organization, inv *database.Invitation, token string) error {
+	if s.mailer == nil {
+		return nil
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      inv.Email,
+		Subject: "You have been invited to join " + org.Name,
+		Body: fmt.Sprintf("You have been invited to join %s as %s. Open the link below and sign in with this address to accept:\n\n%s\n\n"+
+			"The invitation expires on %s.\n",
+			org.Name, inv.Role, tokenLink(s.config.BackendURI+"/invitations/accept", token),
+			inv.ExpiresAt.UTC().Format("2 January 2006 15:04 MST")),
+	})
+}
+
+func (s *Server) listInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	m := membershipFromContext(r.Context())
+
+	list, err := s.db.ListInvitations(r.Context(), m.Organization.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list invitations", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	resp := make([]invitationResponse, 0, len(list))
+	for _, i := range list {
+		resp = append(resp, newInvitationResponse(i))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"invitations": resp})
+}
+
+func (s *Server) deleteInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	m := membershipFromContext(r.Context())
+
+	err := s.db.DeleteInvitation(r.Context(), m.Organization.ID, chi.URLParam(r, "invitationID"))
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "invitation not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to delete invitation", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invitationLinkHandler handles the link in an invitation email. Opening
+// the link never joins anyone, since it is a plain GET that any site can
+// send a signed-in user to. It keeps the token in the session and sends
+// the user to the frontend with ?invitation=, where they sign in if needed
+// and confirm through POST /me/invitations/accept.
+func (s *Server) invitationLinkHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "This invitation link is invalid", http.StatusBadRequest)
+		return
+	}
+
+	session, _ := gothic.Store.Get(r, auth.SessionName)
+	session.Values[auth.SessionInvitationKey] = token
+	if err := session.Save(r, w); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save session", "error", err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	redirectURL := s.config.InvitationRedirectURL
+	if u, err := url.Parse(redirectURL); err == nil {
+		q := u.Query()
+		q.Set("invitation", token)
+		u.RawQuery = q.Encode()
+		redirectURL = u.String()
+	}
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// acceptInvitationHandler accepts an invitation for the signed-in user and
+// makes the organization active in their session. The token may be left
+// out to accept the one kept by invitationLinkHandler. Only the invited
+// address can accept, once the user has verified it.
+func (s *Server) acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	var req acceptInvitationRequest
+	if err := decodeJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Token == "" && usesSession(r) {
+		req.Token = pendingInvitation(r)
+	}
+	if req.Token == "" {
+		writeError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	m, err := s.db.AcceptInvitation(r.Context(), auth.HashToken(req.Token), user.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusBadRequest, "invalid or expired invitation")
+		return
+	}
+	if errors.Is(err, database.ErrInvitationEmail) {
+		writeError(w, http.StatusForbidden, "this invitation was sent to another email address, or yours is not verified yet")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to accept invitation", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if usesSession(r) {
+		session, _ := gothic.Store.Get(r, auth.SessionName)
+		delete(session.Values, auth.SessionInvitationKey)
+		session.Values[auth.SessionOrganizationIDKey] = m.Organization.ID
+		if err := session.Save(r, w); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to save session", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, newOrganizationResponse(*m, m.Organization.ID))
+}
+
+// pendingInvitation returns the invitation token stored by
+// invitationLinkHandler, which replaceSession keeps across sign-in.
+func pendingInvitation(r *http.Request) string {
+	session, err := gothic.Store.Get(r, auth.SessionName)
+	if err != nil {
+		return ""
+	}
+	token, _ := session.Values[auth.SessionInvitationKey].(string)
+	return token
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+func TestOrganizations(t *testing.T) {
+	org := database.Organization{ID: "org-1", Name: "Acme", Slug: "acme"}
+
+	newServer := func(t *testing.T) (*Server, *MockDatabaseService, *recordingMailer) {
+		useTestStore(t)
+		db := &MockDatabaseService{
+			Users: map[string]*database.User{
+				"owner-1":  {ID: "owner-1", Email: "owner@example.com"},
+				"member-1": {ID: "member-1", Email: "member@example.com"},
+				"guest-1":  {ID: "guest-1", Email: "guest@example.com", EmailVerified: true},
+			},
+			Organizations: []database.Organization{org},
+			Memberships: []database.Membership{
+				{Organization: org, UserID: "owner-1", Role: database.OrgRoleOwner},
+				{Organization: org, UserID: "member-1", Role: database.OrgRoleMember},
+			},
+		}
+		mailer := &recordingMailer{}
+		return &Server{
+			config: config.Config{
+				AppURI:                "http://localhost:5173",
+				InvitationRedirectURL: "http://localhost:5173/login",
+				InvitationTTL:         time.Hour,
+			},
+			db:     db,
+			mailer: mailer,
+		}, db, mailer
+	}
+
+	serve := func(s *Server, method, target, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	// invite invites email as role and returns the emailed token.
+	invite := func(t *testing.T, s *Server, mailer *recordingMailer, email, role string) string {
+		t.Helper()
+		w := serve(s, http.MethodPost, "/organizations/org-1/invitations",
+			`{"email": "`+email+`", "role": "`+role+`"}`, sessionCookies(t, "owner-1"))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		msgs := mailer.messages()
+		require.NotEmpty(t, msgs)
+		assert.Equal(t, email, msgs[len(msgs)-1].To)
+		assert.Contains(t, msgs[len(msgs)-1].Body, "/invitations/accept?token=")
+		return linkToken(t, msgs[len(msgs)-1])
+	}
+
+	t.Run("should create an organization owned by the creator", func(t *testing.T) {
+		s, db, _ := newServer(t)
+
+		w := serve(s, http.MethodPost, "/organizations", `{"name": "Globex", "slug": "globex"}`, sessionCookies(t, "guest-1"))
+
+		require.Equal(t, http.StatusCreated, w.Code)
+		m, err := db.GetMembership(context.Background(), "org-2", "guest-1")
+		require.NoError(t, err)
+		assert.Equal(t, database.OrgRoleOwner, m.Role)
+
+		w = serve(s, http.MethodPost, "/organizations", `{"name": "Acme 2", "slug": "acme"}`, sessionCookies(t, "guest-1"))
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("should hide organizations from non-members", func(t *testing.T) {
+		s, _, _ := newServer(t)
+
+		w := serve(s, http.MethodGet, "/organizations/org-1/members", "", sessionCookies(t, "guest-1"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = serve(s, http.MethodGet, "/organizations/org-1/members", "", sessionCookies(t, "member-1"))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Members []memberResponse `json:"members"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Len(t, body.Members, 2)
+		assert.Equal(t, "owner@example.com", body.Members[0].User.Email)
+		for _, field := range []string{"mfa_enabled", "email_verified", "disabled", "created_at"} {
+			assert.NotContains(t, w.Body.String(), field)
+		}
+	})
+
+	t.Run("should only let admins manage members", func(t *testing.T) {
+		s, _, _ := newServer(t)
+
+		w := serve(s, http.MethodPatch, "/organizations/org-1/members/owner-1", `{"role": "member"}`, sessionCookies(t, "member-1"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = serve(s, http.MethodPost, "/organizations/org-1/invitations", `{"email": "x@example.com"}`, sessionCookies(t, "member-1"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("should keep at least one owner", func(t *testing.T) {
+		s, _, _ := newServer(t)
+
+		w := serve(s, http.MethodPatch, "/organizations/org-1/members/owner-1", `{"role": "admin"}`, sessionCookies(t, "owner-1"))
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = serve(s, http.MethodDelete, "/organizations/org-1/members/owner-1", "", sessionCookies(t, "owner-1"))
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("should let members leave", func(t *testing.T) {
+		s, db, _ := newServer(t)
+
+		w := serve(s, http.MethodDelete, "/organizations/org-1/members/member-1", "", sessionCookies(t, "member-1"))
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Len(t, db.Memberships, 1)
+	})
+
+	t.Run("should let a signed-in user accept an invitation", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		token := invite(t, s, mailer, "guest@example.com", database.OrgRoleAdmin)
+
+		w := serve(s, http.MethodPost, "/me/invitations/accept", `{"token": "`+token+`"}`, sessionCookies(t, "guest-1"))
+
+		require.Equal(t, http.StatusOK, w.Code)
+		m, err := db.GetMembership(context.Background(), "org-1", "guest-1")
+		require.NoError(t, err)
+		assert.Equal(t, database.OrgRoleAdmin, m.Role)
+
+		var body organizationResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.True(t, body.Active)
+
+		w = serve(s, http.MethodPost, "/me/invitations/accept", `{"token": "`+token+`"}`, sessionCookies(t, "guest-1"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("should only let the invited address accept", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		token := invite(t, s, mailer, "guest@example.com", database.OrgRoleOwner)
+
+		w := serve(s, http.MethodPost, "/me/invitations/accept", `{"token": "`+token+`"}`, sessionCookies(t, "member-1"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		db.Users["guest-1"].EmailVerified = false
+		w = serve(s, http.MethodPost, "/me/invitations/accept", `{"token": "`+token+`"}`, sessionCookies(t, "guest-1"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		m, err := db.GetMembership(context.Background(), "org-1", "member-1")
+		require.NoError(t, err)
+		assert.Equal(t, database.OrgRoleMember, m.Role)
+		_, err = db.GetMembership(context.Background(), "org-1", "guest-1")
+		assert.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	t.Run("should send signed-out users to sign in with the invitation", func(t *testing.T) {
+		s, _, mailer := newServer(t)
+		token := invite(t, s, mailer, "new@example.com", database.OrgRoleMember)
+
+		w := serve(s, http.MethodGet, "/invitations/accept?token="+url.QueryEscape(token), "", nil)
+
+		require.Equal(t, http.StatusFound, w.Code)
+		location, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "/login", location.Path)
+		assert.Equal(t, token, location.Query().Get("invitation"))
+
+		req := httptest.NewRequest(http.MethodGet, "/auth/google/callback", nil)
+		for _, c := range w.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		assert.Equal(t, token, pendingInvitation(req))
+	})
+
+	t.Run("should only join once the user confirms the invitation", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		token := invite(t, s, mailer, "guest@example.com", database.OrgRoleMember)
+
+		w := serve(s, http.MethodGet, "/invitations/accept?token="+url.QueryEscape(token), "", sessionCookies(t, "guest-1"))
+		require.Equal(t, http.StatusFound, w.Code)
+		_, err := db.GetMembership(context.Background(), "org-1", "guest-1")
+		require.ErrorIs(t, err, database.ErrNotFound)
+
+		req := httptest.NewRequest(http.MethodGet, "/auth/google/callback", nil)
+		for _, c := range w.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		w = httptest.NewRecorder()
+		require.NoError(t, startSession(w, req, "guest-1", "google"))
+
+		w = serve(s, http.MethodPost, "/me/invitations/accept", "", w.Result().Cookies())
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		_, err = db.GetMembership(context.Background(), "org-1", "guest-1")
+		require.NoError(t, err)
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range w.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		assert.Equal(t, "org-1", activeOrganizationID(req))
+		assert.Empty(t, pendingInvitation(req))
+	})
+
+	t.Run("should not let admins invite owners", func(t *testing.T) {
+		s, db, _ := newServer(t)
+		db.Memberships[1].Role = database.OrgRoleAdmin
+
+		w := serve(s, http.MethodPost, "/organizations/org-1/invitations",
+			`{"email": "x@example.com", "role": "owner"}`, sessionCookies(t, "member-1"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("should switch the active organization", func(t *testing.T) {
+		s, _, _ := newServer(t)
+		cookies := sessionCookies(t, "member-1")
+
+		w := serve(s, http.MethodPut, "/me/organization", `{"organization_id": "org-1"}`, cookies)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = serve(s, http.MethodGet, "/me/organizations", "", w.Result().Cookies())
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Organizations []organizationResponse `json:"organizations"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.Len(t, body.Organizations, 1)
+		assert.True(t, body.Organizations[0].Active)
+
+		w = serve(s, http.MethodPut, "/me/organization", `{"organization_id": "org-9"}`, cookies)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
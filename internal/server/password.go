@@ -0,0 +1,133 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// errInvalidCredentials is deliberately vague so that login responses do
+// not reveal whether an email address is registered.
+var errInvalidCredentials = errors.New("invalid email or password")
+
+type registerRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// registerHandler creates a password account and signs it in.
+func (s *Server) registerHandler(w http.ResponseWriter, r *http.Request) {
+	var req registerRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "a valid email address is required")
+		return
+	}
+	if err := auth.CheckPasswordPolicy(req.Password, email); err != nil {
+		writeError(w, http.StatusBadRequest, strings.TrimPrefix(err.Error(), "auth: "))
+		return
+	}
+
+	user, err := s.db.CreatePasswordUser(r.Context(),
+		database.User{Email: email, Name: strings.TrimSpace(req.Name)}, auth.HashPassword(req.Password))
+	if errors.Is(err, database.ErrEmailTaken) {
+		writeError(w, http.StatusConflict, "an account with this email address already exists")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to create user", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if err := s.sendVerificationEmail(r.Context(), user); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to send verification email", "error", err)
+	}
+
+	if err := startSession(w, r, user.ID, auth.PasswordProvider); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save session", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	s.recordEvent(r, database.AuthEvent{Type: database.EventRegistered, UserID: user.ID, Provider: auth.PasswordProvider})
+
+	writeJSON(w, http.StatusCreated, user)
+}
+
+// loginHandler signs in a password account. Repeated failures are
+// throttled by checkLoginThrottle.
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	email, _ := normalizeEmail(req.Email)
+	user, hash, err := s.db.GetUserPasswordHash(r.Context(), email)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		slog.ErrorContext(r.Context(), "Failed to load user", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	var userID string
+	if user != nil {
+		userID = user.ID
+	}
+	accountKey := accountThrottleKey(userID, email)
+	if !s.checkLoginThrottle(w, r, accountKey) {
+		return
+	}
+	if !auth.CheckPassword(req.Password, hash) || user == nil {
+		s.recordLoginFailure(r, userID, auth.PasswordProvider, "invalid_credentials", map[string]interface{}{"email": email})
+		s.throttleLoginFailure(r, userID, accountKey)
+		writeError(w, http.StatusUnauthorized, errInvalidCredentials.Error())
+		return
+	}
+
+	pending, err := s.beginLogin(w, r, user, auth.PasswordProvider)
+	if errors.Is(err, errAccountDisabled) {
+		writeError(w, http.StatusForbidden, errAccountDisabled.Error())
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save session", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if pending {
+		// Failures are cleared once the second factor is checked too.
+		writeJSON(w, http.StatusOK, map[string]bool{"mfa_required": true})
+		return
+	}
+	s.clearLoginFailures(r, user.ID)
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// normalizeEmail returns the lowercased bare address from input and
+// whether it is a valid email address.
+func normalizeEmail(input string) (string, bool) {
+	email := strings.ToLower(strings.TrimSpace(input))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return email, false
+	}
+	return email, true
+}
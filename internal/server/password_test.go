@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+func TestPasswordHandlers(t *testing.T) {
+	existing := &database.User{ID: "user-1", Email: "jane@example.com", Name: "Jane"}
+	oauthOnly := &database.User{ID: "user-2", Email: "oauth@example.com"}
+
+	newServer := func(t *testing.T) *Server {
+		useTestStore(t)
+		return &Server{db: &MockDatabaseService{
+			Users:     map[string]*database.User{existing.ID: existing, oauthOnly.ID: oauthOnly},
+			Passwords: map[string]string{existing.ID: auth.HashPassword("correct horse battery")},
+		}}
+	}
+
+	post := func(s *Server, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	// signedIn reports whether the response's cookies authenticate /me.
+	signedIn := func(s *Server, w *httptest.ResponseRecorder) bool {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		for _, c := range w.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		me := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(me, req)
+		return me.Code == http.StatusOK
+	}
+
+	t.Run("should register and sign in a new user", func(t *testing.T) {
+		s := newServer(t)
+		w := post(s, "/auth/register", `{"email": " New@Example.com ", "password": "a long passphrase", "name": "New"}`)
+
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var user database.User
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+		assert.Equal(t, "new@example.com", user.Email)
+		assert.Equal(t, "New", user.Name)
+		assert.True(t, signedIn(s, w))
+
+		login := post(s, "/auth/login", `{"email": "new@example.com", "password": "a long passphrase"}`)
+		assert.Equal(t, http.StatusOK, login.Code)
+	})
+
+	t.Run("should enforce the password policy", func(t *testing.T) {
+		w := post(newServer(t), "/auth/register", `{"email": "new@example.com", "password": "short"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "at least")
+	})
+
+	t.Run("should reject an invalid email address", func(t *testing.T) {
+		w := post(newServer(t), "/auth/register", `{"email": "not-an-email", "password": "a long passphrase"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("should reject a taken email address", func(t *testing.T) {
+		w := post(newServer(t), "/auth/register", `{"email": "jane@example.com", "password": "a long passphrase"}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("should sign in with the correct password", func(t *testing.T) {
+		s := newServer(t)
+		w := post(s, "/auth/login", `{"email": "Jane@Example.com", "password": "correct horse battery"}`)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), existing.ID)
+		assert.True(t, signedIn(s, w))
+	})
+
+	t.Run("should give the same error for every failed login", func(t *testing.T) {
+		s := newServer(t)
+
+		for _, body := range []string{
+			`{"email": "jane@example.com", "password": "wrong password"}`,
+			`{"email": "nobody@example.com", "password": "correct horse battery"}`,
+			`{"email": "oauth@example.com", "password": "anything at all"}`,
+		} {
+			w := post(s, "/auth/login", body)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code, body)
+			assert.JSONEq(t, `{"error": "invalid email or password"}`, w.Body.String())
+			assert.False(t, signedIn(s, w))
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+// securityPosture describes the security-relevant behavior cfg results in,
+// one setting per line. Settings that are risky in a production deployment
+// are prefixed with "WARNING".
+func securityPosture(cfg *config.Config) []string {
+	prod := cfg.Production()
+	var lines []string
+	add := func(risky bool, format string, args ...any) {
+		line := fmt.Sprintf(format, args...)
+		if risky {
+			line = "WARNING " + line
+		}
+		lines = append(lines, line)
+	}
+
+	if prod {
+		add(false, "environment: %s", cfg.Env)
+	} else {
+		add(false, "environment: %s; set APP_ENV=production to enable the protections below", cfg.Env)
+	}
+
+	if prod {
+		add(false, "session cookies: Secure, HttpOnly, SameSite=Lax")
+		add(false, "HSTS: %s", hstsPolicy)
+		add(false, "error details: hidden from clients")
+	} else {
+		add(false, "session cookies: HttpOnly, SameSite=Lax, sent over plain HTTP")
+		add(false, "HSTS: off")
+		add(false, "error details: shown to clients")
+	}
+
+	if n := len(cfg.CookieKeys); n > 0 {
+		newest := "signed only"
+		if len(cfg.CookieKeys[0].EncryptionKey) > 0 {
+			newest = "signed and encrypted"
+		}
+		add(false, "session cookie keys: %d accepted, newest %s", n, newest)
+	}
+
+	switch {
+	case len(cfg.CORSAllowedOrigins) > 0:
+		add(false, "CORS: %s", strings.Join(cfg.CORSAllowedOrigins, ", "))
+	case prod:
+		add(false, "CORS: same origin only")
+	default:
+		add(false, "CORS: any origin")
+	}
+
+	switch {
+	case !cfg.JWT.Enabled:
+		add(false, "access tokens: off")
+	case strings.HasPrefix(cfg.JWT.Algorithm, "HS"):
+		add(false, "access tokens: %s with a shared secret", cfg.JWT.Algorithm)
+	case cfg.JWT.PrivateKeyFile != "":
+		add(false, "access tokens: %s with the key in %s", cfg.JWT.Algorithm, cfg.JWT.PrivateKeyFile)
+	default:
+		add(prod, "access tokens: %s with an ephemeral key; tokens stop working on restart", cfg.JWT.Algorithm)
+	}
+
+	if cfg.RateLimitStore == "none" {
+		add(prod, "rate limiting: off")
+	} else {
+		add(false, "rate limiting: %s store", cfg.RateLimitStore)
+	}
+
+	if cfg.Mail.Driver == "smtp" {
+		add(false, "mail: SMTP via %s", cfg.Mail.SMTPHost)
+	} else {
+		add(prod, "mail: logged, not delivered")
+	}
+
+	if cfg.AutoLinkVerifiedEmails {
+		add(false, "OAuth accounts: linked automatically by verified email")
+	} else {
+		add(false, "OAuth accounts: never linked automatically")
+	}
+
+	return lines
+}
+
+// logSecurityPosture writes the security posture to the log at startup,
+// one record per setting. Risky settings are logged as warnings.
+func logSecurityPosture(cfg *config.Config) {
+	for _, line := range securityPosture(cfg) {
+		if setting, ok := strings.CutPrefix(line, "WARNING "); ok {
+			slog.Warn("Security posture", "setting", setting)
+		} else {
+			slog.Info("Security posture", "setting", line)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+)
+
+func TestProductionMode(t *testing.T) {
+	newServer := func(env string, origins ...string) *Server {
+		return &Server{
+			config: config.Config{Env: env, CORSAllowedOrigins: origins},
+			db:     &MockDatabaseService{},
+		}
+	}
+
+	serve := func(s *Server, method, target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	preflight := http.Header{
+		"Origin":                        {"https://evil.example.com"},
+		"Access-Control-Request-Method": {"POST"},
+	}
+
+	t.Run("should send HSTS only in production", func(t *testing.T) {
+		w := serve(newServer(config.EnvProduction), http.MethodGet, "/", nil)
+		assert.Equal(t, hstsPolicy, w.Header().Get("Strict-Transport-Security"))
+
+		w = serve(newServer(config.EnvLocal), http.MethodGet, "/", nil)
+		assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+	})
+
+	t.Run("should not fall back to any origin in production", func(t *testing.T) {
+		w := serve(newServer(config.EnvLocal), http.MethodOptions, "/auth/login", preflight)
+		assert.Equal(t, "https://evil.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+		w = serve(newServer(config.EnvProduction), http.MethodOptions, "/auth/login", preflight)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+		w = serve(newServer(config.EnvProduction, "https://app.example.com"), http.MethodOptions, "/auth/login", preflight)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+		preflight.Set("Origin", "https://app.example.com")
+		w = serve(newServer(config.EnvProduction, "https://app.example.com"), http.MethodOptions, "/auth/login", preflight)
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("should hide health details in production", func(t *testing.T) {
+		w := serve(newServer(config.EnvProduction), http.MethodGet, "/health", nil)
+		assert.JSONEq(t, `{"status": "up"}`, w.Body.String())
+
+		w = serve(newServer(config.EnvLocal), http.MethodGet, "/health", nil)
+		assert.Contains(t, w.Body.String(), `"message"`)
+	})
+
+	t.Run("should hide error details in production", func(t *testing.T) {
+		err := errors.New("state mismatch")
+
+		assert.Equal(t, "Authentication failed: state mismatch", newServer(config.EnvLocal).errorDetail("Authentication failed", err))
+		assert.Equal(t, "Authentication failed", newServer(config.EnvProduction).errorDetail("Authentication failed", err))
+	})
+}
+
+func TestSecurityPosture(t *testing.T) {
+	t.Run("should describe a production deployment", func(t *testing.T) {
+		lines := securityPosture(&config.Config{
+			Env:                config.EnvProduction,
+			CORSAllowedOrigins: []string{"https://app.example.com"},
+			RateLimitStore:     "postgres",
+			JWT:                config.JWT{Enabled: true, Algorithm: "RS256"},
+			Mail:               config.Mail{Driver: "smtp", SMTPHost: "smtp.example.com"},
+			CookieKeys: []config.CookieKey{
+				{HashKey: []byte("new"), EncryptionKey: []byte("enc")},
+				{HashKey: []byte("old")},
+			},
+		})
+
+		assert.Contains(t, lines, "session cookies: Secure, HttpOnly, SameSite=Lax")
+		assert.Contains(t, lines, "session cookie keys: 2 accepted, newest signed and encrypted")
+		assert.Contains(t, lines, "HSTS: "+hstsPolicy)
+		assert.Contains(t, lines, "CORS: https://app.example.com")
+		assert.Contains(t, lines, "WARNING access tokens: RS256 with an ephemeral key; tokens stop working on restart")
+		assert.Contains(t, lines, "mail: SMTP via smtp.example.com")
+	})
+
+	t.Run("should not warn about development defaults locally", func(t *testing.T) {
+		lines := securityPosture(&config.Config{Env: config.EnvLocal, RateLimitStore: "memory", Mail: config.Mail{Driver: "log"}})
+
+		assert.Contains(t, lines, "CORS: any origin")
+		assert.Contains(t, lines, "mail: logged, not delivered")
+		for _, line := range lines {
+			assert.NotContains(t, line, "WARNING")
+		}
+	})
+}
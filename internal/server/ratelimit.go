@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/ratelimit"
+)
+
+// rateLimitCleanupInterval is how often refilled buckets are removed from
+// Postgres.
+const rateLimitCleanupInterval = 10 * time.Minute
+
+// newRateLimitStore returns the bucket store selected by RATE_LIMIT_STORE:
+// "memory" (the default), "postgres" to share limits between instances, or
+// "none" to turn rate limiting off.
+func newRateLimitStore(kind string, db database.Service) ratelimit.Store {
+	switch kind {
+	case "postgres":
+		store := ratelimit.NewPGStore(db)
+		go store.Cleanup(context.Background(), rateLimitCleanupInterval)
+		return store
+	case "none":
+		return nil
+	default:
+		return ratelimit.NewMemoryStore()
+	}
+}
+
+// rateLimitKey returns what a request is counted against.
+type rateLimitKey func(r *http.Request) string
+
+// byIP counts requests per client address.
+func byIP(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// byUser counts requests per signed-in user, falling back to the client
+// address on routes that are not behind requireUser.
+func byUser(r *http.Request) string {
+	if user, ok := userFromContext(r.Context()); ok {
+		return "user:" + user.ID
+	}
+	return byIP(r)
+}
+
+// byRoute counts all requests to a route together, whoever makes them.
+func byRoute(r *http.Request) string {
+	return "route:" + r.Method + " " + chi.RouteContext(r.Context()).RoutePattern()
+}
+
+// rateLimitRule is one limit applied by rateLimit.
+type rateLimitRule struct {
+	limit ratelimit.Limit
+	key   rateLimitKey
+}
+
+// rateLimit returns middleware that applies rules to the route group
+// named group.
+func (s *Server) rateLimit(group string, rules ...rateLimitRule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.checkRateLimit(w, r, group, rules...) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// checkRateLimit counts r against rules under group, for handlers whose
+// key is only known once the request has been read. Each rule has its own
+// buckets; a request must fit within all of them, and the headers describe
+// whichever rule is closest to its limit. Otherwise it responds with 429.
+// If the store fails the request is let through, so that an outage of the
+// limiter does not stop people from signing in.
+func (s *Server) checkRateLimit(w http.ResponseWriter, r *http.Request, group string, rules ...rateLimitRule) bool {
+	if s.limiter == nil {
+		return true
+	}
+
+	var tightest *ratelimit.Result
+	for _, rule := range rules {
+		res, err := s.limiter.Take(r.Context(), group+":"+rule.key(r), rule.limit)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to check rate limit", "error", err)
+			continue
+		}
+		if tightest == nil || tighter(res, *tightest) {
+			tightest = &res
+		}
+	}
+	if tightest == nil {
+		return true
+	}
+
+	ratelimit.SetHeaders(w.Header(), *tightest)
+	if !tightest.Allowed {
+		writeError(w, http.StatusTooManyRequests, "too many requests; try again later")
+		return false
+	}
+	return true
+}
+
+// tighter reports whether a is closer to its limit than b: a rejection
+// over an allowed request, then the longer wait or the fewer requests left.
+func tighter(a, b ratelimit.Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/ratelimit"
+)
+
+// failingStore is a ratelimit.Store that is always unavailable.
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("unavailable")
+}
+
+func TestRateLimit(t *testing.T) {
+	newServer := func(t *testing.T) *Server {
+		useTestStore(t)
+		db := &MockDatabaseService{
+			Users: map[string]*database.User{
+				"user-1": {ID: "user-1", Email: "jane@example.com"},
+				"user-2": {ID: "user-2", Email: "john@example.com"},
+			},
+		}
+		return &Server{db: db, limiter: ratelimit.NewMemoryStore()}
+	}
+
+	// Each request uses a new email address so that only the rate limits,
+	// not lockouts, come into play.
+	var attempts int
+	serve := func(s *Server, method, target, remoteAddr string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		attempts++
+		body := fmt.Sprintf(`{"email": "user%d@example.com", "password": "wrong"}`, attempts)
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("should limit login attempts per address", func(t *testing.T) {
+		s := newServer(t)
+
+		for i := range 10 {
+			w := serve(s, http.MethodPost, "/auth/login", "192.0.2.1:1234", nil)
+			require.Equal(t, http.StatusUnauthorized, w.Code, "attempt %d", i+1)
+		}
+		w := serve(s, http.MethodPost, "/auth/login", "192.0.2.1:1234", nil)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "10;w=60", w.Header().Get("RateLimit-Policy"))
+		assert.Equal(t, "6", w.Header().Get("Retry-After"))
+
+		w = serve(s, http.MethodPost, "/auth/login", "198.51.100.7:1234", nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "9", w.Header().Get("RateLimit-Remaining"))
+	})
+
+	t.Run("should share the limit within a route group", func(t *testing.T) {
+		s := newServer(t)
+
+		for range 10 {
+			serve(s, http.MethodPost, "/auth/login", "192.0.2.1:1234", nil)
+		}
+		w := serve(s, http.MethodPost, "/auth/mfa/verify", "192.0.2.1:1234", nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+		w = serve(s, http.MethodGet, "/auth/providers", "192.0.2.1:1234", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	})
+
+	t.Run("should limit signed-in requests per user", func(t *testing.T) {
+		s := newServer(t)
+		jane, john := sessionCookies(t, "user-1"), sessionCookies(t, "user-2")
+
+		w := serve(s, http.MethodGet, "/me", "192.0.2.1:1234", jane)
+		require.Equal(t, http.StatusOK, w.Code)
+		serve(s, http.MethodGet, "/me", "192.0.2.1:1234", jane)
+
+		w = serve(s, http.MethodGet, "/me", "192.0.2.1:1234", john)
+		assert.Equal(t, "299", w.Header().Get("RateLimit-Remaining"))
+	})
+
+	t.Run("should report the limit closest to running out", func(t *testing.T) {
+		s := newServer(t)
+
+		w := serve(s, http.MethodPost, "/auth/password/forgot", "192.0.2.1:1234", nil)
+
+		assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "9", w.Header().Get("RateLimit-Remaining"))
+	})
+
+	t.Run("should let requests through when the store fails", func(t *testing.T) {
+		s := newServer(t)
+		s.limiter = failingStore{}
+
+		w := serve(s, http.MethodPost, "/auth/login", "192.0.2.1:1234", nil)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	})
+}
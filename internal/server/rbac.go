@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// roleNamePattern restricts role names to short lowercase slugs so they
+// are safe to use in URLs.
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+
+// permissionCache holds the signed-in user's effective permissions. It is
+// added to the request context by the auth middleware and filled on first
+// use, so requests that never check a permission do not pay for the query.
+type permissionCache struct {
+	once  sync.Once
+	perms map[string]bool
+	err   error
+}
+
+// userPermissions returns the effective permissions of the user in ctx,
+// loading them at most once per request.
+func (s *Server) userPermissions(ctx context.Context) (map[string]bool, error) {
+	user, ok := userFromContext(ctx)
+	if !ok {
+		return nil, errNotAuthenticated
+	}
+	cache, ok := ctx.Value(permissionsContextKey).(*permissionCache)
+	if !ok {
+		cache = &permissionCache{}
+	}
+
+	cache.once.Do(func() {
+		list, err := s.db.GetUserPermissions(ctx, user.ID)
+		if err != nil {
+			cache.err = err
+			return
+		}
+		cache.perms = make(map[string]bool, len(list))
+		for _, p := range list {
+			cache.perms[p] = true
+		}
+	})
+	return cache.perms, cache.err
+}
+
+// RequirePermission returns middleware that lets a request through only
+// if the signed-in user has permission through one of their roles. It
+// must run after requireUser, requireSession or requireBearerToken.
+func (s *Server) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			perms, err := s.userPermissions(r.Context())
+			if errors.Is(err, errNotAuthenticated) {
+				writeError(w, http.StatusUnauthorized, errNotAuthenticated.Error())
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to load permissions", "error", err)
+				writeError(w, http.StatusInternalServerError, "internal server error")
+				return
+			}
+			if !perms[permission] {
+				writeError(w, http.StatusForbidden, "permission denied")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole returns middleware that lets a request through only if the
+// signed-in user has been assigned role. Like RequirePermission, it must
+// run after one of the authentication middlewares.
+func (s *Server) RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := userFromContext(r.Context())
+			if !ok {
+				writeError(w, http.StatusUnauthorized, errNotAuthenticated.Error())
+				return
+			}
+			roles, err := s.db.ListUserRoles(r.Context(), user.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to list roles", "error", err)
+				writeError(w, http.StatusInternalServerError, "internal server error")
+				return
+			}
+			if !slices.Contains(roles, role) {
+				writeError(w, http.StatusForbidden, "permission denied")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// checkGrant reports whether the signed-in user may hand out role, which
+// grants perms. Only admins can assign or take away AdminRole, and nobody
+// can grant a permission they do not hold themselves, so that roles:write
+// cannot be used to gain more access. Otherwise it responds with 403.
+func (s *Server) checkGrant(w http.ResponseWriter, r *http.Request, role string, perms []string) bool {
+	user, _ := userFromContext(r.Context())
+
+	if role == AdminRole {
+		roles, err := s.db.ListUserRoles(r.Context(), user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to list roles", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return false
+		}
+		if !slices.Contains(roles, AdminRole) {
+			writeError(w, http.StatusForbidden, "only admins can grant the admin role")
+			return false
+		}
+	}
+
+	held, err := s.userPermissions(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load permissions", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return false
+	}
+	for _, p := range perms {
+		if !held[p] {
+			writeError(w, http.StatusForbidden, "cannot grant a permission you do not have: "+p)
+			return false
+		}
+	}
+	return true
+}
+
+// rolePermissions returns the permissions granted by the named role, or
+// nil if there is no such role.
+func (s *Server) rolePermissions(ctx context.Context, name string) ([]string, error) {
+	roles, err := s.db.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if role.Name == name {
+			return role.Permissions, nil
+		}
+	}
+	return nil, nil
+}
+
+type createRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// myPermissionsHandler returns the signed-in user's roles and the
+// permissions they grant.
+func (s *Server) myPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	roles, err := s.db.ListUserRoles(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list roles", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	perms, err := s.db.GetUserPermissions(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load permissions", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]string{"roles": roles, "permissions": perms})
+}
+
+func (s *Server) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := s.db.ListRoles(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list roles", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if roles == nil {
+		roles = []database.Role{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"roles": roles})
+}
+
+func (s *Server) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var req createRoleRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !roleNamePattern.MatchString(req.Name) {
+		writeError(w, http.StatusBadRequest, "role name must be a lowercase slug of at most 64 characters")
+		return
+	}
+
+	role := &database.Role{Name: req.Name, Description: req.Description, Permissions: req.Permissions}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	if !s.checkGrant(w, r, role.Name, role.Permissions) {
+		return
+	}
+
+	err := s.db.CreateRole(r.Context(), role)
+	switch {
+	case errors.Is(err, database.ErrRoleExists):
+		writeError(w, http.StatusConflict, "role already exists")
+	case errors.Is(err, database.ErrUnknownPermission):
+		writeError(w, http.StatusBadRequest, "unknown permission")
+	case err != nil:
+		slog.ErrorContext(r.Context(), "Failed to create role", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	default:
+		details := map[string]interface{}{"role": role.Name, "permissions": role.Permissions}
+		if s.audit(w, r, database.EventAdminRoleCreated, "", details) {
+			writeJSON(w, http.StatusCreated, role)
+		}
+	}
+}
+
+func (s *Server) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	err := s.db.DeleteRole(r.Context(), name)
+	if errors.Is(err, database.ErrProtectedRole) {
+		writeError(w, http.StatusConflict, "the admin role cannot be deleted")
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "role not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to delete role", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if s.audit(w, r, database.EventAdminRoleDeleted, "", map[string]interface{}{"role": name}) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	perms, err := s.db.ListPermissions(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list permissions", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if perms == nil {
+		perms = []database.Permission{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"permissions": perms})
+}
+
+func (s *Server) listUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := s.db.ListUserRoles(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list roles", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"roles": roles})
+}
+
+func (s *Server) assignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role := chi.URLParam(r, "role")
+	perms, err := s.rolePermissions(r.Context(), role)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list roles", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if !s.checkGrant(w, r, role, perms) {
+		return
+	}
+
+	err = s.db.AssignRole(r.Context(), chi.URLParam(r, "id"), role)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "user or role not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to assign role", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	details := map[string]interface{}{"role": role}
+	if s.audit(w, r, database.EventAdminRoleAssigned, chi.URLParam(r, "id"), details) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) unassignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkGrant(w, r, chi.URLParam(r, "role"), nil) {
+		return
+	}
+
+	err := s.db.UnassignRole(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "role"))
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "role assignment not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to unassign role", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	details := map[string]interface{}{"role": chi.URLParam(r, "role")}
+	if s.audit(w, r, database.EventAdminRoleUnassigned, chi.URLParam(r, "id"), details) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+func TestRequirePermission(t *testing.T) {
+	newDB := func() *MockDatabaseService {
+		return &MockDatabaseService{
+			Users: map[string]*database.User{"user-1": {ID: "user-1"}},
+			Roles: []database.Role{{Name: "support", Permissions: []string{"users:read"}}},
+		}
+	}
+
+	serve := func(t *testing.T, db database.Service, ctx context.Context) *httptest.ResponseRecorder {
+		t.Helper()
+		s := &Server{db: db}
+		handler := s.RequirePermission("users:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	withUser := func(userID string) context.Context {
+		ctx := context.WithValue(context.Background(), userContextKey, &database.User{ID: userID})
+		return context.WithValue(ctx, permissionsContextKey, &permissionCache{})
+	}
+
+	t.Run("should reject requests without a user", func(t *testing.T) {
+		w := serve(t, newDB(), context.Background())
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("should reject users without the permission", func(t *testing.T) {
+		w := serve(t, newDB(), withUser("user-1"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("should allow users whose role grants the permission", func(t *testing.T) {
+		db := newDB()
+		db.UserRoles = map[string][]string{"user-1": {"support"}}
+
+		w := serve(t, db, withUser("user-1"))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("should load permissions once per request", func(t *testing.T) {
+		db := &countingPermissionsDB{MockDatabaseService: newDB()}
+		s := &Server{db: db}
+		ctx := withUser("user-1")
+
+		_, err := s.userPermissions(ctx)
+		require.NoError(t, err)
+		_, err = s.userPermissions(ctx)
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, db.calls)
+	})
+}
+
+// countingPermissionsDB counts permission lookups.
+type countingPermissionsDB struct {
+	*MockDatabaseService
+	calls int
+}
+
+func (db *countingPermissionsDB) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	db.calls++
+	return db.MockDatabaseService.GetUserPermissions(ctx, userID)
+}
+
+func TestRoleHandlers(t *testing.T) {
+	newDB := func() *MockDatabaseService {
+		return &MockDatabaseService{
+			Users: map[string]*database.User{
+				"admin-1":   {ID: "admin-1"},
+				"user-1":    {ID: "user-1"},
+				"manager-1": {ID: "manager-1"},
+			},
+			Roles: []database.Role{
+				{Name: "admin", Permissions: []string{"roles:read", "roles:write", "users:read", "users:write"}},
+				{Name: "support", Permissions: []string{"users:read"}},
+				{Name: "role-manager", Permissions: []string{"roles:read", "roles:write", "users:read"}},
+			},
+			UserRoles: map[string][]string{"admin-1": {"admin"}, "manager-1": {"role-manager"}},
+		}
+	}
+
+	serve := func(t *testing.T, db *MockDatabaseService, userID, method, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		useTestStore(t)
+
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for _, c := range sessionCookies(t, userID) {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		(&Server{db: db}).RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("should forbid role management without permission", func(t *testing.T) {
+		w := serve(t, newDB(), "user-1", http.MethodGet, "/roles", "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("should list roles", func(t *testing.T) {
+		w := serve(t, newDB(), "admin-1", http.MethodGet, "/roles", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Roles []database.Role `json:"roles"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Len(t, body.Roles, 3)
+	})
+
+	t.Run("should create a role", func(t *testing.T) {
+		db := newDB()
+		w := serve(t, db, "admin-1", http.MethodPost, "/roles", `{"name": "auditor", "permissions": ["users:read"]}`)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Len(t, db.Roles, 4)
+		require.Len(t, db.AuthEvents, 1)
+		assert.Equal(t, database.EventAdminRoleCreated, db.AuthEvents[0].Type)
+		assert.Equal(t, "admin-1", db.AuthEvents[0].ActorID)
+	})
+
+	t.Run("should delete a role", func(t *testing.T) {
+		db := newDB()
+		w := serve(t, db, "admin-1", http.MethodDelete, "/roles/support", "")
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Len(t, db.Roles, 2)
+		require.Len(t, db.AuthEvents, 1)
+		assert.Equal(t, database.EventAdminRoleDeleted, db.AuthEvents[0].Type)
+		assert.Equal(t, "support", db.AuthEvents[0].Details["role"])
+
+		w = serve(t, db, "admin-1", http.MethodDelete, "/roles/support", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("should not delete the admin role", func(t *testing.T) {
+		db := newDB()
+		w := serve(t, db, "admin-1", http.MethodDelete, "/roles/admin", "")
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Len(t, db.Roles, 3)
+		assert.Empty(t, db.AuthEvents)
+	})
+
+	t.Run("should reject invalid role names", func(t *testing.T) {
+		w := serve(t, newDB(), "admin-1", http.MethodPost, "/roles", `{"name": "Not A Slug"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("should assign a role to a user", func(t *testing.T) {
+		db := newDB()
+		w := serve(t, db, "admin-1", http.MethodPut, "/users/user-1/roles/support", "")
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, []string{"support"}, db.UserRoles["user-1"])
+	})
+
+	t.Run("should only let admins grant or take away the admin role", func(t *testing.T) {
+		db := newDB()
+
+		w := serve(t, db, "manager-1", http.MethodPut, "/users/manager-1/roles/admin", "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = serve(t, db, "manager-1", http.MethodDelete, "/users/admin-1/roles/admin", "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		assert.Equal(t, []string{"role-manager"}, db.UserRoles["manager-1"])
+		assert.Equal(t, []string{"admin"}, db.UserRoles["admin-1"])
+		assert.Empty(t, db.AuthEvents)
+
+		w = serve(t, db, "manager-1", http.MethodPut, "/users/user-1/roles/support", "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("should not grant permissions the caller lacks", func(t *testing.T) {
+		db := newDB()
+
+		w := serve(t, db, "manager-1", http.MethodPost, "/roles", `{"name": "escalate", "permissions": ["users:write"]}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Len(t, db.Roles, 3)
+
+		w = serve(t, db, "manager-1", http.MethodPost, "/roles", `{"name": "viewer", "permissions": ["users:read"]}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		db.Roles = append(db.Roles, database.Role{Name: "writer", Permissions: []string{"users:write"}})
+		w = serve(t, db, "manager-1", http.MethodPut, "/users/manager-1/roles/writer", "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("should report unknown roles", func(t *testing.T) {
+		w := serve(t, newDB(), "admin-1", http.MethodPut, "/users/user-1/roles/nope", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("should return the user's own roles and permissions", func(t *testing.T) {
+		db := newDB()
+		db.UserRoles["user-1"] = []string{"support"}
+		w := serve(t, db, "user-1", http.MethodGet, "/me/permissions", "")
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body map[string][]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, []string{"support"}, body["roles"])
+		assert.Equal(t, []string{"users:read"}, body["permissions"])
+	})
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/mail"
+)
+
+// resetTokenTTL is how long a password reset link stays valid.
+const resetTokenTTL = time.Hour
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// forgotPasswordHandler emails a password reset link. It responds the same
+// way whether or not the address belongs to an account, and the lookup and
+// delivery happen after the response so timing does not reveal it either.
+func (s *Server) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "a valid email address is required")
+		return
+	}
+
+	go func(ctx context.Context) {
+		if err := s.sendPasswordResetEmail(ctx, email); err != nil {
+			slog.ErrorContext(ctx, "Failed to send password reset email", "error", err)
+		}
+	}(context.WithoutCancel(r.Context()))
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordResetEmail emails a reset link to the account with the given
+// address, if there is one.
+func (s *Server) sendPasswordResetEmail(ctx context.Context, email string) error {
+	if s.mailer == nil {
+		return nil
+	}
+
+	user, _, err := s.db.GetUserPasswordHash(ctx, email)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, hash := auth.GenerateToken()
+	err = s.db.CreateOneTimeToken(ctx, user.ID, database.TokenPurposeResetPassword, hash, time.Now().Add(resetTokenTTL))
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your account. To choose a new password, open the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you did not ask for this, you can ignore this email.\n",
+			tokenLink(s.config.PasswordResetURL, token), resetTokenTTL),
+	})
+}
+
+// resetPasswordHandler redeems a reset token and sets a new password. All
+// of the user's sessions and refresh tokens are revoked, so every device
+// has to sign in again. The token is only used up once the new password
+// has passed the policy, so a rejected password does not burn the link.
+func (s *Server) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if err := decodeJSON(w, r, &req); err != nil || req.Token == "" {
+		writeError(w, http.StatusBadRequest, "token and password are required")
+		return
+	}
+	if err := auth.CheckPasswordPolicy(req.Password, ""); err != nil {
+		writeError(w, http.StatusBadRequest, strings.TrimPrefix(err.Error(), "auth: "))
+		return
+	}
+
+	ctx := r.Context()
+	tokenHash := auth.HashToken(req.Token)
+	userID, err := s.db.LookupOneTimeToken(ctx, database.TokenPurposeResetPassword, tokenHash)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusBadRequest, "invalid or expired reset link")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to look up reset token", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	user, err := s.db.GetUserByID(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load user", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if err := auth.CheckPasswordPolicy(req.Password, user.Email); err != nil {
+		writeError(w, http.StatusBadRequest, strings.TrimPrefix(err.Error(), "auth: "))
+		return
+	}
+
+	// Another request may have redeemed the link since the lookup.
+	if _, err := s.db.ConsumeOneTimeToken(ctx, database.TokenPurposeResetPassword, tokenHash); errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusBadRequest, "invalid or expired reset link")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to redeem reset token", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if err := s.resetPassword(ctx, user, req.Password); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to reset password", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	s.recordEvent(r, database.AuthEvent{Type: database.EventPasswordReset, UserID: user.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resetPassword stores the new password and revokes everything that could
+// still authenticate as user. Receiving the reset link also proves control
+// of the email address.
+func (s *Server) resetPassword(ctx context.Context, user *database.User, password string) error {
+	if err := s.db.SetUserPassword(ctx, user.ID, auth.HashPassword(password)); err != nil {
+		return err
+	}
+	if _, err := s.db.DeleteUserSessionsExcept(ctx, user.ID, ""); err != nil {
+		return err
+	}
+	if err := s.db.RevokeUserRefreshTokens(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := s.db.DeleteUserOneTimeTokens(ctx, user.ID, database.TokenPurposeResetPassword); err != nil {
+		return err
+	}
+	return s.db.MarkEmailVerified(ctx, user.ID)
+}
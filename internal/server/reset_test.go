@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+func TestPasswordReset(t *testing.T) {
+	user := &database.User{ID: "user-1", Email: "jane@example.com"}
+
+	newServer := func(t *testing.T) (*Server, *MockDatabaseService, *recordingMailer) {
+		useTestStore(t)
+		db := &MockDatabaseService{
+			Users:     map[string]*database.User{user.ID: {ID: user.ID, Email: user.Email}},
+			Passwords: map[string]string{user.ID: auth.HashPassword("old passphrase")},
+			Sessions: []database.Session{
+				{ID: "s1", UserID: user.ID},
+				{ID: "s2", UserID: user.ID},
+				{ID: "s3", UserID: "someone-else"},
+			},
+		}
+		_, refreshHash := auth.GenerateToken()
+		_, err := db.CreateRefreshToken(context.Background(), user.ID, refreshHash, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		mailer := &recordingMailer{}
+		return &Server{db: db, mailer: mailer}, db, mailer
+	}
+
+	post := func(s *Server, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	// requestReset asks for a reset link and returns its token.
+	requestReset := func(t *testing.T, s *Server, mailer *recordingMailer) string {
+		t.Helper()
+		w := post(s, "/auth/password/forgot", `{"email": "Jane@Example.com"}`)
+		require.Equal(t, http.StatusAccepted, w.Code)
+
+		require.Eventually(t, func() bool { return len(mailer.messages()) == 1 }, time.Second, time.Millisecond)
+		msg := mailer.messages()[0]
+		assert.Equal(t, user.Email, msg.To)
+		return linkToken(t, msg)
+	}
+
+	t.Run("should reset the password and revoke every session", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		token := requestReset(t, s, mailer)
+
+		w := post(s, "/auth/password/reset", `{"token": "`+token+`", "password": "new passphrase"}`)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		assert.True(t, auth.CheckPassword("new passphrase", db.Passwords[user.ID]))
+		require.Len(t, db.Sessions, 1)
+		assert.Equal(t, "someone-else", db.Sessions[0].UserID)
+		assert.Empty(t, db.RefreshTokens)
+		assert.True(t, db.Users[user.ID].EmailVerified)
+
+		login := post(s, "/auth/login", `{"email": "jane@example.com", "password": "new passphrase"}`)
+		assert.Equal(t, http.StatusOK, login.Code)
+	})
+
+	t.Run("should accept a reset link only once", func(t *testing.T) {
+		s, _, mailer := newServer(t)
+		token := requestReset(t, s, mailer)
+		body := `{"token": "` + token + `", "password": "new passphrase"}`
+
+		require.Equal(t, http.StatusNoContent, post(s, "/auth/password/reset", body).Code)
+		assert.Equal(t, http.StatusBadRequest, post(s, "/auth/password/reset", body).Code)
+	})
+
+	t.Run("should not reveal whether an account exists", func(t *testing.T) {
+		s, _, mailer := newServer(t)
+
+		w := post(s, "/auth/password/forgot", `{"email": "nobody@example.com"}`)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Never(t, func() bool { return len(mailer.messages()) > 0 }, 50*time.Millisecond, time.Millisecond)
+	})
+
+	t.Run("should enforce the password policy", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		token := requestReset(t, s, mailer)
+
+		w := post(s, "/auth/password/reset", `{"token": "`+token+`", "password": "short"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Len(t, db.Sessions, 3)
+	})
+
+	t.Run("should keep the link usable after a rejected password", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		token := requestReset(t, s, mailer)
+
+		w := post(s, "/auth/password/reset", `{"token": "`+token+`", "password": "Jane@Example.com"}`)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = post(s, "/auth/password/reset", `{"token": "`+token+`", "password": "new passphrase"}`)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.True(t, auth.CheckPassword("new passphrase", db.Passwords[user.ID]))
+	})
+
+	t.Run("should reject an unknown token", func(t *testing.T) {
+		s, _, _ := newServer(t)
+
+		w := post(s, "/auth/password/reset", `{"token": "nope", "password": "new passphrase"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// writeJSON encodes v as the JSON response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
+
+// maxBodyBytes bounds the size of JSON request bodies.
+const maxBodyBytes = 1 << 20
+
+// decodeJSON decodes the JSON request body into dst, rejecting unknown
+// fields and trailing data.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("request body must contain a single JSON object")
+	}
+	return nil
+}
+
+// writeError responds with a JSON object of the form {"error": message}.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// errorDetail returns message followed by the cause outside production,
+// where it helps debugging. Production responses carry message only; the
+// cause is still logged by the caller.
+func (s *Server) errorDetail(message string, err error) string {
+	if s.config.Production() || err == nil {
+		return message
+	}
+	return message + ": " + err.Error()
+}
@@ -3,58 +3,175 @@ package server
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
-	"strings"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
-	"github.com/joho/godotenv"
 	"github.com/markbates/goth/gothic"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/ratelimit"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: .env not loaded: %v", err)
-	}
+	r.Use(s.forwardedFor)
+	r.Use(assignRequestID)
+	r.Use(logRequests)
 
-	allowedOriginsEnv := os.Getenv("CORS_ALLOWED_ORIGINS")
-	var allowedOrigins []string
-	if allowedOriginsEnv != "" {
-		for _, o := range strings.Split(allowedOriginsEnv, ",") {
-			if s := strings.TrimSpace(o); s != "" {
-				allowedOrigins = append(allowedOrigins, s)
-			}
-		}
+	if s.config.Production() {
+		r.Use(strictTransportSecurity)
 	}
 
-	if len(allowedOrigins) == 0 {
+	// Outside production any origin may call the API while the frontend is
+	// developed. In production only the configured origins may; with none
+	// configured, no CORS headers are sent and browsers allow same-origin
+	// requests only.
+	allowedOrigins := s.config.CORSAllowedOrigins
+	if len(allowedOrigins) == 0 && !s.config.Production() {
 		allowedOrigins = []string{"https://*", "http://*"}
 	}
 
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   allowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
+	if len(allowedOrigins) > 0 {
+		r.Use(cors.Handler(cors.Options{
+			AllowedOrigins:   allowedOrigins,
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", requestIDHeader},
+			ExposedHeaders:   []string{requestIDHeader},
+			AllowCredentials: true,
+			MaxAge:           300,
+		}))
+	}
 
 	r.Get("/", s.HelloWorldHandler)
 
 	r.Get("/health", s.healthHandler)
 
-	r.Get("/auth/{provider}", s.beginAuthHandler)
+	r.Get("/auth/providers", s.providersHandler)
+
+	// Rate limits per route group. Sign-in attempts are counted per client
+	// address. Endpoints that send email are also capped across all clients
+	// so that an attack cannot exhaust the mail provider's quota.
+	oauthLimit := s.rateLimit("oauth", rateLimitRule{ratelimit.PerMinute(30), byIP})
+	loginLimit := s.rateLimit("login", rateLimitRule{ratelimit.PerMinute(10), byIP})
+	mailLimit := s.rateLimit("mail",
+		rateLimitRule{ratelimit.PerHour(10), byIP},
+		rateLimitRule{ratelimit.PerMinute(100), byRoute},
+	)
+	tokenLimit := s.rateLimit("token", rateLimitRule{ratelimit.PerMinute(30), byIP})
+	apiLimit := s.rateLimit("api", rateLimitRule{ratelimit.PerMinute(300), byUser})
+
+	r.Group(func(r chi.Router) {
+		r.Use(loginLimit)
+
+		r.Post("/auth/register", s.registerHandler)
+		r.Post("/auth/login", s.loginHandler)
+		r.Get("/auth/verify", s.verifyEmailHandler)
+		r.Post("/auth/password/reset", s.resetPasswordHandler)
+		r.Post("/auth/mfa/verify", s.verifyMFAHandler)
+		r.Get("/auth/magic-link/callback", s.magicLinkCallbackHandler)
 
-	r.Get("/auth/{provider}/callback", s.getAuthCallbackFunction)
+		if s.passkeys != nil {
+			r.Post("/auth/webauthn/login/begin", s.beginWebAuthnLoginHandler)
+			r.Post("/auth/webauthn/login/finish", s.finishWebAuthnLoginHandler)
+		}
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(mailLimit)
+
+		r.Post("/auth/password/forgot", s.forgotPasswordHandler)
+		r.Post("/auth/magic-link", s.requestMagicLinkHandler)
+	})
+
+	r.Get("/invitations/accept", s.invitationLinkHandler)
+
+	r.Group(func(r chi.Router) {
+		r.Use(oauthLimit)
+
+		r.Get("/auth/{provider}", s.beginAuthHandler)
+		r.Get("/auth/{provider}/callback", s.getAuthCallbackFunction)
+	})
 
 	r.Get("/logout/{provider}", s.logout)
 
+	if s.tokens != nil {
+		r.Get("/.well-known/jwks.json", s.jwksHandler)
+		r.With(tokenLimit, s.requireSession).Post("/auth/token", s.issueTokenHandler)
+		r.With(tokenLimit).Post("/auth/token/refresh", s.refreshTokenHandler)
+	}
+
+	if s.passkeys != nil {
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireSession, apiLimit)
+
+			r.Post("/me/webauthn/register/begin", s.beginWebAuthnRegistrationHandler)
+			r.Post("/me/webauthn/register/finish", s.finishWebAuthnRegistrationHandler)
+			r.Post("/me/webauthn/verify/begin", s.beginWebAuthnVerifyHandler)
+			r.Post("/me/webauthn/verify/finish", s.finishWebAuthnVerifyHandler)
+			r.Get("/me/webauthn/credentials", s.listWebAuthnCredentialsHandler)
+			r.Delete("/me/webauthn/credentials/{id}", s.deleteWebAuthnCredentialHandler)
+		})
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.requireUser, apiLimit)
+
+		r.Get("/me", s.meHandler)
+		r.With(mailLimit).Post("/me/verify-email", s.resendVerificationHandler)
+		r.Post("/me/mfa/totp", s.enrollTOTPHandler)
+		r.Post("/me/mfa/totp/confirm", s.confirmTOTPHandler)
+		r.Delete("/me/mfa/totp", s.disableTOTPHandler)
+		r.Get("/me/identities", s.listIdentitiesHandler)
+		r.Delete("/me/identities/{id}", s.unlinkIdentityHandler)
+		r.Get("/me/sessions", s.listSessionsHandler)
+		r.Delete("/me/sessions", s.revokeOtherSessionsHandler)
+		r.Delete("/me/sessions/{id}", s.revokeSessionHandler)
+		r.Get("/me/permissions", s.myPermissionsHandler)
+		r.Get("/me/security-activity", s.myActivityHandler)
+
+		r.With(s.RequirePermission("roles:read")).Get("/roles", s.listRolesHandler)
+		r.With(s.RequirePermission("roles:write")).Post("/roles", s.createRoleHandler)
+		r.With(s.RequirePermission("roles:write")).Delete("/roles/{name}", s.deleteRoleHandler)
+		r.With(s.RequirePermission("roles:read")).Get("/permissions", s.listPermissionsHandler)
+		r.With(s.RequirePermission("roles:read")).Get("/users/{id}/roles", s.listUserRolesHandler)
+		r.With(s.RequirePermission("roles:write")).Put("/users/{id}/roles/{role}", s.assignRoleHandler)
+		r.With(s.RequirePermission("roles:write")).Delete("/users/{id}/roles/{role}", s.unassignRoleHandler)
+
+		r.Get("/me/organizations", s.listMyOrganizationsHandler)
+		r.Put("/me/organization", s.setActiveOrganizationHandler)
+		r.Post("/me/invitations/accept", s.acceptInvitationHandler)
+		r.Post("/organizations", s.createOrganizationHandler)
+
+		r.Route("/organizations/{id}", func(r chi.Router) {
+			r.With(s.requireOrgRole(database.OrgRoleMember)).Get("/members", s.listMembersHandler)
+			r.With(s.requireOrgRole(database.OrgRoleMember)).Delete("/members/{userID}", s.removeMemberHandler)
+			r.With(s.requireOrgRole(database.OrgRoleAdmin)).Patch("/members/{userID}", s.updateMemberHandler)
+			r.With(s.requireOrgRole(database.OrgRoleAdmin)).Get("/invitations", s.listInvitationsHandler)
+			r.With(s.requireOrgRole(database.OrgRoleAdmin)).Post("/invitations", s.createInvitationHandler)
+			r.With(s.requireOrgRole(database.OrgRoleAdmin)).Delete("/invitations/{invitationID}", s.deleteInvitationHandler)
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(s.RequireRole(AdminRole))
+
+			r.Get("/users", s.adminListUsersHandler)
+			r.Get("/users/{id}", s.adminGetUserHandler)
+			r.Get("/users/{id}/identities", s.adminListIdentitiesHandler)
+			r.Get("/users/{id}/sessions", s.adminListSessionsHandler)
+			r.Post("/users/{id}/disable", s.adminDisableUserHandler)
+			r.Post("/users/{id}/enable", s.adminEnableUserHandler)
+			r.Post("/users/{id}/logout", s.adminLogoutUserHandler)
+			r.Delete("/users/{id}/mfa", s.adminResetMFAHandler)
+			r.Post("/users/{id}/unlock", s.adminUnlockUserHandler)
+			r.Get("/events", s.adminEventsHandler)
+		})
+	})
+
 	return r
 }
 
@@ -64,55 +181,133 @@ func (s *Server) HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
 
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
-		log.Fatalf("error handling JSON marshal. Err: %v", err)
+		slog.ErrorContext(r.Context(), "Failed to marshal JSON", "error", err)
+		os.Exit(1)
 	}
 
 	_, _ = w.Write(jsonResp)
 }
 
+// healthHandler reports the database status. Connection pool statistics
+// and error messages are left out in production.
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
-	jsonResp, _ := json.Marshal(s.db.Health())
+	health := s.db.Health()
+	if s.config.Production() {
+		health = map[string]string{"status": health["status"]}
+	}
+	jsonResp, _ := json.Marshal(health)
 	_, _ = w.Write(jsonResp)
 }
 
+func (s *Server) providersHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"providers": auth.Providers()})
+}
+
+// beginAuthHandler starts an OAuth flow. With ?mode=link a signed-in user
+// links the provider account to their own instead of signing in with it.
 func (s *Server) beginAuthHandler(w http.ResponseWriter, r *http.Request) {
 	provider := chi.URLParam(r, "provider")
 
+	var linkUserID string
+	if r.URL.Query().Get("mode") == "link" {
+		userID, _, err := s.sessionUser(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, errNotAuthenticated.Error())
+			return
+		}
+		linkUserID = userID
+	}
+	if err := setLinkUser(w, r, linkUserID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save session", "error", err)
+		http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		return
+	}
+
 	r = r.WithContext(context.WithValue(r.Context(), "provider", provider))
 
 	gothic.BeginAuthHandler(w, r)
 }
 
 func (s *Server) getAuthCallbackFunction(w http.ResponseWriter, r *http.Request) {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading environment variables")
-	}
-
 	provider := chi.URLParam(r, "provider")
-	redirectURL := os.Getenv("APP_URI")
+	redirectURL := s.config.AppURI
 
 	r = r.WithContext(context.WithValue(r.Context(), "provider", provider))
 
 	user, err := gothic.CompleteUserAuth(w, r)
 	if err != nil {
-		log.Printf("Auth error: %v", err)
-		http.Error(w, "Authentication failed: "+err.Error(), http.StatusUnauthorized)
+		slog.WarnContext(r.Context(), "OAuth sign-in failed", "provider", provider, "error", err)
+		s.recordLoginFailure(r, "", provider, "provider_error", map[string]interface{}{"error": err.Error()})
+		http.Error(w, s.errorDetail("Authentication failed", err), http.StatusUnauthorized)
 		return
 	}
 
-	log.Printf("User authenticated: %s (%s)", user.Name, user.Email)
+	profile, identity := profileFromGothUser(user)
+
+	linkUserID, err := takeLinkUser(w, r)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save session", "error", err)
+		http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		return
+	}
+	if linkUserID != "" {
+		s.completeLink(w, r, linkUserID, identity)
+		return
+	}
+
+	dbUser, err := s.db.UpsertOAuthUser(r.Context(), profile, identity)
+	if errors.Is(err, database.ErrEmailTaken) && s.config.AutoLinkVerifiedEmails {
+		dbUser, err = s.autoLink(r.Context(), identity)
+		if err == nil {
+			s.recordEvent(r, database.AuthEvent{
+				Type:     database.EventIdentityLinked,
+				UserID:   dbUser.ID,
+				Provider: identity.Provider,
+				Details:  map[string]interface{}{"automatic": true},
+			})
+		}
+	}
+	if errors.Is(err, database.ErrEmailTaken) {
+		s.recordLoginFailure(r, "", provider, "email_taken", map[string]interface{}{"email": identity.Email})
+		http.Error(w, "An account with this email address already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to persist user", "error", err)
+		http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		return
+	}
+
+	pending, err := s.beginLogin(w, r, dbUser, provider)
+	if errors.Is(err, errAccountDisabled) {
+		http.Error(w, "Account disabled", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to save session", "error", err)
+		http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		return
+	}
+	if pending {
+		redirectURL = s.config.MFARedirectURL
+	}
 
 	http.Redirect(w, r, redirectURL, http.StatusFound)
 }
 
 func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env File")
+	if userID, _, err := s.sessionUser(r); err == nil {
+		s.recordEvent(r, database.AuthEvent{Type: database.EventLogout, UserID: userID, Provider: chi.URLParam(r, "provider")})
 	}
-	postLogoutRedirectURL := os.Getenv("POST_LOGOUT_REDIRECT_URL")
 	gothic.Logout(w, r)
-	w.Header().Set("Location", postLogoutRedirectURL)
+	if err := endSession(w, r); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to end session", "error", err)
+	}
+	w.Header().Set("Location", s.config.PostLogoutRedirectURL)
 	w.WriteHeader(http.StatusTemporaryRedirect)
 }
+
+func (s *Server) meHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	writeJSON(w, http.StatusOK, user)
+}
@@ -5,12 +5,16 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/providers/google"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/config"
 )
 
 func TestHelloWorldHandler(t *testing.T) {
@@ -136,13 +140,10 @@ func TestBeginAuthHandler(t *testing.T) {
 }
 
 func TestGetAuthCallbackFunction(t *testing.T) {
-	t.Skip("Skipping auth callback tests - handler calls log.Fatal which terminates tests")
+	t.Skip("Skipping auth callback tests - handler needs a completed OAuth handshake")
 
 	t.Run("should handle auth callback route", func(t *testing.T) {
-		os.Setenv("APP_URI", "http://localhost:3000")
-		defer os.Unsetenv("APP_URI")
-
-		s := &Server{}
+		s := &Server{config: config.Config{AppURI: "http://localhost:3000"}}
 
 		r := chi.NewRouter()
 		r.Get("/auth/{provider}/callback", s.getAuthCallbackFunction)
@@ -153,39 +154,15 @@ func TestGetAuthCallbackFunction(t *testing.T) {
 		r.ServeHTTP(w, req)
 
 	})
-
-	t.Run("should require APP_URI environment variable", func(t *testing.T) {
-		originalValue := os.Getenv("APP_URI")
-		os.Setenv("APP_URI", "http://localhost:3000")
-		defer func() {
-			if originalValue != "" {
-				os.Setenv("APP_URI", originalValue)
-			} else {
-				os.Unsetenv("APP_URI")
-			}
-		}()
-
-		s := &Server{}
-		r := chi.NewRouter()
-		r.Get("/auth/{provider}/callback", s.getAuthCallbackFunction)
-
-		req := httptest.NewRequest(http.MethodGet, "/auth/github/callback", nil)
-		w := httptest.NewRecorder()
-
-		r.ServeHTTP(w, req)
-
-	})
 }
 
 func TestLogout(t *testing.T) {
-
-	t.Skip("Skipping logout tests - handler calls log.Fatal which terminates tests")
-
 	t.Run("should handle logout route", func(t *testing.T) {
-		os.Setenv("POST_LOGOUT_REDIRECT_URL", "http://localhost:3000/login")
-		defer os.Unsetenv("POST_LOGOUT_REDIRECT_URL")
-
-		s := &Server{}
+		useTestStore(t)
+		s := &Server{
+			config: config.Config{PostLogoutRedirectURL: "http://localhost:3000/login"},
+			db:     &MockDatabaseService{},
+		}
 
 		r := chi.NewRouter()
 		r.Get("/logout/{provider}", s.logout)
@@ -202,10 +179,11 @@ func TestLogout(t *testing.T) {
 	})
 
 	t.Run("should handle different providers for logout", func(t *testing.T) {
-		os.Setenv("POST_LOGOUT_REDIRECT_URL", "http://localhost:3000")
-		defer os.Unsetenv("POST_LOGOUT_REDIRECT_URL")
-
-		s := &Server{}
+		useTestStore(t)
+		s := &Server{
+			config: config.Config{PostLogoutRedirectURL: "http://localhost:3000"},
+			db:     &MockDatabaseService{},
+		}
 		providers := []string{"google", "github", "facebook"}
 
 		for _, provider := range providers {
@@ -225,11 +203,11 @@ func TestLogout(t *testing.T) {
 
 func TestRegisterRoutes(t *testing.T) {
 	t.Run("should register all routes", func(t *testing.T) {
-		os.Setenv("CORS_ALLOWED_ORIGINS", "http://localhost:3000")
-		defer os.Unsetenv("CORS_ALLOWED_ORIGINS")
-
 		mockDB := &MockDatabaseService{}
-		s := &Server{db: mockDB}
+		s := &Server{
+			config: config.Config{CORSAllowedOrigins: []string{"http://localhost:3000"}},
+			db:     mockDB,
+		}
 
 		handler := s.RegisterRoutes()
 		require.NotNil(t, handler)
@@ -238,11 +216,11 @@ func TestRegisterRoutes(t *testing.T) {
 	})
 
 	t.Run("should handle root route", func(t *testing.T) {
-		os.Setenv("CORS_ALLOWED_ORIGINS", "http://localhost:3000")
-		defer os.Unsetenv("CORS_ALLOWED_ORIGINS")
-
 		mockDB := &MockDatabaseService{}
-		s := &Server{db: mockDB}
+		s := &Server{
+			config: config.Config{CORSAllowedOrigins: []string{"http://localhost:3000"}},
+			db:     mockDB,
+		}
 
 		handler := s.RegisterRoutes()
 
@@ -264,11 +242,11 @@ func TestRegisterRoutes(t *testing.T) {
 	})
 
 	t.Run("should handle health route", func(t *testing.T) {
-		os.Setenv("CORS_ALLOWED_ORIGINS", "http://localhost:3000")
-		defer os.Unsetenv("CORS_ALLOWED_ORIGINS")
-
 		mockDB := &MockDatabaseService{}
-		s := &Server{db: mockDB}
+		s := &Server{
+			config: config.Config{CORSAllowedOrigins: []string{"http://localhost:3000"}},
+			db:     mockDB,
+		}
 
 		handler := s.RegisterRoutes()
 
@@ -290,11 +268,11 @@ func TestRegisterRoutes(t *testing.T) {
 	})
 
 	t.Run("should handle CORS configuration", func(t *testing.T) {
-		os.Setenv("CORS_ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:8080")
-		defer os.Unsetenv("CORS_ALLOWED_ORIGINS")
-
 		mockDB := &MockDatabaseService{}
-		s := &Server{db: mockDB}
+		s := &Server{
+			config: config.Config{CORSAllowedOrigins: []string{"http://localhost:3000", "http://localhost:8080"}},
+			db:     mockDB,
+		}
 
 		handler := s.RegisterRoutes()
 
@@ -308,9 +286,7 @@ func TestRegisterRoutes(t *testing.T) {
 		assert.NotEmpty(t, w.Header().Get("Access-Control-Allow-Origin"))
 	})
 
-	t.Run("should use default CORS when env not set", func(t *testing.T) {
-		os.Unsetenv("CORS_ALLOWED_ORIGINS")
-
+	t.Run("should use default CORS when no origins are configured", func(t *testing.T) {
 		mockDB := &MockDatabaseService{}
 		s := &Server{db: mockDB}
 
@@ -321,11 +297,11 @@ func TestRegisterRoutes(t *testing.T) {
 	})
 
 	t.Run("should handle 404 for unknown routes", func(t *testing.T) {
-		os.Setenv("CORS_ALLOWED_ORIGINS", "http://localhost:3000")
-		defer os.Unsetenv("CORS_ALLOWED_ORIGINS")
-
 		mockDB := &MockDatabaseService{}
-		s := &Server{db: mockDB}
+		s := &Server{
+			config: config.Config{CORSAllowedOrigins: []string{"http://localhost:3000"}},
+			db:     mockDB,
+		}
 
 		handler := s.RegisterRoutes()
 
@@ -337,3 +313,29 @@ func TestRegisterRoutes(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
 }
+
+func TestProvidersHandler(t *testing.T) {
+	t.Run("should list enabled providers", func(t *testing.T) {
+		goth.ClearProviders()
+		defer goth.ClearProviders()
+		goth.UseProviders(google.New("id", "secret", "http://localhost:3000/auth/google/callback"))
+
+		s := &Server{db: &MockDatabaseService{}}
+		handler := s.RegisterRoutes()
+
+		req := httptest.NewRequest(http.MethodGet, "/auth/providers", nil)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Providers []auth.ProviderInfo `json:"providers"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.Len(t, body.Providers, 1)
+		assert.Equal(t, "google", body.Providers[0].Name)
+		assert.Equal(t, "/auth/google", body.Providers[0].AuthURL)
+	})
+}
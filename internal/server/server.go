@@ -1,34 +1,80 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
-	"strconv"
 	"time"
 
-	_ "github.com/joho/godotenv/autoload"
+	"github.com/go-webauthn/webauthn/webauthn"
 
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/config"
 	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/mail"
+	"github.com/GRACENOBLE/auth-starter/internal/ratelimit"
 )
 
 type Server struct {
-	port int
+	// config is the configuration loaded at startup.
+	config config.Config
 
 	db database.Service
+
+	// tokens issues and validates JWT access tokens; nil when disabled.
+	tokens *auth.TokenIssuer
+
+	// mailer sends verification and other account emails.
+	mailer mail.Mailer
+
+	// passkeys runs WebAuthn ceremonies; nil when disabled.
+	passkeys *webauthn.WebAuthn
+
+	// limiter holds the buckets for the rate limits set up in
+	// RegisterRoutes; nil turns rate limiting off.
+	limiter ratelimit.Store
 }
 
-func NewServer() *http.Server {
-	port, _ := strconv.Atoi(os.Getenv("PORT"))
+// NewServer builds the HTTP server described by cfg, backed by db.
+func NewServer(cfg *config.Config, db database.Service) *http.Server {
+	tokens, err := auth.NewTokenIssuerFromConfig(cfg.JWT)
+	if err != nil {
+		slog.Error("Invalid JWT configuration", "error", err)
+		os.Exit(1)
+	}
+
+	mailer, err := mail.NewFromConfig(cfg.Mail)
+	if err != nil {
+		slog.Error("Invalid mail configuration", "error", err)
+		os.Exit(1)
+	}
+
+	passkeys, err := auth.NewWebAuthnFromConfig(cfg)
+	if err != nil {
+		slog.Error("Invalid WebAuthn configuration", "error", err)
+		os.Exit(1)
+	}
+
 	NewServer := &Server{
-		port: port,
+		config: *cfg,
 
-		db: database.New(),
+		db:       db,
+		tokens:   tokens,
+		mailer:   mailer,
+		passkeys: passkeys,
+
+		limiter: newRateLimitStore(cfg.RateLimitStore, db),
 	}
 
+	go NewServer.cleanupLoginThrottles(context.Background(), loginThrottleCleanupInterval)
+
+	logSecurityPosture(cfg)
+
 	// Declare Server config
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", NewServer.port),
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
 		Handler:      NewServer.RegisterRoutes(),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
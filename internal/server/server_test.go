@@ -1,16 +1,73 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"net/http"
-	"os"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/config"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
 )
 
-type MockDatabaseService struct{}
+// MockDatabaseService embeds database.Service so that it satisfies the
+// interface; methods not overridden here panic if called.
+type MockDatabaseService struct {
+	database.Service
+
+	Users         map[string]*database.User
+	Sessions      []database.Session
+	RefreshTokens map[string]*mockRefreshToken
+	Passwords     map[string]string // password hashes by user ID
+	OneTimeTokens map[string]*mockOneTimeToken
+	TOTP          map[string]*mockTOTP
+	Passkeys      []database.WebAuthnCredential
+	Identities    []database.Identity
+	Roles         []database.Role
+	UserRoles     map[string][]string // role names by user ID
+	Organizations []database.Organization
+	Memberships   []database.Membership
+	Invitations   map[string]*mockInvitation
+	AuthEvents    []database.AuthEvent
+	Throttles     map[string]*database.LoginThrottle
+}
+
+// mockInvitation is an organization invitation held by
+// MockDatabaseService, keyed by its token hash.
+type mockInvitation struct {
+	database.Invitation
+	Accepted bool
+}
+
+// mockTOTP is a TOTP enrollment held by MockDatabaseService, keyed by user
+// ID.
+type mockTOTP struct {
+	database.TOTP
+	LastStep      int64
+	RecoveryCodes map[string]bool // hash -> used
+}
+
+// mockOneTimeToken is a one-time token held by MockDatabaseService, keyed
+// by its hash.
+type mockOneTimeToken struct {
+	UserID    string
+	Purpose   string
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// mockRefreshToken is a refresh token held by MockDatabaseService, keyed by
+// its hash.
+type mockRefreshToken struct {
+	database.RefreshToken
+	Used bool
+}
 
 func (m *MockDatabaseService) Health() map[string]string {
 	return map[string]string{
@@ -23,59 +80,653 @@ func (m *MockDatabaseService) Close() error {
 	return nil
 }
 
-func TestNewServer(t *testing.T) {
-	t.Run("should create server with correct configuration", func(t *testing.T) {
-	
-		os.Setenv("PORT", "3000")
-		defer os.Unsetenv("PORT")
+func (m *MockDatabaseService) GetUserByID(ctx context.Context, id string) (*database.User, error) {
+	user, ok := m.Users[id]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return user, nil
+}
 
-		server := NewServer()
+func (m *MockDatabaseService) GetUserByEmail(ctx context.Context, email string) (*database.User, error) {
+	for _, u := range m.Users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
 
-		require.NotNil(t, server)
-		assert.Equal(t, ":3000", server.Addr)
-		assert.NotNil(t, server.Handler)
-		assert.Equal(t, time.Minute, server.IdleTimeout)
-		assert.Equal(t, 10*time.Second, server.ReadTimeout)
-		assert.Equal(t, 30*time.Second, server.WriteTimeout)
-	})
+func (m *MockDatabaseService) ListUserIdentities(ctx context.Context, userID string) ([]database.Identity, error) {
+	var list []database.Identity
+	for _, i := range m.Identities {
+		if i.UserID == userID {
+			list = append(list, i)
+		}
+	}
+	return list, nil
+}
+
+func (m *MockDatabaseService) LinkIdentity(ctx context.Context, userID string, identity database.Identity) error {
+	for _, i := range m.Identities {
+		if i.Provider == identity.Provider && i.ProviderUserID == identity.ProviderUserID {
+			if i.UserID != userID {
+				return database.ErrIdentityTaken
+			}
+			return nil
+		}
+	}
+	identity.ID = fmt.Sprintf("identity-%d", len(m.Identities)+1)
+	identity.UserID = userID
+	m.Identities = append(m.Identities, identity)
+	return nil
+}
 
-	t.Run("should handle missing PORT environment variable", func(t *testing.T) {
-		os.Unsetenv("PORT")
+func (m *MockDatabaseService) UnlinkIdentity(ctx context.Context, userID, identityID string) error {
+	for i, identity := range m.Identities {
+		if identity.UserID != userID || identity.ID != identityID {
+			continue
+		}
+		remaining, _ := m.ListUserIdentities(ctx, userID)
+		passkeys, _ := m.ListWebAuthnCredentials(ctx, userID)
+		if len(remaining) == 1 && len(passkeys) == 0 && m.Passwords[userID] == "" {
+			return database.ErrLastLoginMethod
+		}
+		m.Identities = append(m.Identities[:i], m.Identities[i+1:]...)
+		return nil
+	}
+	return database.ErrNotFound
+}
 
-		server := NewServer()
+func (m *MockDatabaseService) CreatePasswordUser(ctx context.Context, profile database.User, passwordHash string) (*database.User, error) {
+	for _, u := range m.Users {
+		if u.Email == profile.Email {
+			return nil, database.ErrEmailTaken
+		}
+	}
+	if m.Users == nil {
+		m.Users = map[string]*database.User{}
+	}
+	if m.Passwords == nil {
+		m.Passwords = map[string]string{}
+	}
 
-		require.NotNil(t, server)
-		assert.Equal(t, ":0", server.Addr)
-	})
+	user := profile
+	user.ID = fmt.Sprintf("user-%d", len(m.Users)+1)
+	m.Users[user.ID] = &user
+	m.Passwords[user.ID] = passwordHash
+	return &user, nil
+}
+
+func (m *MockDatabaseService) GetUserPasswordHash(ctx context.Context, email string) (*database.User, string, error) {
+	for _, u := range m.Users {
+		if u.Email == email {
+			return u, m.Passwords[u.ID], nil
+		}
+	}
+	return nil, "", database.ErrNotFound
+}
+
+func (m *MockDatabaseService) MarkEmailVerified(ctx context.Context, userID string) error {
+	user, ok := m.Users[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	user.EmailVerified = true
+	return nil
+}
+
+func (m *MockDatabaseService) SetUserPassword(ctx context.Context, userID, passwordHash string) error {
+	if _, ok := m.Users[userID]; !ok {
+		return database.ErrNotFound
+	}
+	if m.Passwords == nil {
+		m.Passwords = map[string]string{}
+	}
+	m.Passwords[userID] = passwordHash
+	return nil
+}
+
+func (m *MockDatabaseService) DeleteUserOneTimeTokens(ctx context.Context, userID, purpose string) error {
+	for hash, t := range m.OneTimeTokens {
+		if t.UserID == userID && t.Purpose == purpose {
+			delete(m.OneTimeTokens, hash)
+		}
+	}
+	return nil
+}
+
+func (m *MockDatabaseService) CreateOneTimeToken(ctx context.Context, userID, purpose string, tokenHash []byte, expiresAt time.Time) error {
+	if m.OneTimeTokens == nil {
+		m.OneTimeTokens = map[string]*mockOneTimeToken{}
+	}
+	m.OneTimeTokens[string(tokenHash)] = &mockOneTimeToken{UserID: userID, Purpose: purpose, ExpiresAt: expiresAt}
+	return nil
+}
 
-	t.Run("should handle invalid PORT environment variable", func(t *testing.T) {
-		os.Setenv("PORT", "invalid")
-		defer os.Unsetenv("PORT")
+func (m *MockDatabaseService) ConsumeOneTimeToken(ctx context.Context, purpose string, tokenHash []byte) (string, error) {
+	userID, err := m.LookupOneTimeToken(ctx, purpose, tokenHash)
+	if err != nil {
+		return "", err
+	}
+	m.OneTimeTokens[string(tokenHash)].Used = true
+	return userID, nil
+}
+
+func (m *MockDatabaseService) LookupOneTimeToken(ctx context.Context, purpose string, tokenHash []byte) (string, error) {
+	t, ok := m.OneTimeTokens[string(tokenHash)]
+	if !ok || t.Used || t.Purpose != purpose || !t.ExpiresAt.After(time.Now()) {
+		return "", database.ErrNotFound
+	}
+	return t.UserID, nil
+}
+
+func (m *MockDatabaseService) ListUserSessions(ctx context.Context, userID string) ([]database.Session, error) {
+	var list []database.Session
+	for _, sess := range m.Sessions {
+		if sess.UserID == userID {
+			list = append(list, sess)
+		}
+	}
+	return list, nil
+}
+
+func (m *MockDatabaseService) DeleteUserSession(ctx context.Context, userID, publicID string) error {
+	for i, sess := range m.Sessions {
+		if sess.UserID == userID && sess.PublicID == publicID {
+			m.Sessions = append(m.Sessions[:i], m.Sessions[i+1:]...)
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (m *MockDatabaseService) DeleteUserSessionsExcept(ctx context.Context, userID, keepID string) (int64, error) {
+	var kept []database.Session
+	var n int64
+	for _, sess := range m.Sessions {
+		if sess.UserID == userID && sess.ID != keepID {
+			n++
+			continue
+		}
+		kept = append(kept, sess)
+	}
+	m.Sessions = kept
+	return n, nil
+}
+
+func (m *MockDatabaseService) CreateRefreshToken(ctx context.Context, userID string, tokenHash []byte, expiresAt time.Time) (*database.RefreshToken, error) {
+	if m.RefreshTokens == nil {
+		m.RefreshTokens = map[string]*mockRefreshToken{}
+	}
+	t := &mockRefreshToken{RefreshToken: database.RefreshToken{
+		ID: string(tokenHash), UserID: userID, FamilyID: string(tokenHash), ExpiresAt: expiresAt,
+	}}
+	m.RefreshTokens[string(tokenHash)] = t
+	return &t.RefreshToken, nil
+}
+
+func (m *MockDatabaseService) RotateRefreshToken(ctx context.Context, oldHash, newHash []byte, expiresAt time.Time) (*database.RefreshToken, error) {
+	old, ok := m.RefreshTokens[string(oldHash)]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	if old.Used {
+		for hash, t := range m.RefreshTokens {
+			if t.FamilyID == old.FamilyID {
+				delete(m.RefreshTokens, hash)
+			}
+		}
+		return &old.RefreshToken, database.ErrTokenReused
+	}
+	old.Used = true
+
+	next := &mockRefreshToken{RefreshToken: database.RefreshToken{
+		ID: string(newHash), UserID: old.UserID, FamilyID: old.FamilyID, ExpiresAt: expiresAt,
+	}}
+	m.RefreshTokens[string(newHash)] = next
+	return &next.RefreshToken, nil
+}
+
+func (m *MockDatabaseService) GetTOTP(ctx context.Context, userID string) (*database.TOTP, error) {
+	t, ok := m.TOTP[userID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	totp := t.TOTP
+	return &totp, nil
+}
+
+func (m *MockDatabaseService) SaveTOTPSecret(ctx context.Context, userID, secret string) error {
+	if t, ok := m.TOTP[userID]; ok && t.Enabled {
+		return database.ErrNotFound
+	}
+	if m.TOTP == nil {
+		m.TOTP = map[string]*mockTOTP{}
+	}
+	m.TOTP[userID] = &mockTOTP{TOTP: database.TOTP{UserID: userID, Secret: secret}}
+	return nil
+}
 
-		server := NewServer()
+func (m *MockDatabaseService) EnableTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes [][]byte) error {
+	t, ok := m.TOTP[userID]
+	if !ok || t.Enabled {
+		return database.ErrNotFound
+	}
+	t.Enabled = true
+	t.LastStep = step
+	t.RecoveryCodes = map[string]bool{}
+	for _, hash := range recoveryCodeHashes {
+		t.RecoveryCodes[string(hash)] = false
+	}
+	m.Users[userID].MFAEnabled = true
+	return nil
+}
+
+func (m *MockDatabaseService) DisableTOTP(ctx context.Context, userID string) error {
+	delete(m.TOTP, userID)
+	m.Users[userID].MFAEnabled = false
+	return nil
+}
+
+func (m *MockDatabaseService) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	t, ok := m.TOTP[userID]
+	if !ok || step <= t.LastStep {
+		return database.ErrCodeUsed
+	}
+	t.LastStep = step
+	return nil
+}
+
+func (m *MockDatabaseService) UseRecoveryCode(ctx context.Context, userID string, codeHash []byte) error {
+	t, ok := m.TOTP[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	used, ok := t.RecoveryCodes[string(codeHash)]
+	if !ok || used {
+		return database.ErrNotFound
+	}
+	t.RecoveryCodes[string(codeHash)] = true
+	return nil
+}
+
+func (m *MockDatabaseService) ListWebAuthnCredentials(ctx context.Context, userID string) ([]database.WebAuthnCredential, error) {
+	var list []database.WebAuthnCredential
+	for _, c := range m.Passkeys {
+		if c.UserID == userID {
+			list = append(list, c)
+		}
+	}
+	return list, nil
+}
+
+func (m *MockDatabaseService) CreateWebAuthnCredential(ctx context.Context, cred *database.WebAuthnCredential) error {
+	cred.ID = fmt.Sprintf("cred-%d", len(m.Passkeys)+1)
+	cred.CreatedAt = time.Now()
+	m.Passkeys = append(m.Passkeys, *cred)
+	return nil
+}
+
+func (m *MockDatabaseService) UpdateWebAuthnCredential(ctx context.Context, credentialID, data []byte) error {
+	for i, c := range m.Passkeys {
+		if string(c.CredentialID) == string(credentialID) {
+			m.Passkeys[i].Data = data
+			m.Passkeys[i].LastUsedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (m *MockDatabaseService) DeleteWebAuthnCredential(ctx context.Context, userID, id string) error {
+	for i, c := range m.Passkeys {
+		if c.UserID == userID && c.ID == id {
+			identities, _ := m.ListUserIdentities(ctx, userID)
+			passkeys, _ := m.ListWebAuthnCredentials(ctx, userID)
+			if len(identities) == 0 && len(passkeys) == 1 && m.Passwords[userID] == "" {
+				return database.ErrLastLoginMethod
+			}
+			m.Passkeys = append(m.Passkeys[:i], m.Passkeys[i+1:]...)
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (m *MockDatabaseService) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	for hash, t := range m.RefreshTokens {
+		if t.UserID == userID {
+			delete(m.RefreshTokens, hash)
+		}
+	}
+	return nil
+}
+
+func (m *MockDatabaseService) ListRoles(ctx context.Context) ([]database.Role, error) {
+	return m.Roles, nil
+}
+
+func (m *MockDatabaseService) CreateRole(ctx context.Context, role *database.Role) error {
+	for _, r := range m.Roles {
+		if r.Name == role.Name {
+			return database.ErrRoleExists
+		}
+	}
+	role.CreatedAt = time.Now()
+	m.Roles = append(m.Roles, *role)
+	return nil
+}
+
+func (m *MockDatabaseService) DeleteRole(ctx context.Context, name string) error {
+	if name == database.AdminRole {
+		return database.ErrProtectedRole
+	}
+	for i, r := range m.Roles {
+		if r.Name == name {
+			m.Roles = append(m.Roles[:i], m.Roles[i+1:]...)
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (m *MockDatabaseService) AssignRole(ctx context.Context, userID, role string) error {
+	if _, ok := m.Users[userID]; !ok {
+		return database.ErrNotFound
+	}
+	for _, r := range m.Roles {
+		if r.Name == role {
+			if m.UserRoles == nil {
+				m.UserRoles = map[string][]string{}
+			}
+			m.UserRoles[userID] = append(m.UserRoles[userID], role)
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (m *MockDatabaseService) ListUserRoles(ctx context.Context, userID string) ([]string, error) {
+	return append([]string{}, m.UserRoles[userID]...), nil
+}
+
+func (m *MockDatabaseService) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	perms := []string{}
+	for _, name := range m.UserRoles[userID] {
+		for _, r := range m.Roles {
+			if r.Name == name {
+				perms = append(perms, r.Permissions...)
+			}
+		}
+	}
+	return perms, nil
+}
+
+func (m *MockDatabaseService) CreateOrganization(ctx context.Context, org *database.Organization, ownerID string) error {
+	for _, o := range m.Organizations {
+		if o.Slug == org.Slug {
+			return database.ErrSlugTaken
+		}
+	}
+	org.ID = fmt.Sprintf("org-%d", len(m.Organizations)+1)
+	org.CreatedAt = time.Now()
+	m.Organizations = append(m.Organizations, *org)
+	m.Memberships = append(m.Memberships, database.Membership{Organization: *org, UserID: ownerID, Role: database.OrgRoleOwner})
+	return nil
+}
+
+func (m *MockDatabaseService) ListUserOrganizations(ctx context.Context, userID string) ([]database.Membership, error) {
+	var list []database.Membership
+	for _, ms := range m.Memberships {
+		if ms.UserID == userID {
+			list = append(list, ms)
+		}
+	}
+	return list, nil
+}
+
+func (m *MockDatabaseService) GetMembership(ctx context.Context, orgID, userID string) (*database.Membership, error) {
+	for _, ms := range m.Memberships {
+		if ms.Organization.ID == orgID && ms.UserID == userID {
+			return &ms, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func (m *MockDatabaseService) ListOrganizationMembers(ctx context.Context, orgID string) ([]database.Member, error) {
+	var list []database.Member
+	for _, ms := range m.Memberships {
+		if ms.Organization.ID == orgID {
+			list = append(list, database.Member{User: *m.Users[ms.UserID], Role: ms.Role})
+		}
+	}
+	return list, nil
+}
+
+func (m *MockDatabaseService) SetMemberRole(ctx context.Context, orgID, userID, role string) error {
+	for i, ms := range m.Memberships {
+		if ms.Organization.ID == orgID && ms.UserID == userID {
+			m.Memberships[i].Role = role
+			if !m.hasOwner(orgID) {
+				m.Memberships[i].Role = ms.Role
+				return database.ErrLastOwner
+			}
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (m *MockDatabaseService) RemoveMember(ctx context.Context, orgID, userID string) error {
+	for i, ms := range m.Memberships {
+		if ms.Organization.ID == orgID && ms.UserID == userID {
+			rest := append(append([]database.Membership{}, m.Memberships[:i]...), m.Memberships[i+1:]...)
+			previous := m.Memberships
+			m.Memberships = rest
+			if !m.hasOwner(orgID) {
+				m.Memberships = previous
+				return database.ErrLastOwner
+			}
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (m *MockDatabaseService) hasOwner(orgID string) bool {
+	for _, ms := range m.Memberships {
+		if ms.Organization.ID == orgID && ms.Role == database.OrgRoleOwner {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MockDatabaseService) CreateInvitation(ctx context.Context, inv *database.Invitation, tokenHash []byte) error {
+	if m.Invitations == nil {
+		m.Invitations = map[string]*mockInvitation{}
+	}
+	inv.ID = fmt.Sprintf("invitation-%d", len(m.Invitations)+1)
+	inv.CreatedAt = time.Now()
+	m.Invitations[string(tokenHash)] = &mockInvitation{Invitation: *inv}
+	return nil
+}
+
+func (m *MockDatabaseService) AcceptInvitation(ctx context.Context, tokenHash []byte, userID string) (*database.Membership, error) {
+	inv, ok := m.Invitations[string(tokenHash)]
+	if !ok || inv.Accepted || time.Now().After(inv.ExpiresAt) {
+		return nil, database.ErrNotFound
+	}
+	if u, ok := m.Users[userID]; !ok || !u.EmailVerified || !strings.EqualFold(u.Email, inv.Email) {
+		return nil, database.ErrInvitationEmail
+	}
+	inv.Accepted = true
+
+	if existing, err := m.GetMembership(ctx, inv.OrganizationID, userID); err == nil {
+		return existing, nil
+	}
+	for _, o := range m.Organizations {
+		if o.ID == inv.OrganizationID {
+			ms := database.Membership{Organization: o, UserID: userID, Role: inv.Role}
+			m.Memberships = append(m.Memberships, ms)
+			return &ms, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func (m *MockDatabaseService) SearchUsers(ctx context.Context, search database.UserSearch) ([]database.User, int, error) {
+	var matched []database.User
+	for _, u := range m.Users {
+		if strings.Contains(u.Email, search.Query) || strings.Contains(u.Name, search.Query) {
+			matched = append(matched, *u)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+
+	start := min(search.Offset, len(matched))
+	end := min(start+search.Limit, len(matched))
+	return matched[start:end], len(matched), nil
+}
+
+func (m *MockDatabaseService) SetUserDisabled(ctx context.Context, userID string, disabled bool) error {
+	user, ok := m.Users[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	user.Disabled = disabled
+	return nil
+}
+
+func (m *MockDatabaseService) ResetUserMFA(ctx context.Context, userID string) (bool, error) {
+	user, ok := m.Users[userID]
+	if !ok {
+		return false, database.ErrNotFound
+	}
+	delete(m.TOTP, userID)
+	_, hasPassword := m.Passwords[userID]
+	passkeysKept := !hasPassword
+	for _, i := range m.Identities {
+		if i.UserID == userID {
+			passkeysKept = false
+		}
+	}
+	if !passkeysKept {
+		var kept []database.WebAuthnCredential
+		for _, c := range m.Passkeys {
+			if c.UserID != userID {
+				kept = append(kept, c)
+			}
+		}
+		m.Passkeys = kept
+		user.MFAEnabled = false
+	}
+	return passkeysKept, nil
+}
+
+func (m *MockDatabaseService) RecordAuthEvent(ctx context.Context, event *database.AuthEvent) error {
+	event.ID = fmt.Sprintf("event-%d", len(m.AuthEvents)+1)
+	event.CreatedAt = time.Now()
+	m.AuthEvents = append(m.AuthEvents, *event)
+	return nil
+}
+
+func (m *MockDatabaseService) ListAuthEvents(ctx context.Context, query database.AuthEventQuery) ([]database.AuthEvent, error) {
+	var list []database.AuthEvent
+	for i := len(m.AuthEvents) - 1; i >= 0; i-- {
+		e := m.AuthEvents[i]
+		if (query.UserID == "" || e.UserID == query.UserID) &&
+			(query.ActorID == "" || e.ActorID == query.ActorID) &&
+			(query.Type == "" || e.Type == query.Type) &&
+			!e.CreatedAt.Before(query.Since) {
+			list = append(list, e)
+		}
+	}
+	start := min(query.Offset, len(list))
+	return list[start:min(start+query.Limit, len(list))], nil
+}
+
+func (m *MockDatabaseService) GetLoginThrottles(ctx context.Context, keys []string) ([]database.LoginThrottle, error) {
+	var throttles []database.LoginThrottle
+	for _, key := range keys {
+		if t, ok := m.Throttles[key]; ok {
+			throttles = append(throttles, *t)
+		}
+	}
+	return throttles, nil
+}
+
+func (m *MockDatabaseService) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (*database.LoginThrottle, error) {
+	if m.Throttles == nil {
+		m.Throttles = map[string]*database.LoginThrottle{}
+	}
+	t, ok := m.Throttles[key]
+	if !ok || time.Since(t.LastFailureAt) > window {
+		t = &database.LoginThrottle{Key: key}
+		m.Throttles[key] = t
+	}
+	t.Failures++
+	t.LastFailureAt = time.Now()
+	copied := *t
+	return &copied, nil
+}
+
+func (m *MockDatabaseService) LockLogin(ctx context.Context, key string, until time.Time) error {
+	t, ok := m.Throttles[key]
+	if !ok {
+		return database.ErrNotFound
+	}
+	t.LockedUntil = until
+	return nil
+}
+
+func (m *MockDatabaseService) ClearLoginFailures(ctx context.Context, key string) error {
+	delete(m.Throttles, key)
+	return nil
+}
+
+// eventTypes returns the types of the recorded auth events, oldest first.
+func (m *MockDatabaseService) eventTypes() []string {
+	types := []string{}
+	for _, e := range m.AuthEvents {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+// newTestConfig returns the smallest configuration NewServer accepts.
+func newTestConfig(port int) *config.Config {
+	return &config.Config{Port: port, BackendURI: "http://localhost:8080"}
+}
+
+func TestNewServer(t *testing.T) {
+	t.Run("should create server with correct configuration", func(t *testing.T) {
+		server := NewServer(newTestConfig(3000), &MockDatabaseService{})
 
 		require.NotNil(t, server)
-		assert.Equal(t, ":0", server.Addr)
+		assert.Equal(t, ":3000", server.Addr)
+		assert.NotNil(t, server.Handler)
+		assert.Equal(t, time.Minute, server.IdleTimeout)
+		assert.Equal(t, 10*time.Second, server.ReadTimeout)
+		assert.Equal(t, 30*time.Second, server.WriteTimeout)
 	})
 
 	t.Run("should use different port values", func(t *testing.T) {
 		testCases := []struct {
 			name     string
-			port     string
+			port     int
 			expected string
 		}{
-			{"port 8080", "8080", ":8080"},
-			{"port 5000", "5000", ":5000"},
-			{"port 80", "80", ":80"},
-			{"port 443", "443", ":443"},
+			{"port 8080", 8080, ":8080"},
+			{"port 5000", 5000, ":5000"},
+			{"port 80", 80, ":80"},
+			{"port 443", 443, ":443"},
 		}
 
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
-				os.Setenv("PORT", tc.port)
-				defer os.Unsetenv("PORT")
-
-				server := NewServer()
+				server := NewServer(newTestConfig(tc.port), &MockDatabaseService{})
 
 				assert.Equal(t, tc.expected, server.Addr)
 			})
@@ -84,22 +735,21 @@ func TestNewServer(t *testing.T) {
 }
 
 func TestServerStruct(t *testing.T) {
-	t.Run("should create Server with port and database", func(t *testing.T) {
+	t.Run("should create Server with config and database", func(t *testing.T) {
 		mockDB := &MockDatabaseService{}
 		server := &Server{
-			port: 3000,
-			db:   mockDB,
+			config: *newTestConfig(3000),
+			db:     mockDB,
 		}
 
-		assert.Equal(t, 3000, server.port)
+		assert.Equal(t, 3000, server.config.Port)
 		assert.NotNil(t, server.db)
 	})
 
 	t.Run("database health should be accessible through Server", func(t *testing.T) {
 		mockDB := &MockDatabaseService{}
 		server := &Server{
-			// port: 3000,
-			db:   mockDB,
+			db: mockDB,
 		}
 
 		health := server.db.Health()
@@ -111,10 +761,7 @@ func TestServerStruct(t *testing.T) {
 
 func TestServerTimeouts(t *testing.T) {
 	t.Run("should have correct timeout configurations", func(t *testing.T) {
-		os.Setenv("PORT", "3000")
-		defer os.Unsetenv("PORT")
-
-		server := NewServer()
+		server := NewServer(newTestConfig(3000), &MockDatabaseService{})
 
 		assert.Equal(t, time.Minute, server.IdleTimeout, "IdleTimeout should be 1 minute")
 		assert.Equal(t, 10*time.Second, server.ReadTimeout, "ReadTimeout should be 10 seconds")
@@ -124,10 +771,7 @@ func TestServerTimeouts(t *testing.T) {
 
 func TestServerHandler(t *testing.T) {
 	t.Run("should have a valid handler", func(t *testing.T) {
-		os.Setenv("PORT", "3000")
-		defer os.Unsetenv("PORT")
-
-		server := NewServer()
+		server := NewServer(newTestConfig(3000), &MockDatabaseService{})
 
 		require.NotNil(t, server.Handler)
 		assert.Implements(t, (*http.Handler)(nil), server.Handler)
@@ -136,10 +780,7 @@ func TestServerHandler(t *testing.T) {
 
 func TestServerIntegration(t *testing.T) {
 	t.Run("should create a fully functional HTTP server", func(t *testing.T) {
-		os.Setenv("PORT", "8888")
-		defer os.Unsetenv("PORT")
-
-		server := NewServer()
+		server := NewServer(newTestConfig(8888), &MockDatabaseService{})
 
 		assert.NotNil(t, server)
 		assert.Equal(t, ":8888", server.Addr)
@@ -153,26 +794,24 @@ func TestServerIntegration(t *testing.T) {
 
 // Benchmark tests
 func BenchmarkNewServer(b *testing.B) {
-	os.Setenv("PORT", "3000")
-	defer os.Unsetenv("PORT")
+	cfg := newTestConfig(3000)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = NewServer()
+		_ = NewServer(cfg, &MockDatabaseService{})
 	}
 }
 
 func BenchmarkServerCreationWithDifferentPorts(b *testing.B) {
-	ports := []string{"3000", "8080", "5000", "9000"}
+	ports := []int{3000, 8080, 5000, 9000}
 
 	for _, port := range ports {
-		b.Run("port_"+port, func(b *testing.B) {
-			os.Setenv("PORT", port)
-			defer os.Unsetenv("PORT")
+		b.Run(fmt.Sprintf("port_%d", port), func(b *testing.B) {
+			cfg := newTestConfig(port)
 
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				_ = NewServer()
+				_ = NewServer(cfg, &MockDatabaseService{})
 			}
 		})
 	}
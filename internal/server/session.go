@@ -0,0 +1,236 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/gothic"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// mfaChallengeTTL is how long a user has to enter their second factor
+// after passing the first.
+const mfaChallengeTTL = 5 * time.Minute
+
+// startSession records userID as the signed-in user in the auth session.
+func startSession(w http.ResponseWriter, r *http.Request, userID, provider string) error {
+	return replaceSession(w, r, map[interface{}]interface{}{
+		auth.SessionUserIDKey:   userID,
+		auth.SessionProviderKey: provider,
+	})
+}
+
+// startMFAChallenge records that userID has passed the first factor. The
+// session does not sign the user in until completeMFAChallenge.
+func startMFAChallenge(w http.ResponseWriter, r *http.Request, userID, provider string) error {
+	return replaceSession(w, r, map[interface{}]interface{}{
+		auth.SessionMFAUserIDKey:  userID,
+		auth.SessionProviderKey:   provider,
+		auth.SessionMFAStartedKey: time.Now().Unix(),
+	})
+}
+
+// pendingMFAUser returns the user and provider of an unexpired MFA
+// challenge in the auth session.
+func pendingMFAUser(r *http.Request) (userID, provider string, ok bool) {
+	session, err := gothic.Store.Get(r, auth.SessionName)
+	if err != nil {
+		return "", "", false
+	}
+
+	userID, _ = session.Values[auth.SessionMFAUserIDKey].(string)
+	provider, _ = session.Values[auth.SessionProviderKey].(string)
+	started, _ := session.Values[auth.SessionMFAStartedKey].(int64)
+	if userID == "" || time.Since(time.Unix(started, 0)) > mfaChallengeTTL {
+		return "", "", false
+	}
+	return userID, provider, true
+}
+
+// replaceSession saves values as the entire auth session. Any previous
+// server-side session is discarded so that a session ID issued before a
+// change in authentication state is never reused afterwards. Only a
+// pending invitation is carried over, for the user to confirm once signed
+// in.
+func replaceSession(w http.ResponseWriter, r *http.Request, values map[interface{}]interface{}) error {
+	session, _ := gothic.Store.Get(r, auth.SessionName)
+	if token, ok := session.Values[auth.SessionInvitationKey].(string); ok && token != "" {
+		values[auth.SessionInvitationKey] = token
+	}
+	if store, ok := gothic.Store.(*auth.PGStore); ok && session.ID != "" {
+		if err := store.Delete(r.Context(), session.ID); err != nil {
+			return err
+		}
+		session.ID = ""
+	}
+
+	session.Values = values
+	return session.Save(r, w)
+}
+
+// errAccountDisabled is returned when a disabled user tries to sign in.
+var errAccountDisabled = errors.New("account disabled")
+
+// beginLogin signs user in after a successful first factor, or starts an
+// MFA challenge when the user has a second factor enrolled. It reports
+// whether a challenge was started, and returns errAccountDisabled without
+// touching the session if an administrator has disabled the user.
+func (s *Server) beginLogin(w http.ResponseWriter, r *http.Request, user *database.User, provider string) (bool, error) {
+	if user.Disabled {
+		s.recordLoginFailure(r, user.ID, provider, "account_disabled", nil)
+		return false, errAccountDisabled
+	}
+	if user.MFAEnabled {
+		return true, startMFAChallenge(w, r, user.ID, provider)
+	}
+	return false, s.completeLogin(w, r, user.ID, provider, nil)
+}
+
+// completeLogin signs userID in and records the login in the security log.
+func (s *Server) completeLogin(w http.ResponseWriter, r *http.Request, userID, provider string, details map[string]interface{}) error {
+	if err := startSession(w, r, userID, provider); err != nil {
+		return err
+	}
+	s.recordEvent(r, database.AuthEvent{
+		Type:     database.EventLoginSucceeded,
+		UserID:   userID,
+		Provider: provider,
+		Details:  details,
+	})
+	return nil
+}
+
+// endSession deletes the auth session and expires its cookie.
+func endSession(w http.ResponseWriter, r *http.Request) error {
+	session, _ := gothic.Store.Get(r, auth.SessionName)
+	session.Options.MaxAge = -1
+	session.Values = map[interface{}]interface{}{}
+	return session.Save(r, w)
+}
+
+// profileFromGothUser splits a provider user into the profile used to
+// create our user record and the identity that links it to the provider.
+func profileFromGothUser(user goth.User) (database.User, database.Identity) {
+	name := user.Name
+	if name == "" {
+		name = user.NickName
+	}
+
+	profile := database.User{
+		Email:     user.Email,
+		Name:      name,
+		AvatarURL: user.AvatarURL,
+	}
+	identity := database.Identity{
+		Provider:       user.Provider,
+		ProviderUserID: user.UserID,
+		Email:          user.Email,
+		EmailVerified:  emailVerified(user.RawData),
+		AccessToken:    user.AccessToken,
+		RefreshToken:   user.RefreshToken,
+		ExpiresAt:      user.ExpiresAt,
+		RawData:        user.RawData,
+	}
+	return profile, identity
+}
+
+// emailVerified reports whether a provider's raw profile asserts that the
+// email address is verified. Providers use different claim names, and
+// those that say nothing are treated as unverified.
+func emailVerified(raw map[string]interface{}) bool {
+	for _, key := range []string{"email_verified", "verified_email", "verified"} {
+		switch v := raw[key].(type) {
+		case bool:
+			return v
+		case string:
+			return v == "true"
+		}
+	}
+	return false
+}
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	Provider   string    `json:"provider,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func (s *Server) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	s.writeSessions(w, r, user.ID, sessionIDFromContext(r.Context()))
+}
+
+// writeSessions responds with userID's active sessions, marking the one
+// with server-side ID currentID as current.
+func (s *Server) writeSessions(w http.ResponseWriter, r *http.Request, userID, currentID string) {
+	list, err := s.db.ListUserSessions(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list sessions", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	resp := make([]sessionResponse, 0, len(list))
+	for _, sess := range list {
+		resp = append(resp, sessionResponse{
+			ID:         sess.PublicID,
+			Provider:   sess.Provider,
+			IP:         sess.IP,
+			UserAgent:  sess.UserAgent,
+			CreatedAt:  sess.CreatedAt,
+			LastSeenAt: sess.LastSeenAt,
+			ExpiresAt:  sess.ExpiresAt,
+			Current:    currentID != "" && sess.ID == currentID,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": resp})
+}
+
+func (s *Server) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	err := s.db.DeleteUserSession(r.Context(), user.ID, chi.URLParam(r, "id"))
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to revoke session", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	s.recordEvent(r, database.AuthEvent{
+		Type:    database.EventSessionRevoked,
+		UserID:  user.ID,
+		Details: map[string]interface{}{"session_id": chi.URLParam(r, "id")},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) revokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	revoked, err := s.db.DeleteUserSessionsExcept(r.Context(), user.ID, sessionIDFromContext(r.Context()))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to revoke sessions", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	s.recordEvent(r, database.AuthEvent{
+		Type:    database.EventSessionRevoked,
+		UserID:  user.ID,
+		Details: map[string]interface{}{"revoked": revoked},
+	})
+	writeJSON(w, http.StatusOK, map[string]int64{"revoked": revoked})
+}
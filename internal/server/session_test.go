@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/markbates/goth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+func TestProfileFromGothUser(t *testing.T) {
+	t.Run("should map provider user to profile and identity", func(t *testing.T) {
+		expires := time.Now().Add(time.Hour)
+		user := goth.User{
+			Provider:     "google",
+			UserID:       "123",
+			Email:        "jane@example.com",
+			Name:         "Jane",
+			AvatarURL:    "https://example.com/jane.png",
+			AccessToken:  "access",
+			RefreshToken: "refresh",
+			ExpiresAt:    expires,
+			RawData:      map[string]interface{}{"sub": "123"},
+		}
+
+		profile, identity := profileFromGothUser(user)
+
+		assert.Equal(t, "jane@example.com", profile.Email)
+		assert.Equal(t, "Jane", profile.Name)
+		assert.Equal(t, "https://example.com/jane.png", profile.AvatarURL)
+
+		assert.Equal(t, "google", identity.Provider)
+		assert.Equal(t, "123", identity.ProviderUserID)
+		assert.Equal(t, "access", identity.AccessToken)
+		assert.Equal(t, "refresh", identity.RefreshToken)
+		assert.Equal(t, expires, identity.ExpiresAt)
+		assert.Equal(t, "123", identity.RawData["sub"])
+	})
+
+	t.Run("should fall back to nickname when name is empty", func(t *testing.T) {
+		profile, _ := profileFromGothUser(goth.User{NickName: "jdoe"})
+
+		assert.Equal(t, "jdoe", profile.Name)
+	})
+
+	t.Run("should read the provider's email verification claim", func(t *testing.T) {
+		cases := []struct {
+			raw  map[string]interface{}
+			want bool
+		}{
+			{map[string]interface{}{"email_verified": true}, true},
+			{map[string]interface{}{"verified_email": true}, true},
+			{map[string]interface{}{"verified": "true"}, true},
+			{map[string]interface{}{"email_verified": false}, false},
+			{map[string]interface{}{}, false},
+		}
+
+		for _, tc := range cases {
+			_, identity := profileFromGothUser(goth.User{RawData: tc.raw})
+			assert.Equal(t, tc.want, identity.EmailVerified, tc.raw)
+		}
+	})
+}
+
+func TestSessionHandlers(t *testing.T) {
+	user := &database.User{ID: "user-1"}
+
+	newDB := func() *MockDatabaseService {
+		return &MockDatabaseService{
+			Users: map[string]*database.User{user.ID: user},
+			Sessions: []database.Session{
+				{ID: "s1", PublicID: "p1", UserID: user.ID, Provider: "google", IP: "203.0.113.7"},
+				{ID: "s2", PublicID: "p2", UserID: user.ID, Provider: "github"},
+				{ID: "s3", PublicID: "p3", UserID: "someone-else"},
+			},
+		}
+	}
+
+	serve := func(t *testing.T, db *MockDatabaseService, method, target string) *httptest.ResponseRecorder {
+		t.Helper()
+		useTestStore(t)
+
+		req := httptest.NewRequest(method, target, nil)
+		for _, c := range sessionCookies(t, user.ID) {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		(&Server{db: db}).RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("should list only the user's sessions by public ID", func(t *testing.T) {
+		w := serve(t, newDB(), http.MethodGet, "/me/sessions")
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Sessions []sessionResponse `json:"sessions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.Len(t, body.Sessions, 2)
+		assert.Equal(t, "p1", body.Sessions[0].ID)
+		assert.Equal(t, "google", body.Sessions[0].Provider)
+		assert.Equal(t, "203.0.113.7", body.Sessions[0].IP)
+		assert.NotContains(t, w.Body.String(), `"s1"`)
+	})
+
+	t.Run("should revoke one of the user's sessions", func(t *testing.T) {
+		db := newDB()
+		w := serve(t, db, http.MethodDelete, "/me/sessions/p2")
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Len(t, db.Sessions, 2)
+	})
+
+	t.Run("should not revoke another user's session", func(t *testing.T) {
+		db := newDB()
+		w := serve(t, db, http.MethodDelete, "/me/sessions/p3")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Len(t, db.Sessions, 3)
+	})
+
+	t.Run("should revoke all other sessions", func(t *testing.T) {
+		db := newDB()
+		w := serve(t, db, http.MethodDelete, "/me/sessions")
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"revoked": 2}`, w.Body.String())
+		require.Len(t, db.Sessions, 1)
+		assert.Equal(t, "someone-else", db.Sessions[0].UserID)
+	})
+
+	t.Run("should require a session", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/me/sessions", nil)
+		w := httptest.NewRecorder()
+		(&Server{db: newDB()}).RegisterRoutes().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
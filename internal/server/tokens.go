@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// issueTokenHandler exchanges the current session for a JWT access token
+// that API clients can send as "Authorization: Bearer <token>", plus a
+// refresh token that starts a new token family.
+func (s *Server) issueTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	refreshToken, refreshHash := auth.GenerateToken()
+	_, err := s.db.CreateRefreshToken(r.Context(), user.ID, refreshHash, time.Now().Add(s.tokens.RefreshTTL()))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to store refresh token", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	s.recordEvent(r, database.AuthEvent{Type: database.EventTokenIssued, UserID: user.ID})
+
+	s.writeTokens(w, r, user.ID, refreshToken)
+}
+
+// refreshTokenHandler rotates a refresh token: the presented token is
+// spent and a new access and refresh token pair is returned. Presenting a
+// spent token again revokes every token in its family.
+func (s *Server) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := decodeJSON(w, r, &req); err != nil || req.RefreshToken == "" {
+		writeError(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	newToken, newHash := auth.GenerateToken()
+	rotated, err := s.db.RotateRefreshToken(r.Context(),
+		auth.HashToken(req.RefreshToken), newHash, time.Now().Add(s.tokens.RefreshTTL()))
+	if errors.Is(err, database.ErrTokenReused) {
+		slog.WarnContext(r.Context(), "Refresh token reuse detected; token family revoked")
+		s.recordEvent(r, database.AuthEvent{
+			Type:    database.EventTokenReused,
+			UserID:  rotated.UserID,
+			Details: map[string]interface{}{"family_id": rotated.FamilyID},
+		})
+		writeError(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to rotate refresh token", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	s.recordEvent(r, database.AuthEvent{Type: database.EventTokenRefreshed, UserID: rotated.UserID})
+	s.writeTokens(w, r, rotated.UserID, newToken)
+}
+
+// writeTokens responds with a new access token for userID alongside the
+// given refresh token.
+func (s *Server) writeTokens(w http.ResponseWriter, r *http.Request, userID, refreshToken string) {
+	accessToken, _, err := s.tokens.Issue(userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to issue access token", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.tokens.TTL().Seconds()),
+		RefreshToken: refreshToken,
+	})
+}
+
+func (s *Server) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, s.tokens.JWKS())
+}
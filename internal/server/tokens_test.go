@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+func newTestTokenIssuer(t *testing.T) *auth.TokenIssuer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	issuer, err := auth.NewTokenIssuer(auth.TokenConfig{
+		Issuer: "http://localhost:3000", TTL: time.Minute, Algorithm: "EdDSA",
+	}, key)
+	require.NoError(t, err)
+	return issuer
+}
+
+func TestTokenHandlers(t *testing.T) {
+	user := &database.User{ID: "user-1", Email: "jane@example.com"}
+
+	newServer := func(t *testing.T) *Server {
+		useTestStore(t)
+		return &Server{
+			db:     &MockDatabaseService{Users: map[string]*database.User{user.ID: user}},
+			tokens: newTestTokenIssuer(t),
+		}
+	}
+
+	t.Run("should exchange a session for an access token", func(t *testing.T) {
+		s := newServer(t)
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/token", nil)
+		for _, c := range sessionCookies(t, user.ID) {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+		var resp tokenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "Bearer", resp.TokenType)
+		assert.Equal(t, int64(60), resp.ExpiresIn)
+
+		claims, err := s.tokens.Verify(resp.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, claims.Subject)
+		assert.NotEmpty(t, resp.RefreshToken)
+	})
+
+	refresh := func(s *Server, token string) *httptest.ResponseRecorder {
+		body := strings.NewReader(`{"refresh_token": "` + token + `"}`)
+		req := httptest.NewRequest(http.MethodPost, "/auth/token/refresh", body)
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("should rotate a refresh token", func(t *testing.T) {
+		s := newServer(t)
+		token, hash := auth.GenerateToken()
+		_, err := s.db.CreateRefreshToken(context.Background(), user.ID, hash, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		w := refresh(s, token)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp tokenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.NotEmpty(t, resp.AccessToken)
+		assert.NotEqual(t, token, resp.RefreshToken)
+
+		claims, err := s.tokens.Verify(resp.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, claims.Subject)
+
+		assert.Equal(t, http.StatusOK, refresh(s, resp.RefreshToken).Code)
+	})
+
+	t.Run("should revoke the family when a refresh token is reused", func(t *testing.T) {
+		s := newServer(t)
+		token, hash := auth.GenerateToken()
+		_, err := s.db.CreateRefreshToken(context.Background(), user.ID, hash, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		w := refresh(s, token)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp tokenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+		assert.Equal(t, http.StatusUnauthorized, refresh(s, token).Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(s, resp.RefreshToken).Code)
+	})
+
+	t.Run("should reject an unknown refresh token", func(t *testing.T) {
+		s := newServer(t)
+
+		assert.Equal(t, http.StatusUnauthorized, refresh(s, "unknown").Code)
+	})
+
+	t.Run("should require a refresh token in the body", func(t *testing.T) {
+		s := newServer(t)
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/token/refresh", strings.NewReader(`{}`))
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("should not issue tokens without a session", func(t *testing.T) {
+		s := newServer(t)
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/token", nil)
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("should authenticate /me with a bearer token", func(t *testing.T) {
+		s := newServer(t)
+		token, _, err := s.tokens.Issue(user.ID)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), user.Email)
+	})
+
+	t.Run("should reject an invalid bearer token even with a session", func(t *testing.T) {
+		s := newServer(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer not-a-token")
+		for _, c := range sessionCookies(t, user.ID) {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("should publish the public key", func(t *testing.T) {
+		s := newServer(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var jwks auth.JWKSet
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+		require.Len(t, jwks.Keys, 1)
+		assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+	})
+
+	t.Run("should not expose token routes when JWT is disabled", func(t *testing.T) {
+		s := &Server{db: &MockDatabaseService{}}
+
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/mail"
+)
+
+// verificationTokenTTL is how long an email verification link stays valid.
+const verificationTokenTTL = 24 * time.Hour
+
+// sendVerificationEmail emails user a single-use link to GET /auth/verify.
+// It does nothing when no mailer is configured.
+func (s *Server) sendVerificationEmail(ctx context.Context, user *database.User) error {
+	if s.mailer == nil || user.Email == "" {
+		return nil
+	}
+
+	token, hash := auth.GenerateToken()
+	err := s.db.CreateOneTimeToken(ctx, user.ID, database.TokenPurposeVerifyEmail, hash, time.Now().Add(verificationTokenTTL))
+	if err != nil {
+		return err
+	}
+
+	link := tokenLink(s.config.BackendURI+"/auth/verify", token)
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you did not create an account, you can ignore this email.\n",
+			link, verificationTokenTTL),
+	})
+}
+
+// tokenLink returns baseURL with token as its query string.
+func tokenLink(baseURL, token string) string {
+	return baseURL + "?token=" + url.QueryEscape(token)
+}
+
+// verifyEmailHandler redeems a verification link and flags the user's
+// email address as verified.
+func (s *Server) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	userID, err := s.db.ConsumeOneTimeToken(r.Context(), database.TokenPurposeVerifyEmail, auth.HashToken(token))
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusBadRequest, "invalid or expired verification link")
+		return
+	}
+	if err == nil {
+		err = s.db.MarkEmailVerified(r.Context(), userID)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to verify email", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"email_verified": true})
+}
+
+// resendVerificationHandler sends a new verification link to the signed-in
+// user.
+func (s *Server) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	if user.EmailVerified {
+		writeError(w, http.StatusConflict, "email address is already verified")
+		return
+	}
+	if user.Email == "" {
+		writeError(w, http.StatusBadRequest, "account has no email address")
+		return
+	}
+
+	if err := s.sendVerificationEmail(r.Context(), user); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to send verification email", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
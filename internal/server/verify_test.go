@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+	"github.com/GRACENOBLE/auth-starter/internal/mail"
+)
+
+// recordingMailer keeps sent messages in memory.
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// messages returns a copy of the messages sent so far.
+func (m *recordingMailer) messages() []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mail.Message(nil), m.sent...)
+}
+
+var tokenParam = regexp.MustCompile(`token=([^\s]+)`)
+
+// linkToken extracts the token query parameter from the link in msg.
+func linkToken(t *testing.T, msg mail.Message) string {
+	t.Helper()
+
+	m := tokenParam.FindStringSubmatch(msg.Body)
+	require.NotNil(t, m, "no link in %q", msg.Body)
+	token, err := url.QueryUnescape(m[1])
+	require.NoError(t, err)
+	return token
+}
+
+func TestEmailVerification(t *testing.T) {
+	newServer := func(t *testing.T) (*Server, *MockDatabaseService, *recordingMailer) {
+		useTestStore(t)
+		db := &MockDatabaseService{}
+		mailer := &recordingMailer{}
+		return &Server{db: db, mailer: mailer}, db, mailer
+	}
+
+	serve := func(s *Server, req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	register := func(t *testing.T, s *Server) *httptest.ResponseRecorder {
+		t.Helper()
+		w := serve(s, httptest.NewRequest(http.MethodPost, "/auth/register",
+			strings.NewReader(`{"email": "new@example.com", "password": "a long passphrase"}`)))
+		require.Equal(t, http.StatusCreated, w.Code)
+		return w
+	}
+
+	t.Run("should email a verification link on registration", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		w := register(t, s)
+
+		assert.Contains(t, w.Body.String(), `"email_verified":false`)
+		require.Len(t, mailer.messages(), 1)
+		assert.Equal(t, "new@example.com", mailer.messages()[0].To)
+
+		token := linkToken(t, mailer.messages()[0])
+		verify := serve(s, httptest.NewRequest(http.MethodGet, "/auth/verify?token="+url.QueryEscape(token), nil))
+
+		require.Equal(t, http.StatusOK, verify.Code)
+		for _, u := range db.Users {
+			assert.True(t, u.EmailVerified)
+		}
+	})
+
+	t.Run("should accept a verification link only once", func(t *testing.T) {
+		s, _, mailer := newServer(t)
+		register(t, s)
+		target := "/auth/verify?token=" + url.QueryEscape(linkToken(t, mailer.messages()[0]))
+
+		require.Equal(t, http.StatusOK, serve(s, httptest.NewRequest(http.MethodGet, target, nil)).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(s, httptest.NewRequest(http.MethodGet, target, nil)).Code)
+	})
+
+	t.Run("should reject unknown and missing tokens", func(t *testing.T) {
+		s, _, _ := newServer(t)
+
+		assert.Equal(t, http.StatusBadRequest, serve(s, httptest.NewRequest(http.MethodGet, "/auth/verify?token=nope", nil)).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(s, httptest.NewRequest(http.MethodGet, "/auth/verify", nil)).Code)
+	})
+
+	t.Run("should resend the link to an unverified user", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		db.Users = map[string]*database.User{"user-1": {ID: "user-1", Email: "jane@example.com"}}
+
+		req := httptest.NewRequest(http.MethodPost, "/me/verify-email", nil)
+		for _, c := range sessionCookies(t, "user-1") {
+			req.AddCookie(c)
+		}
+		w := serve(s, req)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		require.Len(t, mailer.messages(), 1)
+		assert.Equal(t, "jane@example.com", mailer.messages()[0].To)
+	})
+
+	t.Run("should not resend to a verified user", func(t *testing.T) {
+		s, db, mailer := newServer(t)
+		db.Users = map[string]*database.User{"user-1": {ID: "user-1", Email: "jane@example.com", EmailVerified: true}}
+
+		req := httptest.NewRequest(http.MethodPost, "/me/verify-email", nil)
+		for _, c := range sessionCookies(t, "user-1") {
+			req.AddCookie(c)
+		}
+		w := serve(s, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Empty(t, mailer.messages())
+	})
+}
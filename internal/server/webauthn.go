@@ -0,0 +1,495 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/markbates/goth/gothic"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// passkeyVerificationTTL is how long a passkey verified by the signed-in
+// user allows removing passkeys without a code.
+const passkeyVerificationTTL = 5 * time.Minute
+
+// errNoCeremony means a finish endpoint was called without a matching
+// begin in the same session.
+var errNoCeremony = errors.New("no WebAuthn ceremony in progress")
+
+// webauthnUser adapts a user and their stored credentials to the
+// webauthn.User interface. The user handle is our user ID.
+type webauthnUser struct {
+	user        *database.User
+	credentials []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte { return []byte(u.user.ID) }
+
+func (u *webauthnUser) WebAuthnName() string {
+	if u.user.Email != "" {
+		return u.user.Email
+	}
+	return u.user.ID
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	if u.user.Name != "" {
+		return u.user.Name
+	}
+	return u.WebAuthnName()
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+type webauthnCredentialResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func newWebAuthnCredentialResponse(c database.WebAuthnCredential) webauthnCredentialResponse {
+	resp := webauthnCredentialResponse{ID: c.ID, Name: c.Name, CreatedAt: c.CreatedAt}
+	if !c.LastUsedAt.IsZero() {
+		resp.LastUsedAt = &c.LastUsedAt
+	}
+	return resp
+}
+
+// loadWebAuthnUser returns user together with their registered credentials.
+func (s *Server) loadWebAuthnUser(ctx context.Context, user *database.User) (*webauthnUser, error) {
+	stored, err := s.db.ListWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	wu := &webauthnUser{user: user}
+	for _, c := range stored {
+		var cred webauthn.Credential
+		if err := json.Unmarshal(c.Data, &cred); err != nil {
+			return nil, err
+		}
+		wu.credentials = append(wu.credentials, cred)
+	}
+	return wu, nil
+}
+
+// saveCeremony keeps the challenge of a ceremony in the auth session until
+// the matching finish request.
+func saveCeremony(w http.ResponseWriter, r *http.Request, key string, data *webauthn.SessionData) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	session, _ := gothic.Store.Get(r, auth.SessionName)
+	session.Values[key] = encoded
+	return session.Save(r, w)
+}
+
+// takeCeremony removes and returns the challenge saved by saveCeremony, so
+// each challenge can be answered only once.
+func takeCeremony(w http.ResponseWriter, r *http.Request, key string) (*webauthn.SessionData, error) {
+	session, _ := gothic.Store.Get(r, auth.SessionName)
+	encoded, ok := session.Values[key].([]byte)
+	if !ok {
+		return nil, errNoCeremony
+	}
+
+	delete(session.Values, key)
+	if err := session.Save(r, w); err != nil {
+		return nil, err
+	}
+
+	var data webauthn.SessionData
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, errNoCeremony
+	}
+	return &data, nil
+}
+
+// beginWebAuthnRegistrationHandler returns the options for
+// navigator.credentials.create() to register a new passkey.
+func (s *Server) beginWebAuthnRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	wu, err := s.loadWebAuthnUser(r.Context(), user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load WebAuthn credentials", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	options, data, err := s.passkeys.BeginRegistration(wu,
+		webauthn.WithExclusions(webauthn.Credentials(wu.credentials).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err == nil {
+		err = saveCeremony(w, r, auth.SessionWebAuthnRegistrationKey, data)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to begin WebAuthn registration", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, options)
+}
+
+// finishWebAuthnRegistrationHandler verifies the attestation returned by
+// the browser and stores the new credential. An optional ?name= labels it.
+func (s *Server) finishWebAuthnRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	data, err := takeCeremony(w, r, auth.SessionWebAuthnRegistrationKey)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errNoCeremony.Error())
+		return
+	}
+
+	wu, err := s.loadWebAuthnUser(r.Context(), user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load WebAuthn credentials", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	cred, err := s.passkeys.FinishRegistration(wu, *data, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "passkey registration failed")
+		return
+	}
+
+	encoded, err := json.Marshal(cred)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode WebAuthn credential", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	stored := &database.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: cred.ID,
+		Name:         r.URL.Query().Get("name"),
+		Data:         encoded,
+	}
+	if err := s.db.CreateWebAuthnCredential(r.Context(), stored); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to store WebAuthn credential", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	s.recordEvent(r, database.AuthEvent{
+		Type:    database.EventPasskeyRegistered,
+		UserID:  user.ID,
+		Details: map[string]interface{}{"credential_id": stored.ID},
+	})
+
+	writeJSON(w, http.StatusCreated, newWebAuthnCredentialResponse(*stored))
+}
+
+// beginWebAuthnLoginHandler returns the options for
+// navigator.credentials.get(). While an MFA challenge is pending, only the
+// pending user's credentials are allowed and the passkey acts as the
+// second factor. Otherwise any discoverable passkey can sign in on its own.
+func (s *Server) beginWebAuthnLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		options *protocol.CredentialAssertion
+		data    *webauthn.SessionData
+		err     error
+	)
+
+	if userID, _, ok := pendingMFAUser(r); ok {
+		var user *database.User
+		user, err = s.db.GetUserByID(r.Context(), userID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to load user", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		var wu *webauthnUser
+		wu, err = s.loadWebAuthnUser(r.Context(), user)
+		if err == nil && len(wu.credentials) == 0 {
+			writeError(w, http.StatusBadRequest, "no passkeys registered")
+			return
+		}
+		if err == nil {
+			options, data, err = s.passkeys.BeginLogin(wu)
+		}
+	} else {
+		options, data, err = s.passkeys.BeginDiscoverableLogin(
+			webauthn.WithUserVerification(protocol.VerificationRequired))
+	}
+
+	if err == nil {
+		err = saveCeremony(w, r, auth.SessionWebAuthnLoginKey, data)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to begin WebAuthn login", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, options)
+}
+
+// finishWebAuthnLoginHandler verifies the assertion returned by the
+// browser and signs the user in.
+func (s *Server) finishWebAuthnLoginHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := takeCeremony(w, r, auth.SessionWebAuthnLoginKey)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errNoCeremony.Error())
+		return
+	}
+
+	var (
+		user     *database.User
+		provider = auth.WebAuthnProvider
+		cred     *webauthn.Credential
+	)
+
+	if len(data.UserID) > 0 {
+		// Second factor: the challenge was issued to the pending user.
+		userID, pendingProvider, ok := pendingMFAUser(r)
+		if !ok || !bytes.Equal(data.UserID, []byte(userID)) {
+			writeError(w, http.StatusUnauthorized, "no pending sign-in; start again")
+			return
+		}
+		provider = pendingProvider
+
+		user, err = s.db.GetUserByID(r.Context(), userID)
+		var wu *webauthnUser
+		if err == nil {
+			wu, err = s.loadWebAuthnUser(r.Context(), user)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to load WebAuthn user", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		cred, err = s.passkeys.FinishLogin(wu, *data, r)
+	} else {
+		var found webauthn.User
+		found, cred, err = s.passkeys.FinishPasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			u, err := s.db.GetUserByID(r.Context(), string(userHandle))
+			if err != nil {
+				return nil, err
+			}
+			return s.loadWebAuthnUser(r.Context(), u)
+		}, *data, r)
+		if err == nil {
+			user = found.(*webauthnUser).user
+		}
+	}
+
+	if err != nil {
+		var userID string
+		if user != nil {
+			userID = user.ID
+		}
+		s.recordLoginFailure(r, userID, provider, "invalid_passkey", nil)
+		writeError(w, http.StatusUnauthorized, "passkey verification failed")
+		return
+	}
+	if cred.Authenticator.CloneWarning {
+		slog.WarnContext(r.Context(), "WebAuthn sign count went backwards; possible cloned authenticator", "user_id", user.ID)
+		s.recordLoginFailure(r, user.ID, provider, "cloned_authenticator", nil)
+		writeError(w, http.StatusUnauthorized, "passkey verification failed")
+		return
+	}
+	if user.Disabled {
+		s.recordLoginFailure(r, user.ID, provider, "account_disabled", nil)
+		writeError(w, http.StatusForbidden, errAccountDisabled.Error())
+		return
+	}
+
+	encoded, err := json.Marshal(cred)
+	if err == nil {
+		err = s.db.UpdateWebAuthnCredential(r.Context(), cred.ID, encoded)
+	}
+	if err == nil {
+		var details map[string]interface{}
+		if len(data.UserID) > 0 {
+			details = map[string]interface{}{"mfa": true, "second_factor": auth.WebAuthnProvider}
+		}
+		err = s.completeLogin(w, r, user.ID, provider, details)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to complete passkey sign-in", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (s *Server) listWebAuthnCredentialsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	stored, err := s.db.ListWebAuthnCredentials(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list WebAuthn credentials", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	resp := make([]webauthnCredentialResponse, 0, len(stored))
+	for _, c := range stored {
+		resp = append(resp, newWebAuthnCredentialResponse(c))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"credentials": resp})
+}
+
+// beginWebAuthnVerifyHandler returns the options for
+// navigator.credentials.get() limited to the signed-in user's passkeys, so
+// that they can confirm a change such as removing a passkey.
+func (s *Server) beginWebAuthnVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	wu, err := s.loadWebAuthnUser(r.Context(), user)
+	if err == nil && len(wu.credentials) == 0 {
+		writeError(w, http.StatusBadRequest, "no passkeys registered")
+		return
+	}
+	var (
+		options *protocol.CredentialAssertion
+		data    *webauthn.SessionData
+	)
+	if err == nil {
+		options, data, err = s.passkeys.BeginLogin(wu)
+	}
+	if err == nil {
+		err = saveCeremony(w, r, auth.SessionWebAuthnVerifyKey, data)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to begin WebAuthn verification", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, options)
+}
+
+// finishWebAuthnVerifyHandler checks the assertion and notes in the session
+// that the user holds a passkey. Failures count against the account as a
+// wrong code would.
+func (s *Server) finishWebAuthnVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	data, err := takeCeremony(w, r, auth.SessionWebAuthnVerifyKey)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errNoCeremony.Error())
+		return
+	}
+	if !s.checkLoginThrottle(w, r, accountThrottleKey(user.ID, "")) {
+		return
+	}
+
+	wu, err := s.loadWebAuthnUser(r.Context(), user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load WebAuthn credentials", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	cred, err := s.passkeys.FinishLogin(wu, *data, r)
+	if err != nil || cred.Authenticator.CloneWarning {
+		s.rejectCode(r, user.ID, "passkey_verify")
+		writeError(w, http.StatusUnauthorized, "passkey verification failed")
+		return
+	}
+
+	encoded, err := json.Marshal(cred)
+	if err == nil {
+		err = s.db.UpdateWebAuthnCredential(r.Context(), cred.ID, encoded)
+	}
+	if err == nil {
+		session, _ := gothic.Store.Get(r, auth.SessionName)
+		session.Values[auth.SessionWebAuthnVerifiedKey] = time.Now().Unix()
+		err = session.Save(r, w)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record passkey verification", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// confirmPasskeyRemoval requires a fresh second factor before a passkey is
+// removed, as disabling TOTP does, so that a hijacked session cannot remove
+// one: either a passkey verified in this session within
+// passkeyVerificationTTL, or a TOTP or recovery code in the request body.
+// It responds and returns false if neither is given.
+func (s *Server) confirmPasskeyRemoval(w http.ResponseWriter, r *http.Request, userID string) bool {
+	session, _ := gothic.Store.Get(r, auth.SessionName)
+	verified, _ := session.Values[auth.SessionWebAuthnVerifiedKey].(int64)
+	if time.Since(time.Unix(verified, 0)) <= passkeyVerificationTTL {
+		return true
+	}
+
+	var req mfaCodeRequest
+	if err := decodeJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		writeError(w, http.StatusUnauthorized, "verify a passkey or give a current code first")
+		return false
+	}
+
+	if !s.checkLoginThrottle(w, r, accountThrottleKey(userID, "")) {
+		return false
+	}
+	if err := s.checkSecondFactor(r.Context(), userID, req); errors.Is(err, errInvalidCode) {
+		s.rejectCode(r, userID, "passkey_remove")
+		writeError(w, http.StatusUnauthorized, errInvalidCode.Error())
+		return false
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check second factor", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return false
+	}
+	return true
+}
+
+// deleteWebAuthnCredentialHandler removes one of the user's passkeys once
+// confirmPasskeyRemoval is satisfied.
+func (s *Server) deleteWebAuthnCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	if !s.confirmPasskeyRemoval(w, r, user.ID) {
+		return
+	}
+
+	err := s.db.DeleteWebAuthnCredential(r.Context(), user.ID, chi.URLParam(r, "id"))
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		writeError(w, http.StatusNotFound, "credential not found")
+		return
+	case errors.Is(err, database.ErrLastLoginMethod):
+		writeError(w, http.StatusConflict, "cannot remove the last login method")
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "Failed to delete WebAuthn credential", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	s.recordEvent(r, database.AuthEvent{
+		Type:    database.EventPasskeyRemoved,
+		UserID:  user.ID,
+		Details: map[string]interface{}{"credential_id": chi.URLParam(r, "id")},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/markbates/goth/gothic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GRACENOBLE/auth-starter/internal/auth"
+	"github.com/GRACENOBLE/auth-starter/internal/database"
+)
+
+// verifiedCookies returns the cookies of a session for userID that
+// verified a passkey at the given time.
+func verifiedCookies(t *testing.T, userID string, at time.Time) []*http.Cookie {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range sessionCookies(t, userID) {
+		req.AddCookie(c)
+	}
+	session, err := gothic.Store.Get(req, auth.SessionName)
+	require.NoError(t, err)
+	session.Values[auth.SessionWebAuthnVerifiedKey] = at.Unix()
+	w := httptest.NewRecorder()
+	require.NoError(t, session.Save(req, w))
+
+	return w.Result().Cookies()
+}
+
+func TestWebAuthnHandlers(t *testing.T) {
+	const password = "correct horse battery"
+
+	newServer := func(t *testing.T) (*Server, *MockDatabaseService) {
+		useTestStore(t)
+
+		passkeys, err := webauthn.New(&webauthn.Config{
+			RPID:          "localhost",
+			RPDisplayName: "Test",
+			RPOrigins:     []string{"http://localhost:5173"},
+		})
+		require.NoError(t, err)
+
+		credential, err := json.Marshal(webauthn.Credential{ID: []byte("credential-1")})
+		require.NoError(t, err)
+
+		db := &MockDatabaseService{
+			Users: map[string]*database.User{
+				"user-1": {ID: "user-1", Email: "jane@example.com", MFAEnabled: true},
+				"user-2": {ID: "user-2", Email: "sam@example.com"},
+			},
+			Passwords: map[string]string{"user-1": auth.HashPassword(password)},
+			Passkeys: []database.WebAuthnCredential{
+				{ID: "cred-1", UserID: "user-1", CredentialID: []byte("credential-1"), Name: "Laptop", Data: credential},
+			},
+		}
+		return &Server{db: db, passkeys: passkeys}, db
+	}
+
+	serve := func(s *Server, method, target, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+		return w
+	}
+
+	type options struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			RP        struct {
+				ID string `json:"id"`
+			} `json:"rp"`
+			RPID             string `json:"rpId"`
+			UserVerification string `json:"userVerification"`
+			AllowCredentials []struct {
+				ID string `json:"id"`
+			} `json:"allowCredentials"`
+			ExcludeCredentials []struct {
+				ID string `json:"id"`
+			} `json:"excludeCredentials"`
+		} `json:"publicKey"`
+	}
+
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) options {
+		t.Helper()
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var o options
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &o))
+		assert.NotEmpty(t, o.PublicKey.Challenge)
+		return o
+	}
+
+	t.Run("should issue registration options excluding existing passkeys", func(t *testing.T) {
+		s, _ := newServer(t)
+
+		o := decode(t, serve(s, http.MethodPost, "/me/webauthn/register/begin", "", sessionCookies(t, "user-1")))
+
+		assert.Equal(t, "localhost", o.PublicKey.RP.ID)
+		require.Len(t, o.PublicKey.ExcludeCredentials, 1)
+	})
+
+	t.Run("should reject a registration that was not begun", func(t *testing.T) {
+		s, _ := newServer(t)
+
+		w := serve(s, http.MethodPost, "/me/webauthn/register/finish", `{}`, sessionCookies(t, "user-1"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "no WebAuthn ceremony")
+	})
+
+	t.Run("should reject an invalid attestation and spend the challenge", func(t *testing.T) {
+		s, db := newServer(t)
+		begin := serve(s, http.MethodPost, "/me/webauthn/register/begin", "", sessionCookies(t, "user-2"))
+		require.Equal(t, http.StatusOK, begin.Code)
+
+		finish := serve(s, http.MethodPost, "/me/webauthn/register/finish", `{"id": "bogus"}`, begin.Result().Cookies())
+		assert.Equal(t, http.StatusBadRequest, finish.Code)
+		assert.Contains(t, finish.Body.String(), "registration failed")
+		assert.Len(t, db.Passkeys, 1)
+
+		again := serve(s, http.MethodPost, "/me/webauthn/register/finish", `{"id": "bogus"}`, finish.Result().Cookies())
+		assert.Contains(t, again.Body.String(), "no WebAuthn ceremony")
+	})
+
+	t.Run("should offer passwordless login with any discoverable passkey", func(t *testing.T) {
+		s, _ := newServer(t)
+
+		o := decode(t, serve(s, http.MethodPost, "/auth/webauthn/login/begin", "", nil))
+
+		assert.Equal(t, "required", o.PublicKey.UserVerification)
+		assert.Empty(t, o.PublicKey.AllowCredentials)
+	})
+
+	t.Run("should limit a second-factor login to the pending user's passkeys", func(t *testing.T) {
+		s, _ := newServer(t)
+		login := serve(s, http.MethodPost, "/auth/login", `{"email": "jane@example.com", "password": "`+password+`"}`, nil)
+		require.JSONEq(t, `{"mfa_required": true}`, login.Body.String())
+
+		o := decode(t, serve(s, http.MethodPost, "/auth/webauthn/login/begin", "", login.Result().Cookies()))
+
+		require.Len(t, o.PublicKey.AllowCredentials, 1)
+	})
+
+	t.Run("should reject an invalid assertion", func(t *testing.T) {
+		s, _ := newServer(t)
+		begin := serve(s, http.MethodPost, "/auth/webauthn/login/begin", "", nil)
+		require.Equal(t, http.StatusOK, begin.Code)
+
+		w := serve(s, http.MethodPost, "/auth/webauthn/login/finish", `{"id": "bogus"}`, begin.Result().Cookies())
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("should list and delete the user's passkeys", func(t *testing.T) {
+		s, db := newServer(t)
+		cookies := verifiedCookies(t, "user-1", time.Now())
+
+		w := serve(s, http.MethodGet, "/me/webauthn/credentials", "", cookies)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"name":"Laptop"`)
+		assert.NotContains(t, w.Body.String(), "publicKey")
+
+		assert.Equal(t, http.StatusNotFound, serve(s, http.MethodDelete, "/me/webauthn/credentials/cred-1", "", verifiedCookies(t, "user-2", time.Now())).Code)
+		assert.Equal(t, http.StatusNoContent, serve(s, http.MethodDelete, "/me/webauthn/credentials/cred-1", "", cookies).Code)
+		assert.Empty(t, db.Passkeys)
+	})
+
+	t.Run("should require a fresh second factor to delete a passkey", func(t *testing.T) {
+		s, db := newServer(t)
+		secret := auth.GenerateTOTPSecret()
+		db.TOTP = map[string]*mockTOTP{"user-1": {TOTP: database.TOTP{UserID: "user-1", Secret: secret, Enabled: true}}}
+
+		w := serve(s, http.MethodDelete, "/me/webauthn/credentials/cred-1", "", sessionCookies(t, "user-1"))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = serve(s, http.MethodDelete, "/me/webauthn/credentials/cred-1", "", verifiedCookies(t, "user-1", time.Now().Add(-passkeyVerificationTTL-time.Second)))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = serve(s, http.MethodDelete, "/me/webauthn/credentials/cred-1", `{"code": "000000"}`, sessionCookies(t, "user-1"))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, database.EventMFACodeRejected, db.AuthEvents[len(db.AuthEvents)-1].Type)
+		assert.Len(t, db.Passkeys, 1)
+
+		code, err := auth.TOTPCode(secret, time.Now())
+		require.NoError(t, err)
+		w = serve(s, http.MethodDelete, "/me/webauthn/credentials/cred-1", `{"code": "`+code+`"}`, sessionCookies(t, "user-1"))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, db.Passkeys)
+	})
+
+	t.Run("should verify only the user's own passkeys", func(t *testing.T) {
+		s, _ := newServer(t)
+
+		o := decode(t, serve(s, http.MethodPost, "/me/webauthn/verify/begin", "", sessionCookies(t, "user-1")))
+		require.Len(t, o.PublicKey.AllowCredentials, 1)
+
+		w := serve(s, http.MethodPost, "/me/webauthn/verify/begin", "", sessionCookies(t, "user-2"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("should reject an invalid verification", func(t *testing.T) {
+		s, db := newServer(t)
+		begin := serve(s, http.MethodPost, "/me/webauthn/verify/begin", "", sessionCookies(t, "user-1"))
+		require.Equal(t, http.StatusOK, begin.Code)
+
+		w := serve(s, http.MethodPost, "/me/webauthn/verify/finish", `{"id": "bogus"}`, begin.Result().Cookies())
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, database.EventMFACodeRejected, db.AuthEvents[len(db.AuthEvents)-1].Type)
+
+		w = serve(s, http.MethodDelete, "/me/webauthn/credentials/cred-1", "", w.Result().Cookies())
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("should not delete the last login method after unlinking", func(t *testing.T) {
+		s, db := newServer(t)
+		db.Identities = []database.Identity{{ID: "identity-1", UserID: "user-2", Provider: "google"}}
+		db.Passkeys = append(db.Passkeys, database.WebAuthnCredential{ID: "cred-2", UserID: "user-2", CredentialID: []byte("credential-2")})
+		cookies := verifiedCookies(t, "user-2", time.Now())
+
+		assert.Equal(t, http.StatusNoContent, serve(s, http.MethodDelete, "/me/identities/identity-1", "", cookies).Code)
+
+		w := serve(s, http.MethodDelete, "/me/webauthn/credentials/cred-2", "", cookies)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Len(t, db.Passkeys, 2)
+	})
+
+	t.Run("should not expose passkey routes when disabled", func(t *testing.T) {
+		s := &Server{db: &MockDatabaseService{}}
+
+		assert.Equal(t, http.StatusNotFound, serve(s, http.MethodPost, "/auth/webauthn/login/begin", "", nil).Code)
+	})
+}